@@ -0,0 +1,324 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// ExpandPaths returns the files named by the paths, which may be files, directories or glob patterns.
+// Directories are searched recursively, skipping hidden files and directories,
+// glob patterns as understood by filepath.Glob are replaced by the files and directories they match.
+// Every file is returned once, in the order of the paths and in lexical order within directories.
+// It is an error if a path does not exist or a pattern does not match anything.
+func ExpandPaths(paths ...string) ([]string, error) {
+
+	var (
+		files []string
+		seen  = make(map[string]bool)
+	)
+	add := func(file string) {
+		if !seen[file] {
+			seen[file] = true
+			files = append(files, file)
+		}
+	}
+
+	for _, path := range paths {
+		matches := []string{path}
+		if _, err := os.Stat(path); err != nil && strings.ContainsAny(path, "*?[") {
+			matches, err = filepath.Glob(path)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			if len(matches) == 0 {
+				return nil, fmt.Errorf("%s: no matching files", path)
+			}
+		}
+
+		for _, match := range matches {
+			info, err := os.Stat(match)
+			if err != nil {
+				return nil, err
+			}
+			if !info.IsDir() {
+				add(match)
+				continue
+			}
+
+			err = filepath.Walk(match, func(file string, info os.FileInfo, err error) error {
+				if err != nil {
+					return err
+				}
+				if file != match && strings.HasPrefix(info.Name(), ".") {
+					if info.IsDir() {
+						return filepath.SkipDir
+					}
+					return nil
+				}
+				if info.Mode().IsRegular() {
+					add(file)
+				}
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return files, nil
+}
+
+// mergeBuffer limits the number of records of a file that are read ahead of the merge.
+const mergeBuffer = 256
+
+// batchErrors collects the errors of files that are processed at the same time.
+type batchErrors struct {
+	mu        sync.Mutex
+	err       error
+	truncated error
+}
+
+// add records the error of a file. Files in an unknown format are skipped, the first *TruncatedFileError is kept
+// for the end, and any other error stops the processing of all files with cancel.
+func (e *batchErrors) add(err error, cancel func()) {
+
+	if err == nil {
+		return
+	}
+	if errors.Is(err, ErrUnknownFormat) {
+		if Debug {
+			fmt.Println("skipping file:", err)
+		}
+		return
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := err.(*TruncatedFileError); ok {
+		if e.truncated == nil {
+			e.truncated = err
+		}
+	} else if e.err == nil {
+		e.err = err
+		cancel()
+	}
+}
+
+// result returns the error that stopped the processing, or the first *TruncatedFileError.
+func (e *batchErrors) result(ctx context.Context) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err != nil {
+		return e.err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return e.truncated
+}
+
+// readFiles processes the files, up to the configured number at a time, and invokes emit for every record.
+// The records are annotated with their source, and emit is never invoked concurrently.
+// Files that are not in the PCAP or PCAPNG format are skipped, truncated files do not stop the processing of the others,
+// the first *TruncatedFileError is returned once all files have been processed. Other errors stop the processing.
+func readFiles(ctx context.Context, files []string, doJA3s bool, opts []Option, emit func(r *Record) error) error {
+
+	opts = append(opts[:len(opts):len(opts)], withSource())
+	o := newOptions(opts)
+
+	workers := o.concurrentFiles
+	if workers < 1 {
+		workers = 1
+	}
+	if o.merge {
+		return mergeFiles(ctx, files, doJA3s, opts, workers, emit)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		wg    sync.WaitGroup
+		names = make(chan string)
+		errs  batchErrors
+	)
+	handler := func(r *Record) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return emit(r)
+	}
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range names {
+				errs.add(readFile(ctx, file, doJA3s, opts, handler), cancel)
+			}
+		}()
+	}
+
+feed:
+	for _, file := range files {
+		select {
+		case names <- file:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(names)
+	wg.Wait()
+
+	return errs.result(ctx)
+}
+
+// mergeFiles reads every file into a channel of its own and passes the records on in the order of their timestamps,
+// by merging the channels on the timestamps of their next records. The records of a file keep the order they are found in.
+// Up to workers files are processed at the same time, a file whose channel is full leaves its place to the next one
+// until the merge has caught up.
+func mergeFiles(ctx context.Context, files []string, doJA3s bool, opts []Option, workers int, emit func(r *Record) error) error {
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg      sync.WaitGroup
+		errs    batchErrors
+		slots   = make(chan struct{}, workers)
+		streams = make([]chan *Record, len(files))
+	)
+	for i, file := range files {
+		streams[i] = make(chan *Record, mergeBuffer)
+		wg.Add(1)
+		go func(file string, records chan<- *Record) {
+			defer wg.Done()
+			defer close(records)
+
+			select {
+			case slots <- struct{}{}:
+			case <-ctx.Done():
+				return
+			}
+			held := true
+			defer func() {
+				if held {
+					<-slots
+				}
+			}()
+
+			errs.add(readFile(ctx, file, doJA3s, opts, func(r *Record) error {
+				select {
+				case records <- r:
+					return nil
+				default:
+				}
+
+				// wait for the merge without holding up the other files
+				<-slots
+				held = false
+				select {
+				case records <- r:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+				select {
+				case slots <- struct{}{}:
+					held = true
+					return nil
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}), cancel)
+		}(file, streams[i])
+	}
+
+	h := make(mergeHeap, 0, len(streams))
+	for i, records := range streams {
+		if r, ok := <-records; ok {
+			h = append(h, mergeItem{r: r, stream: i})
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 && ctx.Err() == nil {
+		next := h[0]
+		if err := emit(next.r); err != nil {
+			errs.add(err, cancel)
+			break
+		}
+		if r, ok := <-streams[next.stream]; ok {
+			h[0].r = r
+			heap.Fix(&h, 0)
+		} else {
+			heap.Pop(&h)
+		}
+	}
+	wg.Wait()
+
+	return errs.result(ctx)
+}
+
+// mergeItem is the next record of a file in the merge.
+type mergeItem struct {
+	r      *Record
+	stream int
+}
+
+// mergeHeap orders the next records of the files by their timestamps, and records with the same timestamp
+// by the order of the files.
+type mergeHeap []mergeItem
+
+func (h mergeHeap) Len() int { return len(h) }
+
+func (h mergeHeap) Less(i, j int) bool {
+	if !h[i].r.ts.Equal(h[j].r.ts) {
+		return h[i].r.ts.Before(h[j].r.ts)
+	}
+	return h[i].stream < h[j].stream
+}
+
+func (h mergeHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *mergeHeap) Push(x interface{}) { *h = append(*h, x.(mergeItem)) }
+
+func (h *mergeHeap) Pop() interface{} {
+	old := *h
+	item := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return item
+}
+
+// readFile processes the PCAP or PCAPNG file and invokes emit for every record.
+func readFile(ctx context.Context, file string, doJA3s bool, opts []Option, emit func(r *Record) error) error {
+
+	r, f, link, err := openPcap(file, newOptions(opts).keyLog)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return newAssembler(doJA3s, emit, opts...).readPackets(ctx, file, r, link)
+}
@@ -0,0 +1,213 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// batchDir creates a directory with copies of test2.pcap and other files for batch processing.
+// The caller must remove the directory.
+func batchDir(t *testing.T) string {
+
+	data, err := ioutil.ReadFile("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := filepath.Dir(tempFile(t, data))
+
+	for name, data := range map[string][]byte{
+		"b/2.pcap":         data,
+		"b/c/3.pcap":       data,
+		"b/.hidden.pcap":   data,
+		"b/.hidden/4.pcap": data,
+		"b/notes.txt":      []byte("no capture"),
+	} {
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(file, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+/*
+ *	Tests
+ */
+
+func TestExpandPaths(t *testing.T) {
+
+	dir := batchDir(t)
+	defer os.RemoveAll(dir)
+
+	files, err := ExpandPaths(filepath.Join(dir, "b"), filepath.Join(dir, "*.pcap"), filepath.Join(dir, "b", "c", "3.pcap"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		filepath.Join(dir, "b", "2.pcap"),
+		filepath.Join(dir, "b", "c", "3.pcap"),
+		filepath.Join(dir, "b", "notes.txt"),
+		filepath.Join(dir, "test.pcap"),
+	}
+	if !reflect.DeepEqual(files, expected) {
+		t.Fatal("unexpected files", files)
+	}
+
+	if _, err := ExpandPaths(filepath.Join(dir, "missing.pcap")); !os.IsNotExist(err) {
+		t.Fatal("expected a missing file, got", err)
+	}
+	if _, err := ExpandPaths(filepath.Join(dir, "*.pcapng")); err == nil {
+		t.Fatal("expected an error for a pattern without matches")
+	}
+}
+
+func TestProcessFiles(t *testing.T) {
+
+	dir := batchDir(t)
+	defer os.RemoveAll(dir)
+
+	var single []*Record
+	err := NewProcessor(true).ProcessFile(context.Background(), "test2.pcap", func(r *Record) error {
+		single = append(single, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the merge does not depend on the number of files processed at the same time
+	var records []*Record
+	for _, n := range []int{1, 2, 3} {
+		records = nil
+		err = NewProcessor(true, WithConcurrentFiles(n), WithMerge()).ProcessFiles(context.Background(), []string{dir}, func(r *Record) error {
+			records = append(records, r)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(records) != 3*len(single) {
+			t.Fatal("expected", 3*len(single), "records, got", len(records))
+		}
+	}
+
+	// an error of the callback stops the merge
+	errStop := errors.New("stop")
+	var emitted int
+	err = NewProcessor(true, WithMerge()).ProcessFiles(context.Background(), []string{dir}, func(r *Record) error {
+		emitted++
+		return errStop
+	})
+	if err != errStop || emitted != 1 {
+		t.Fatal("expected the callback error after 1 record, got", err, emitted)
+	}
+
+	// the copies have the same timestamps, so the merged records come in groups of three
+	files := make(map[string]bool)
+	for i, r := range records {
+		files[r.SourceFile] = true
+		if s := single[i/3]; r.JA3Digest != s.JA3Digest || r.JA3SDigest != s.JA3SDigest || r.Timestamp != s.Timestamp || r.Packet == 0 {
+			t.Fatal("record", i, "does not match", r.SourceFile, r.Packet)
+		}
+		if i > 0 && r.ts.Before(records[i-1].ts) {
+			t.Fatal("record", i, "is not in chronological order")
+		}
+	}
+	if len(files) != 3 {
+		t.Fatal("unexpected source files", files)
+	}
+	if single[0].SourceFile != "" || single[0].Packet != 0 {
+		t.Fatal("unexpected source of single file", single[0].SourceFile, single[0].Packet)
+	}
+
+	// the packet numbers refer to the packets that completed the client hellos
+	f, err := os.Open("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var packets []gopacket.Packet
+	for {
+		data, _, err := r.ReadPacketData()
+		if err != nil {
+			break
+		}
+		packets = append(packets, gopacket.NewPacket(data, r.LinkType(), gopacket.Lazy))
+	}
+	for _, r := range records {
+		if r.JA3 != "" && string(BarePacket(packets[r.Packet-1])) != r.JA3 {
+			t.Fatal("unexpected packet", r.Packet, "of client hello in", r.SourceFile)
+		}
+	}
+}
+
+func TestReadFilesCSV(t *testing.T) {
+
+	dir := batchDir(t)
+	defer os.RemoveAll(dir)
+
+	data, err := ioutil.ReadFile("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	truncated := filepath.Join(dir, "truncated.pcap")
+	if err := ioutil.WriteFile(truncated, data[:len(data)-10], 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var b bytes.Buffer
+	err = ReadFilesCSVErr([]string{truncated, filepath.Join(dir, "test.pcap")}, &b, ",", true)
+
+	var errTruncated *TruncatedFileError
+	if !errors.As(err, &errTruncated) || errTruncated.File != truncated {
+		t.Fatal("expected a TruncatedFileError, got", err)
+	}
+
+	var (
+		s     = bufio.NewScanner(&b)
+		lines = make(map[string]int)
+	)
+	s.Scan()
+	if !strings.HasSuffix(s.Text(), ",source_file,packet") {
+		t.Fatal("unexpected header", s.Text())
+	}
+	for s.Scan() {
+		values := strings.Split(s.Text(), ",")
+		lines[values[len(values)-2]]++
+	}
+	if len(lines) != 2 || lines[truncated] == 0 || lines[truncated] > lines[filepath.Join(dir, "test.pcap")] {
+		t.Fatal("unexpected lines", lines)
+	}
+}
@@ -15,27 +15,64 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"github.com/dreadl0ck/ja3"
 	"github.com/google/gopacket/pcap"
 	"os"
+	"runtime"
+	"strings"
 )
 
+// tlsFilter matches all segments of connections on the standard ports of protocols running over TLS,
+// so that hellos and certificate chains split across segments can be reassembled, and TCP segments starting
+// with a client or server hello on other ports, including SSLv2 client hellos with their 2 byte record header.
+// SYN and SYN-ACK segments are included for the TCP fingerprints, UDP datagrams on port 443 for QUIC,
+// and UDP datagrams starting with a DTLS handshake record on any port.
+const tlsFilter = "(tcp && (port 443 || port 465 || port 636 || port 853 || port 993 || port 995 || port 8443))" +
+	" || (udp port 443)" +
+	" || (udp[8] = 0x16 && udp[9] = 0xfe)" +
+	" || ((tcp[((tcp[12] & 0xf0) >>2)] = 0x16) && ((tcp[((tcp[12] & 0xf0) >>2)+5] = 0x01) || (tcp[((tcp[12] & 0xf0) >>2)+5] = 0x02)))" +
+	" || ((tcp[((tcp[12] & 0xf0) >>2)] & 0x80 != 0) && (tcp[((tcp[12] & 0xf0) >>2)+2] = 0x01))" +
+	" || (tcp[tcpflags] & tcp-syn != 0)"
+
+// starttlsPorts are the standard ports of the protocols that can be upgraded to TLS with STARTTLS or similar commands.
+var starttlsPorts = []string{"21", "25", "110", "143", "389", "587", "5222", "5432"}
+
 var (
 	flagJSON        = flag.Bool("json", true, "print as JSON array")
+	flagNDJSON      = flag.Bool("ndjson", false, "print as newline delimited JSON objects (default if the output is a pipe)")
 	flagCSV         = flag.Bool("csv", false, "print as CSV")
 	flagTSV         = flag.Bool("tsv", false, "print as TAB separated values")
 	flagSeparator   = flag.String("separator", ",", "set a custom separator")
-	flagInput       = flag.String("read", "", "read PCAP file")
+	flagInput       = flag.String("read", "", "read PCAP file, or a comma separated list of PCAP files, directories and glob patterns")
 	flagDebug       = flag.Bool("debug", false, "toggle debug mode")
 	flagInterface   = flag.String("iface", "", "specify network interface to read packets from")
 	flagJa3S        = flag.Bool("ja3s", true, "include ja3 server hashes (ja3s)")
 	flagOnlyJa3S    = flag.Bool("ja3s-only", false, "dump ja3s only")
+	flagJa4         = flag.Bool("ja4", false, "include ja4 client and ja4s server fingerprints")
+	flagJa4x        = flag.Bool("ja4x", false, "include ja4x fingerprints and metadata of server certificates")
+	flagHassh       = flag.Bool("hassh", false, "include hassh client and hassh server fingerprints of SSH connections")
+	flagJa4t        = flag.Bool("ja4t", false, "include ja4t and ja4ts fingerprints of the TCP connection setup")
+	flagJa4h        = flag.Bool("ja4h", false, "include ja4h fingerprints of cleartext HTTP requests")
+	flagHTTP2       = flag.Bool("http2", false, "include http2 fingerprints of clients sending the cleartext HTTP/2 preface")
+	flagTransport   = flag.Bool("transport", false, "add a transport column with quic, dtls, the starttls protocol or sslv2 to CSV output")
+	flagECH         = flag.Bool("ech", false, "include the encrypted client hello type, config id and public name")
+	flagECHKeys     = flag.String("ech-keys", "", "comma separated list of PEM files with ECH keys to decrypt inner client hellos with")
+	flagKeyLog      = flag.String("keylog", "", "key log file (SSLKEYLOGFILE) to decrypt the handshake of TLS 1.3 servers with")
+	flagDecrypt     = flag.Bool("decrypt", false, "decrypt the handshake of TLS 1.3 servers with the secrets embedded in pcapng files")
+	flagP0f         = flag.String("p0f", "", "p0f fingerprint database (p0f.fp) to match the TCP connection setup against")
+	flagPair        = flag.Bool("pair", false, "combine client and server hello of a connection into one record")
+	flagPairTimeout = flag.Duration("pair-timeout", ja3.DefaultPairTimeout, "time to wait for the server hello when pairing")
+	flagConcurrency = flag.Int("concurrency", 1, "number of input files processed at the same time, the order of the records varies between runs above 1 without -merge, defaults to the number of CPUs with -merge")
+	flagMerge       = flag.Bool("merge", false, "merge the records of multiple input files in chronological order")
+	flagWorkers     = flag.Int("workers", 1, "number of goroutines processing the packets of the input file, sharded by flow")
+	flagDB          = flag.String("db", "", "comma separated list of fingerprint database files to annotate records with")
 	flagSnaplen     = flag.Int("snaplen", 1514, "default snap length for ethernet frames")
 	flagPromisc     = flag.Bool("promisc", true, "capture in promiscuous mode (requires root)")
-	flagFilter      = flag.String("bpf", "(tcp[((tcp[12] & 0xf0) >>2)] = 0x16) && ((tcp[((tcp[12] & 0xf0) >>2)+5] = 0x01) || (tcp[((tcp[12] & 0xf0) >>2)+5] = 0x02))", "BPF filter for pcap, only support on live")
-	flagDumpPackets = flag.String("dump", "", "dump pcap file name, only support on live")
+	flagFilter      = flag.String("bpf", "", "BPF filter for pcap, only support on live (default depends on the enabled fingerprints)")
+	flagDumpPackets = flag.String("dump", "", "dump the packets that completed a handshake message to a pcap file, only support on live")
 	// https://godoc.org/github.com/google/gopacket/pcap#hdr-PCAP_Timeouts
 	flagTimeout = flag.Duration("timeout", pcap.BlockForever, "timeout for collecting packet batches")
 	flagVersion = flag.Bool("version", false, "display version and exit")
@@ -43,43 +80,265 @@ var (
 
 const version = "v1.0.2"
 
+// exit codes
+const (
+	exitOK = iota
+	exitUsage
+	exitError
+	exitUnsupportedLinkType
+	exitTruncatedFile
+	exitWriteFailed
+)
+
 func main() {
 
-	flag.Parse()
+	// the flag package exits with 2 on invalid flags, which is the code of other errors here
+	flag.CommandLine.Init(os.Args[0], flag.ContinueOnError)
+	if err := flag.CommandLine.Parse(os.Args[1:]); err != nil {
+		if err == flag.ErrHelp {
+			os.Exit(exitOK)
+		}
+		os.Exit(exitUsage)
+	}
 
 	if *flagVersion {
 		fmt.Println(version)
-		os.Exit(0)
+		os.Exit(exitOK)
 	}
 
 	ja3.Debug = *flagDebug
 
+	if *flagInterface == "" && *flagInput == "" && flag.NArg() == 0 {
+		fmt.Println("use the -read flag to supply an input file.")
+		os.Exit(exitUsage)
+	}
+
+	err := run()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(exitCode(err))
+	}
+}
+
+func run() error {
+
+	var opts []ja3.Option
+	if *flagJa4 {
+		opts = append(opts, ja3.WithJA4())
+	}
+	if *flagJa4x {
+		opts = append(opts, ja3.WithJA4X())
+	}
+	if *flagHassh {
+		opts = append(opts, ja3.WithHASSH())
+	}
+	if *flagJa4t {
+		opts = append(opts, ja3.WithJA4T())
+	}
+	if *flagJa4h {
+		opts = append(opts, ja3.WithJA4H())
+	}
+	if *flagHTTP2 {
+		opts = append(opts, ja3.WithHTTP2())
+	}
+	if *flagTransport {
+		opts = append(opts, ja3.WithTransport())
+	}
+	if *flagECHKeys != "" {
+		k, err := ja3.LoadECHKeys(strings.Split(*flagECHKeys, ",")...)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ja3.WithECH(k))
+	} else if *flagECH {
+		opts = append(opts, ja3.WithECH(nil))
+	}
+	if *flagKeyLog != "" {
+		k, err := ja3.LoadKeyLog(*flagKeyLog)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ja3.WithKeyLog(k))
+	} else if *flagDecrypt {
+		opts = append(opts, ja3.WithKeyLog(ja3.NewKeyLog()))
+	}
+	if *flagP0f != "" {
+		db, err := ja3.LoadP0f(*flagP0f)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ja3.WithP0f(db))
+	}
+	if *flagPair {
+		opts = append(opts, ja3.WithPairing(*flagPairTimeout))
+	}
+	if *flagWorkers > 1 {
+		opts = append(opts, ja3.WithWorkers(*flagWorkers))
+	}
+	if n := concurrency(); n > 1 {
+		opts = append(opts, ja3.WithConcurrentFiles(n))
+	}
+	if *flagMerge {
+		opts = append(opts, ja3.WithMerge())
+	}
+	if *flagDB != "" {
+		db, err := ja3.LoadDatabase(strings.Split(*flagDB, ",")...)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, ja3.WithDatabase(db))
+	}
+
 	if *flagInterface != "" {
-		ja3.ReadInterface(*flagInterface, *flagFilter, *flagDumpPackets, os.Stdout, *flagSeparator, *flagJa3S, *flagJSON, *flagSnaplen, *flagPromisc, *flagTimeout)
-		return
+		return ja3.ReadInterfaceErr(*flagInterface, bpfFilter(), *flagDumpPackets, os.Stdout, *flagSeparator, *flagJa3S, *flagJSON, *flagSnaplen, *flagPromisc, *flagTimeout, opts...)
 	}
 
-	if *flagInput == "" {
-		fmt.Println("use the -read flag to supply an input file.")
-		os.Exit(1)
+	paths := inputPaths()
+	if len(paths) > 1 || !isFile(paths[0]) {
+		return readFiles(paths, opts)
+	}
+	input := paths[0]
+
+	if *flagOnlyJa3S {
+		return ja3.ReadFileJa3sErr(input, os.Stdout, opts...)
+	}
+
+	if *flagTSV {
+		return ja3.ReadFileCSVErr(input, os.Stdout, "\t", *flagJa3S, opts...)
+	}
+
+	if *flagCSV {
+		return ja3.ReadFileCSVErr(input, os.Stdout, *flagSeparator, *flagJa3S, opts...)
+	}
+
+	if useNDJSON() {
+		return ja3.ReadFileNDJSONErr(input, os.Stdout, *flagJa3S, opts...)
+	}
+
+	if *flagJSON {
+		return ja3.ReadFileJSONErr(input, os.Stdout, *flagJa3S, opts...)
 	}
 
+	return nil
+}
+
+// readFiles reads all files named by the paths in the output format chosen by the flags,
+// the records carry the source file and the number of the packet.
+func readFiles(paths []string, opts []ja3.Option) error {
+
 	if *flagOnlyJa3S {
-		ja3.ReadFileJa3s(*flagInput, os.Stdout)
-		return
+		return ja3.ReadFilesJa3sErr(paths, os.Stdout, opts...)
 	}
 
 	if *flagTSV {
-		ja3.ReadFileCSV(*flagInput, os.Stdout, "\t", *flagJa3S)
-		return
+		return ja3.ReadFilesCSVErr(paths, os.Stdout, "\t", *flagJa3S, opts...)
 	}
 
 	if *flagCSV {
-		ja3.ReadFileCSV(*flagInput, os.Stdout, *flagSeparator, *flagJa3S)
-		return
+		return ja3.ReadFilesCSVErr(paths, os.Stdout, *flagSeparator, *flagJa3S, opts...)
+	}
+
+	if useNDJSON() {
+		return ja3.ReadFilesNDJSONErr(paths, os.Stdout, *flagJa3S, opts...)
 	}
 
 	if *flagJSON {
-		ja3.ReadFileJSON(*flagInput, os.Stdout, *flagJa3S)
+		return ja3.ReadFilesJSONErr(paths, os.Stdout, *flagJa3S, opts...)
+	}
+
+	return nil
+}
+
+// bpfFilter returns the BPF filter of the -bpf flag, if it has been set,
+// or a filter for TLS and the plaintext protocols that are fingerprinted with the enabled options otherwise.
+func bpfFilter() string {
+
+	var explicit bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "bpf" {
+			explicit = true
+		}
+	})
+	if explicit {
+		return *flagFilter
+	}
+
+	ports := starttlsPorts
+	if *flagHassh {
+		ports = append(ports, "22")
+	}
+	if *flagJa4h || *flagHTTP2 {
+		ports = append(ports, "80", "8080")
+	}
+	return tlsFilter + " || (tcp && (port " + strings.Join(ports, " || port ") + "))"
+}
+
+// concurrency returns the number of input files processed at the same time, as set with the -concurrency flag,
+// or the number of CPUs if the records are merged, which keeps their order independent of the concurrency.
+func concurrency() int {
+
+	var explicit bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "concurrency" {
+			explicit = true
+		}
+	})
+	if !explicit && *flagMerge {
+		return runtime.NumCPU()
+	}
+	return *flagConcurrency
+}
+
+// inputPaths returns the paths of the -read flag followed by the remaining arguments.
+func inputPaths() []string {
+	var paths []string
+	if *flagInput != "" {
+		paths = strings.Split(*flagInput, ",")
+	}
+	return append(paths, flag.Args()...)
+}
+
+// isFile reports whether path names an existing file that is not a directory.
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir()
+}
+
+// useNDJSON reports whether NDJSON was requested,
+// or whether stdout is a pipe and no JSON output format has been chosen explicitly.
+func useNDJSON() bool {
+
+	var explicit bool
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "ndjson" || f.Name == "json" {
+			explicit = true
+		}
+	})
+	if explicit {
+		return *flagNDJSON
+	}
+
+	info, err := os.Stdout.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeNamedPipe != 0
+}
+
+// exitCode maps an error to the exit code of the process.
+func exitCode(err error) int {
+	var (
+		errLinkType  *ja3.UnsupportedLinkTypeError
+		errTruncated *ja3.TruncatedFileError
+		errWrite     *ja3.WriteError
+	)
+	switch {
+	case errors.As(err, &errLinkType):
+		return exitUnsupportedLinkType
+	case errors.As(err, &errTruncated):
+		return exitTruncatedFile
+	case errors.As(err, &errWrite):
+		return exitWriteFailed
 	}
+	return exitError
 }
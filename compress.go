@@ -0,0 +1,125 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// Magic bytes at the start of compressed data.
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+	xzMagic   = []byte{0xfd, '7', 'z', 'X', 'Z', 0x00}
+	lz4Magic  = []byte{0x04, 0x22, 0x4d, 0x18}
+
+	// LZ4 legacy frames, as written by lz4 -l
+	lz4LegacyMagic = []byte{0x02, 0x21, 0x4c, 0x18}
+)
+
+// Decompress returns a reader for the decompressed data of r, if it starts with the magic bytes
+// of gzip, zstd, xz or LZ4 compressed data, in the frame or the legacy format, or a reader for the data of r otherwise.
+// The data is decompressed while it is read. Closing the reader releases the decompressor, but does not close r.
+func Decompress(r io.Reader) (io.ReadCloser, error) {
+
+	br := bufio.NewReader(r)
+	magic, _ := br.Peek(len(xzMagic))
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		return gzip.NewReader(br)
+	case bytes.HasPrefix(magic, zstdMagic):
+		d, err := zstd.NewReader(br, zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		return d.IOReadCloser(), nil
+	case bytes.HasPrefix(magic, xzMagic):
+		x, err := xz.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return ioutil.NopCloser(x), nil
+	case bytes.HasPrefix(magic, lz4Magic), bytes.HasPrefix(magic, lz4LegacyMagic):
+		return ioutil.NopCloser(&lz4Frames{r: br, z: lz4.NewReader(br)}), nil
+	}
+	return ioutil.NopCloser(br), nil
+}
+
+// lz4Frames reads the concatenated frames of LZ4 compressed data, lz4.Reader stops at the end of the first one.
+type lz4Frames struct {
+	r *bufio.Reader
+	z *lz4.Reader
+}
+
+// Read decompresses the next frame once the current one has been read completely.
+// Truncated data is reported as io.ErrUnexpectedEOF, which lz4.Reader wraps with its state.
+func (l *lz4Frames) Read(p []byte) (int, error) {
+	for {
+		n, err := l.z.Read(p)
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return n, io.ErrUnexpectedEOF
+		}
+		if err != io.EOF {
+			return n, err
+		}
+		if _, errPeek := l.r.Peek(1); errPeek != nil {
+			return n, io.EOF
+		}
+		l.z.Reset(l.r)
+		if n > 0 {
+			return n, nil
+		}
+	}
+}
+
+// captureFile is a file whose data is decompressed while it is read.
+type captureFile struct {
+	io.ReadCloser
+	f *os.File
+}
+
+// openCapture opens the file and decompresses its data if it is compressed, see Decompress.
+func openCapture(file string) (io.ReadCloser, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := Decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return &captureFile{ReadCloser: r, f: f}, nil
+}
+
+// Close releases the decompressor and closes the file.
+func (c *captureFile) Close() error {
+	c.ReadCloser.Close()
+	return c.f.Close()
+}
@@ -0,0 +1,191 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/pierrec/lz4/v4"
+	"github.com/ulikunitz/xz"
+)
+
+// lz4Capture is the capture of manyFlowsCapture(t, 200), compressed with the lz4 tool into two frames
+// with a skippable frame in between. The first frame uses linked 64KB blocks, block checksums and the content size.
+const lz4Capture = "test_flows.pcap.lz4"
+
+// compressors compress data with each of the supported formats.
+var compressors = map[string]func(w io.Writer) (io.WriteCloser, error){
+	"gz": func(w io.Writer) (io.WriteCloser, error) {
+		return gzip.NewWriter(w), nil
+	},
+	"zst": func(w io.Writer) (io.WriteCloser, error) {
+		return zstd.NewWriter(w)
+	},
+	"xz": func(w io.Writer) (io.WriteCloser, error) {
+		return xz.NewWriter(w)
+	},
+	"lz4": func(w io.Writer) (io.WriteCloser, error) {
+		z := lz4.NewWriter(w)
+		return z, z.Apply(lz4.BlockSizeOption(lz4.Block64Kb))
+	},
+}
+
+// compress returns data compressed with the given compressor.
+func compress(t *testing.T, format string, data []byte) []byte {
+
+	var b bytes.Buffer
+	w, err := compressors[format](&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// decompress returns the data read from Decompress.
+func decompress(data []byte) ([]byte, error) {
+	r, err := Decompress(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
+
+/*
+ *	Tests
+ */
+
+func TestDecompress(t *testing.T) {
+
+	data, err := ioutil.ReadFile("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var expected bytes.Buffer
+	if err := ReadFileJSONErr("test2.pcap", &expected, true); err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "ja3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for format := range compressors {
+		compressed := compress(t, format, data)
+		if out, err := decompress(compressed); err != nil || !bytes.Equal(out, data) {
+			t.Fatal(format, "unexpected data", err)
+		}
+
+		file := filepath.Join(dir, "test.pcap."+format)
+		if err := ioutil.WriteFile(file, compressed, 0644); err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		if err := ReadFileJSONErr(file, &b, true); err != nil || b.String() != expected.String() {
+			t.Fatal(format, "unexpected output", err, b.String())
+		}
+
+		// the records before the end of a truncated file are still written
+		truncated := filepath.Join(dir, "truncated.pcap."+format)
+		if err := ioutil.WriteFile(truncated, compressed[:len(compressed)*3/4], 0644); err != nil {
+			t.Fatal(err)
+		}
+		var errTruncated *TruncatedFileError
+		if err := ReadFileJSONErr(truncated, ioutil.Discard, true); !errors.As(err, &errTruncated) || errTruncated.Packets == 0 {
+			t.Fatal(format, "expected a TruncatedFileError, got", err)
+		}
+	}
+
+	// uncompressed data is passed through
+	if out, err := decompress(data); err != nil || !bytes.Equal(out, data) {
+		t.Fatal("unexpected data", err)
+	}
+	if out, err := decompress(nil); err != nil || len(out) != 0 {
+		t.Fatal("unexpected data", err, out)
+	}
+}
+
+func TestDecompressLZ4(t *testing.T) {
+
+	compressed, err := ioutil.ReadFile(lz4Capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture := manyFlowsCapture(t, 200).Bytes()
+
+	if out, err := decompress(compressed); err != nil || !bytes.Equal(out, capture) {
+		t.Fatal("unexpected data", err, len(out), len(capture))
+	}
+
+	var (
+		expected, b bytes.Buffer
+		file        = tempFile(t, capture)
+	)
+	defer os.RemoveAll(filepath.Dir(file))
+	if err := ReadFileNDJSONErr(file, &expected, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReadFileNDJSONErr(lz4Capture, &b, true); err != nil || b.Len() == 0 || b.String() != expected.String() {
+		t.Fatal("unexpected output", err, b.String())
+	}
+
+	// the first frame ends before the skippable frame
+	if _, err := decompress(compressed[:len(compressed)/2]); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+
+	// a corrupted block fails its checksum
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)/4] ^= 0xff
+	if _, err := decompress(corrupted); !errors.Is(err, lz4.ErrInvalidBlockChecksum) {
+		t.Fatal("expected lz4.ErrInvalidBlockChecksum, got", err)
+	}
+
+	// the legacy format of lz4 -l
+	var legacy bytes.Buffer
+	w := lz4.NewWriter(&legacy)
+	if err := w.Apply(lz4.LegacyOption(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write(capture); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(legacy.Bytes(), lz4LegacyMagic) {
+		t.Fatalf("unexpected magic %x", legacy.Bytes()[:4])
+	}
+	if out, err := decompress(legacy.Bytes()); err != nil || !bytes.Equal(out, capture) {
+		t.Fatal("unexpected data", err, len(out), len(capture))
+	}
+
+}
@@ -17,99 +17,198 @@
 package ja3
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"strconv"
 	"strings"
-
-	"github.com/google/gopacket"
 )
 
 // ReadFileCSV reads the PCAP file at the given path
 // and prints out all packets containing JA3 digests to the supplied io.Writer
-func ReadFileCSV(file string, out io.Writer, separator string, doJA3s bool) {
-
-	r, f, link, err := openPcap(file)
+// It panics on errors, use ReadFileCSVErr to handle them.
+func ReadFileCSV(file string, out io.Writer, separator string, doJA3s bool, opts ...Option) {
+	err := ReadFileCSVErr(file, out, separator, doJA3s, opts...)
 	if err != nil {
 		panic(err)
 	}
+}
+
+// ReadFileCSVErr is like ReadFileCSV, but returns errors instead of panicking.
+func ReadFileCSVErr(file string, out io.Writer, separator string, doJA3s bool, opts ...Option) error {
+
+	o := newOptions(opts)
+	r, f, link, err := openPcap(file, o.keyLog)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
-	columns := []string{"timestamp", "source_ip", "source_port", "destination_ip", "destination_port", "ja3_digest", "ja3s_digest"}
-	_, err = out.Write([]byte(strings.Join(columns, separator) + "\n"))
+	if err := writeCSVHeader(out, separator, o); err != nil {
+		return err
+	}
+
+	a := newAssembler(doJA3s, csvWriter(out, separator, o), opts...)
+	return a.readPackets(context.Background(), file, r, link)
+}
+
+// ReadFilesCSVErr is like ReadFileCSVErr, but reads all files named by the paths, see ExpandPaths.
+// The header is written once, the lines end with the source file and the number of the packet that completed the handshake.
+func ReadFilesCSVErr(paths []string, out io.Writer, separator string, doJA3s bool, opts ...Option) error {
+
+	files, err := ExpandPaths(paths...)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	count := 0
-	for {
-		// read packet data
-		data, ci, err := r.ReadPacketData()
-		if err == io.EOF {
-			if Debug {
-				fmt.Println(count, "fingerprints.")
-			}
-			return
-		} else if err != nil {
-			panic(err)
-		}
+	o := newOptions(opts)
+	o.source = true
+	if err := writeCSVHeader(out, separator, o); err != nil {
+		return err
+	}
 
-		var (
-			// create gopacket
-			p = gopacket.NewPacket(data, link, gopacket.Lazy)
-			// get JA3 if possible
-			digest   = DigestHexPacket(p)
-			isServer bool
-		)
-
-		if doJA3s && digest == "" {
-			digest = DigestHexPacketJa3s(p)
-			isServer = true
-		}
+	return readFiles(context.Background(), files, doJA3s, opts, csvWriter(out, separator, o))
+}
 
-		// check if we got a result
-		if digest != "" {
-
-			count++
-
-			var (
-				b  strings.Builder
-				nl = p.NetworkLayer()
-				tl = p.TransportLayer()
-			)
-
-			// got an a digest but no transport or network layer
-			if tl == nil || nl == nil {
-				if Debug {
-					fmt.Println("got a nil layer: ", nl, tl, p.Dump(), digest)
-				}
-				continue
-			}
-
-			b.WriteString(timeToString(ci.Timestamp))
-			b.WriteString(separator)
-			b.WriteString(nl.NetworkFlow().Src().String())
-			b.WriteString(separator)
-			b.WriteString(tl.TransportFlow().Src().String())
-			b.WriteString(separator)
-			b.WriteString(nl.NetworkFlow().Dst().String())
-			b.WriteString(separator)
-			b.WriteString(tl.TransportFlow().Dst().String())
-			b.WriteString(separator)
-			if isServer {
-				b.WriteString("")
-				b.WriteString(separator)
-				b.WriteString(digest)
-			} else { // client
-				b.WriteString(digest)
-				b.WriteString(separator)
-				b.WriteString("")
-			}
-			b.WriteString("\n")
-
-			_, err := out.Write([]byte(b.String()))
-			if err != nil {
-				panic(err)
-			}
+// writeCSVHeader writes the names of the columns for the options.
+func writeCSVHeader(out io.Writer, separator string, o options) error {
+
+	columns := []string{"timestamp", "source_ip", "source_port", "destination_ip", "destination_port", "ja3_digest", "ja3s_digest"}
+	if o.pair {
+		columns = append(columns, "sni", "handshake_rtt")
+	}
+	if o.ja4 {
+		columns = append(columns, "ja4", "ja4_o", "ja4s")
+	}
+	if o.ja4x {
+		columns = append(columns, "ja4x")
+	}
+	if o.hassh {
+		columns = append(columns, "hassh", "hassh_server")
+	}
+	if o.ja4t {
+		columns = append(columns, "ja4t", "ja4ts")
+	}
+	if o.ja4h {
+		columns = append(columns, "ja4h")
+	}
+	if o.http2 {
+		columns = append(columns, "http2_digest")
+	}
+	if o.ech {
+		columns = append(columns, "ech", "ech_inner_ja3_digest")
+	}
+	if o.transport {
+		columns = append(columns, "transport")
+	}
+	if o.db != nil {
+		columns = append(columns, "severity")
+	}
+	if o.source {
+		columns = append(columns, "source_file", "packet")
+	}
+
+	return write(out, []byte(strings.Join(columns, separator)+"\n"))
+}
+
+// csvWriter returns a function that writes records as lines with the columns for the options.
+func csvWriter(out io.Writer, separator string, o options) func(r *Record) error {
+	return func(r *Record) error {
+		values := []string{r.JA3Digest, r.JA3SDigest}
+		if o.pair {
+			values = append(values, r.SNI, rttString(r))
+		}
+		if o.ja4 {
+			values = append(values, r.JA4, r.JA4O, r.JA4S)
+		}
+		if o.ja4x {
+			values = append(values, ja4xString(r))
+		}
+		if o.hassh {
+			values = append(values, r.HASSH, r.HASSHServer)
+		}
+		if o.ja4t {
+			values = append(values, r.JA4T, r.JA4TS)
+		}
+		if o.ja4h {
+			values = append(values, r.JA4H)
 		}
+		if o.http2 {
+			values = append(values, r.HTTP2Digest)
+		}
+		if o.ech {
+			values = append(values, echStrings(r)...)
+		}
+		if o.transport {
+			values = append(values, transportString(r))
+		}
+		if o.db != nil {
+			values = append(values, r.Severity)
+		}
+		if o.source {
+			values = append(values, r.SourceFile, strconv.Itoa(r.Packet))
+		}
+
+		return write(out, []byte(csvLine(r, separator, values...)))
+	}
+}
+
+// csvLine formats the connection details of a record followed by the supplied values as a line of separated values.
+func csvLine(r *Record, separator string, values ...string) string {
+
+	var b strings.Builder
+
+	b.WriteString(timeToString(r.ts))
+	b.WriteString(separator)
+	b.WriteString(r.SourceIP)
+	b.WriteString(separator)
+	b.WriteString(strconv.Itoa(r.SourcePort))
+	b.WriteString(separator)
+	b.WriteString(r.DestinationIP)
+	b.WriteString(separator)
+	b.WriteString(strconv.Itoa(r.DestinationPort))
+	for _, v := range values {
+		b.WriteString(separator)
+		b.WriteString(v)
+	}
+	b.WriteString("\n")
+
+	return b.String()
+}
+
+// ja4xString joins the JA4X fingerprints of the certificate chain of a record with spaces.
+func ja4xString(r *Record) string {
+	fingerprints := make([]string, len(r.Certificates))
+	for i, c := range r.Certificates {
+		fingerprints[i] = c.JA4X
+	}
+	return strings.Join(fingerprints, " ")
+}
+
+// echStrings returns the ECH type and the JA3 digest of the inner client hello of a record,
+// or empty strings if the client hello does not use ECH.
+func echStrings(r *Record) []string {
+	if r.ECH == nil {
+		return []string{"", ""}
+	}
+	return []string{r.ECH.Type, r.ECH.InnerJA3Digest}
+}
+
+// transportString returns sslv2 for SSLv2 client hellos, the protocol of STARTTLS upgrades, or the transport of a record,
+// which is empty for TLS over TCP.
+func transportString(r *Record) string {
+	switch {
+	case r.SSLv2:
+		return "sslv2"
+	case r.StartTLS != "":
+		return r.StartTLS
+	}
+	return r.Transport
+}
+
+// rttString formats the handshake round trip time in seconds, or returns an empty string for unpaired records.
+func rttString(r *Record) string {
+	if r.HandshakeRTT == 0 {
+		return ""
 	}
+	return strconv.FormatFloat(r.HandshakeRTT, 'f', 6, 64)
 }
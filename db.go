@@ -0,0 +1,373 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fingerprint types an Entry can be restricted to.
+const (
+	TypeJA3  = "ja3"
+	TypeJA3S = "ja3s"
+	TypeJA4  = "ja4"
+	TypeJA4S = "ja4s"
+
+	TypeHASSH       = "hassh"
+	TypeHASSHServer = "hassh_server"
+)
+
+// Severities of database entries, in ascending order.
+const (
+	SeverityInfo     = "info"
+	SeverityLow      = "low"
+	SeverityMedium   = "medium"
+	SeverityHigh     = "high"
+	SeverityCritical = "critical"
+)
+
+// Sources of the public lists.
+const (
+	SourceSSLBL = "abuse.ch sslbl"
+	SourceJA3er = "ja3er"
+)
+
+var severityRanks = map[string]int{
+	SeverityInfo:     1,
+	SeverityLow:      2,
+	SeverityMedium:   3,
+	SeverityHigh:     4,
+	SeverityCritical: 5,
+}
+
+// Entry describes a known fingerprint.
+type Entry struct {
+	Fingerprint string `json:"fingerprint" yaml:"fingerprint"`
+
+	// restricts matching to one fingerprint type, if set
+	Type string `json:"type,omitempty" yaml:"type,omitempty"`
+
+	Labels   []string `json:"labels,omitempty" yaml:"labels,omitempty"`
+	Severity string   `json:"severity,omitempty" yaml:"severity,omitempty"`
+	Source   string   `json:"source,omitempty" yaml:"source,omitempty"`
+}
+
+// Database holds known fingerprints and annotates records that match them.
+// Once loaded, a Database can be used concurrently.
+type Database struct {
+	entries map[string][]*Entry
+}
+
+// NewDatabase returns an empty Database.
+func NewDatabase() *Database {
+	return &Database{
+		entries: make(map[string][]*Entry),
+	}
+}
+
+// LoadDatabase returns a Database containing the entries of all given files, see Database.LoadFile.
+func LoadDatabase(files ...string) (*Database, error) {
+	db := NewDatabase()
+	for _, file := range files {
+		if err := db.LoadFile(file); err != nil {
+			return nil, err
+		}
+	}
+	return db, nil
+}
+
+// Len returns the number of fingerprints in the database.
+func (db *Database) Len() int {
+	return len(db.entries)
+}
+
+// Add adds an entry to the database.
+func (db *Database) Add(e Entry) error {
+
+	e.Fingerprint = strings.ToLower(strings.TrimSpace(e.Fingerprint))
+	e.Type = strings.ToLower(e.Type)
+	e.Severity = strings.ToLower(e.Severity)
+
+	if e.Fingerprint == "" {
+		return errors.New("empty fingerprint")
+	}
+	switch e.Type {
+	case "", TypeJA3, TypeJA3S, TypeJA4, TypeJA4S, TypeHASSH, TypeHASSHServer:
+	default:
+		return fmt.Errorf("invalid type %q for fingerprint %s", e.Type, e.Fingerprint)
+	}
+	if _, ok := severityRanks[e.Severity]; !ok && e.Severity != "" {
+		return fmt.Errorf("invalid severity %q for fingerprint %s", e.Severity, e.Fingerprint)
+	}
+
+	db.entries[e.Fingerprint] = append(db.entries[e.Fingerprint], &e)
+	return nil
+}
+
+// Lookup returns all entries for the fingerprint.
+func (db *Database) Lookup(fingerprint string) []*Entry {
+	return db.entries[strings.ToLower(fingerprint)]
+}
+
+// Annotate looks up the fingerprints of the record and adds the labels and sources of all matching entries,
+// as well as the highest severity among them. It reports whether any entry matched.
+func (db *Database) Annotate(r *Record) bool {
+	matched := db.annotate(r, TypeJA3, r.JA3Digest)
+	matched = db.annotate(r, TypeJA3S, r.JA3SDigest) || matched
+	matched = db.annotate(r, TypeJA4, r.JA4) || matched
+	matched = db.annotate(r, TypeJA4S, r.JA4S) || matched
+	matched = db.annotate(r, TypeHASSH, r.HASSH) || matched
+	return db.annotate(r, TypeHASSHServer, r.HASSHServer) || matched
+}
+
+func (db *Database) annotate(r *Record, typ, fingerprint string) bool {
+	if fingerprint == "" {
+		return false
+	}
+
+	var matched bool
+	for _, e := range db.Lookup(fingerprint) {
+		if e.Type != "" && e.Type != typ {
+			continue
+		}
+		matched = true
+		for _, l := range e.Labels {
+			r.Labels = appendUnique(r.Labels, l)
+		}
+		if e.Source != "" {
+			r.Sources = appendUnique(r.Sources, e.Source)
+		}
+		if severityRanks[e.Severity] > severityRanks[r.Severity] {
+			r.Severity = e.Severity
+		}
+	}
+	return matched
+}
+
+func appendUnique(values []string, v string) []string {
+	for _, e := range values {
+		if e == v {
+			return values
+		}
+	}
+	return append(values, v)
+}
+
+// LoadFile loads the entries of a file, whose format is determined by its extension:
+// .yml and .yaml files are loaded with LoadYAML, .json files with LoadJA3er.
+// Other files are loaded with LoadCSV if the first line is a header starting with the fingerprint column,
+// and with LoadSSLBL otherwise.
+func (db *Database) LoadFile(file string) error {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yml", ".yaml":
+		err = db.LoadYAML(f)
+	case ".json":
+		err = db.LoadJA3er(f)
+	default:
+		r := bufio.NewReader(f)
+		var line []byte
+		line, err = r.Peek(len("fingerprint"))
+		if err != nil && err != io.EOF {
+			return err
+		}
+		if bytes.EqualFold(line, []byte("fingerprint")) {
+			err = db.LoadCSV(r)
+		} else {
+			err = db.LoadSSLBL(r)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", file, err)
+	}
+	return nil
+}
+
+// LoadSSLBL loads the JA3 fingerprint blacklist of abuse.ch in CSV format,
+// see https://sslbl.abuse.ch/blacklist/ja3_fingerprints.csv
+// The listing reason is used as label.
+func (db *Database) LoadSSLBL(r io.Reader) error {
+
+	c := csv.NewReader(r)
+	c.Comment = '#'
+	c.FieldsPerRecord = -1
+
+	for n := 1; ; n++ {
+		record, err := c.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		// ja3_md5,Firstseen,Lastseen,Listingreason
+		if len(record) < 4 {
+			return fmt.Errorf("record %d: expected 4 fields, got %d", n, len(record))
+		}
+
+		err = db.Add(Entry{
+			Fingerprint: record[0],
+			Type:        TypeJA3,
+			Labels:      []string{strings.TrimSpace(record[3])},
+			Severity:    SeverityHigh,
+			Source:      SourceSSLBL,
+		})
+		if err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+}
+
+// ja3erEntry is an element of the JSON dumps of ja3er.com.
+type ja3erEntry struct {
+	MD5       string `json:"md5"`
+	UserAgent string `json:"User-Agent"`
+}
+
+// LoadJA3er loads a JSON array of JA3 digests in the format of the ja3er.com dumps,
+// optionally with the user agents that were seen with it, which are used as labels.
+func (db *Database) LoadJA3er(r io.Reader) error {
+
+	dec := json.NewDecoder(r)
+	if _, err := dec.Token(); err != nil {
+		return err
+	}
+
+	for dec.More() {
+		var e ja3erEntry
+		if err := dec.Decode(&e); err != nil {
+			return err
+		}
+
+		entry := Entry{
+			Fingerprint: e.MD5,
+			Type:        TypeJA3,
+			Severity:    SeverityInfo,
+			Source:      SourceJA3er,
+		}
+		if e.UserAgent != "" {
+			entry.Labels = []string{e.UserAgent}
+		}
+		if err := db.Add(entry); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+	return err
+}
+
+// LoadYAML loads a YAML list of entries:
+//
+//   - fingerprint: 4d7a28d6f2263ed61de88ca66eb011e3
+//     type: ja3
+//     labels: [scanner]
+//     severity: medium
+//     source: internal
+func (db *Database) LoadYAML(r io.Reader) error {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	var entries []Entry
+	if err := yaml.UnmarshalStrict(data, &entries); err != nil {
+		return err
+	}
+
+	for i, e := range entries {
+		if err := db.Add(e); err != nil {
+			return fmt.Errorf("entry %d: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// LoadCSV loads a list of entries in CSV format.
+// The first line must be a header naming the columns, which are
+// fingerprint, type, labels, severity and source. Only the fingerprint column is required,
+// multiple labels are separated by a semicolon. Lines starting with # are ignored.
+func (db *Database) LoadCSV(r io.Reader) error {
+
+	c := csv.NewReader(r)
+	c.Comment = '#'
+	c.TrimLeadingSpace = true
+
+	header, err := c.Read()
+	if err != nil {
+		return err
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["fingerprint"]; !ok {
+		return errors.New("missing fingerprint column")
+	}
+
+	for n := 1; ; n++ {
+		record, err := c.Read()
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		column := func(name string) string {
+			if i, ok := columns[name]; ok {
+				return strings.TrimSpace(record[i])
+			}
+			return ""
+		}
+
+		e := Entry{
+			Fingerprint: column("fingerprint"),
+			Type:        column("type"),
+			Severity:    column("severity"),
+			Source:      column("source"),
+		}
+		for _, l := range strings.Split(column("labels"), ";") {
+			if l = strings.TrimSpace(l); l != "" {
+				e.Labels = append(e.Labels, l)
+			}
+		}
+
+		if err := db.Add(e); err != nil {
+			return fmt.Errorf("record %d: %w", n, err)
+		}
+	}
+}
@@ -0,0 +1,199 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	testSSLBL = `################################################################
+# abuse.ch SSLBL JA3 Fingerprint Blacklist (CSV)               #
+################################################################
+#
+# ja3_md5,Firstseen,Lastseen,Listingreason
+b386946a5a44d1ddcc843bc75336dfce,2017-07-14 18:08:22,2019-07-27 20:42:54,Dridex
+4d7a28d6f2263ed61de88ca66eb011e3,2017-07-14 18:08:29,2019-07-27 20:42:54,Tofsee
+`
+	testJA3er = `[
+	{"User-Agent": "curl/7.64.1", "md5": "4D7A28D6F2263ED61DE88CA66EB011E3", "Count": 3, "Last_seen": "2020-03-01 10:00:00"},
+	{"md5": "e7d705a3286e19ea42f587b344ee6865", "Count": 1, "Last_seen": "2020-03-01 10:00:00"}
+]`
+	testYAML = `- fingerprint: 5b94af9bf6efc9dea416841602004fbb
+  type: ja3s
+  labels: [krxd, beacon]
+  severity: low
+  source: internal
+- fingerprint: 4d7a28d6f2263ed61de88ca66eb011e3
+  type: ja3s
+  labels: [never matches]
+`
+	testCSV = `fingerprint,labels,severity,source
+# comment
+t12d210500_b973bfd88a0e_677eed04e9fb,old client;tls 1.2,critical,internal
+`
+)
+
+/*
+ *	Tests
+ */
+
+func TestDatabaseLoad(t *testing.T) {
+
+	db := NewDatabase()
+	for _, load := range []struct {
+		fn   func(r *strings.Reader) error
+		data string
+	}{
+		{func(r *strings.Reader) error { return db.LoadSSLBL(r) }, testSSLBL},
+		{func(r *strings.Reader) error { return db.LoadJA3er(r) }, testJA3er},
+		{func(r *strings.Reader) error { return db.LoadYAML(r) }, testYAML},
+		{func(r *strings.Reader) error { return db.LoadCSV(r) }, testCSV},
+	} {
+		if err := load.fn(strings.NewReader(load.data)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if db.Len() != 5 {
+		t.Fatal("expected 5 fingerprints, got", db.Len())
+	}
+	if entries := db.Lookup("4d7a28d6f2263ed61de88ca66eb011e3"); len(entries) != 3 {
+		t.Fatal("expected 3 entries, got", len(entries))
+	}
+
+	r := &Record{
+		JA3Digest:  "4d7a28d6f2263ed61de88ca66eb011e3",
+		JA3SDigest: "5b94af9bf6efc9dea416841602004fbb",
+		JA4:        "t12d210500_b973bfd88a0e_677eed04e9fb",
+	}
+	if !db.Annotate(r) {
+		t.Fatal("expected a match")
+	}
+
+	if !reflect.DeepEqual(r.Labels, []string{"Tofsee", "curl/7.64.1", "krxd", "beacon", "old client", "tls 1.2"}) {
+		t.Fatal("unexpected labels", r.Labels)
+	}
+	if !reflect.DeepEqual(r.Sources, []string{SourceSSLBL, SourceJA3er, "internal"}) {
+		t.Fatal("unexpected sources", r.Sources)
+	}
+	if r.Severity != SeverityCritical {
+		t.Fatal("unexpected severity", r.Severity)
+	}
+
+	if db.Annotate(&Record{JA3Digest: "5b94af9bf6efc9dea416841602004fbb"}) {
+		t.Fatal("entry restricted to ja3s matched a ja3 digest")
+	}
+}
+
+func TestDatabaseLoadErrors(t *testing.T) {
+
+	tests := []struct {
+		name string
+		err  error
+	}{
+		{"invalid severity", NewDatabase().LoadCSV(strings.NewReader("fingerprint,severity\nabc,urgent\n"))},
+		{"invalid type", NewDatabase().LoadYAML(strings.NewReader("- fingerprint: abc\n  type: ja5\n"))},
+		{"unknown field", NewDatabase().LoadYAML(strings.NewReader("- fingerprint: abc\n  label: x\n"))},
+		{"missing column", NewDatabase().LoadCSV(strings.NewReader("labels,severity\nx,low\n"))},
+		{"short sslbl record", NewDatabase().LoadSSLBL(strings.NewReader("abc,2017-07-14 18:08:22\n"))},
+		{"no json array", NewDatabase().LoadJA3er(strings.NewReader("{\"md5\": 1}"))},
+	}
+	for _, test := range tests {
+		if test.err == nil {
+			t.Fatal(test.name, "expected an error")
+		}
+	}
+}
+
+func TestLoadDatabaseFiles(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "ja3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var files []string
+	for name, data := range map[string]string{
+		"sslbl.csv":  testSSLBL,
+		"ja3er.json": testJA3er,
+		"own.yml":    testYAML,
+		"own.csv":    testCSV,
+	} {
+		file := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(file, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, file)
+	}
+
+	db, err := LoadDatabase(files...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 5 {
+		t.Fatal("expected 5 fingerprints, got", db.Len())
+	}
+}
+
+func TestReadFileJSONWithDatabase(t *testing.T) {
+
+	db := NewDatabase()
+	err := db.Add(Entry{
+		Fingerprint: "cd5a8d2e276eabf0839bf1a25acc479e",
+		Type:        TypeJA3S,
+		Labels:      []string{"test"},
+		Severity:    SeverityLow,
+		Source:      "internal",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		b       bytes.Buffer
+		records []*Record
+	)
+
+	ReadFileJSON("test2.pcap", &b, true, WithDatabase(db))
+
+	err = json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var matched int
+	for _, r := range records {
+		if r.JA3SDigest == "cd5a8d2e276eabf0839bf1a25acc479e" {
+			matched++
+			if r.Severity != SeverityLow || len(r.Labels) != 1 || len(r.Sources) != 1 {
+				t.Fatal("record not annotated", r.Severity, r.Labels, r.Sources)
+			}
+		} else if r.Severity != "" || r.Labels != nil {
+			t.Fatal("unexpected annotation", r.JA3Digest, r.JA3SDigest, r.Labels)
+		}
+	}
+	if matched == 0 {
+		t.Fatal("expected annotated records")
+	}
+}
@@ -0,0 +1,205 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	// deadEndLayers cannot be followed by a TCP or UDP layer,
+	// packets that stop at one of them are not decoded again with gopacket.NewPacket.
+	deadEndLayers = map[gopacket.LayerType]bool{
+		gopacket.LayerTypeFragment: true,
+		layers.LayerTypeICMPv4:     true,
+		layers.LayerTypeICMPv6:     true,
+		layers.LayerTypeARP:        true,
+		layers.LayerTypeIGMP:       true,
+	}
+
+	// tunnelLayers may follow a UDP layer and carry another TCP or UDP layer.
+	tunnelLayers = map[gopacket.LayerType]bool{
+		layers.LayerTypeVXLAN:  true,
+		layers.LayerTypeGeneve: true,
+		layers.LayerTypeGTPv1U: true,
+	}
+)
+
+// PacketDecoder decodes the link, network and transport layers of packets with a gopacket.DecodingLayerParser,
+// which reuses its layers instead of allocating them for every packet like gopacket.NewPacket does.
+// Ethernet, 802.1Q, Loopback, Linux SLL and SLL2, IPv4, IPv6, TCP and UDP are decoded this way,
+// packets with other layers on the way to the transport layer, e.g. tunnels or IPv6 extension headers,
+// are passed on to gopacket.NewPacket, so that the results do not differ.
+//
+// The decoded layers are only valid until the next call.
+// A PacketDecoder must not be used concurrently, use one per goroutine instead.
+type PacketDecoder struct {
+	link    gopacket.Decoder
+	parser  *gopacket.DecodingLayerParser
+	parser6 *gopacket.DecodingLayerParser // IPv6 packets of raw IP and Linux SLL2 links
+	sll2    bool
+	decoded []gopacket.LayerType
+	fp      *Fingerprinter
+
+	eth      layers.Ethernet
+	dot1q    layers.Dot1Q
+	loopback layers.Loopback
+	sll      layers.LinuxSLL
+	ip4      layers.IPv4
+	ip6      layers.IPv6
+	tcp      layers.TCP
+	udp      layers.UDP
+	payload  gopacket.Payload
+}
+
+// NewPacketDecoder returns a PacketDecoder for packets of the given link type.
+// Packets of link types it has no parser for are always decoded with gopacket.NewPacket.
+func NewPacketDecoder(link layers.LinkType) *PacketDecoder {
+
+	d := &PacketDecoder{
+		link:    linkDecoder(link),
+		decoded: make([]gopacket.LayerType, 0, 8),
+		fp:      NewFingerprinter(),
+	}
+	decoders := []gopacket.DecodingLayer{&d.eth, &d.dot1q, &d.loopback, &d.sll, &d.ip4, &d.ip6, &d.tcp, &d.udp, &d.payload}
+
+	switch link {
+	case layers.LinkTypeEthernet:
+		d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeEthernet, decoders...)
+	case layers.LinkTypeNull, layers.LinkTypeLoop:
+		d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeLoopback, decoders...)
+	case layers.LinkTypeLinuxSLL:
+		d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeLinuxSLL, decoders...)
+	case layers.LinkTypeRaw, layers.LinkTypeIPv4, layers.LinkTypeIPv6, LinkTypeLinuxSLL2:
+		d.parser = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv4, decoders...)
+		d.parser6 = gopacket.NewDecodingLayerParser(layers.LayerTypeIPv6, decoders...)
+		d.sll2 = link == LinkTypeLinuxSLL2
+	}
+	return d
+}
+
+// Decode returns the first network layer and the first TCP or UDP layer of the packet in data,
+// either of which is nil if the packet does not have one.
+func (d *PacketDecoder) Decode(data []byte) (gopacket.NetworkLayer, gopacket.TransportLayer) {
+
+	var (
+		parser = d.parser
+		packet = data
+	)
+	if d.sll2 {
+		parser, packet = d.parseSLL2(data)
+	} else if d.parser6 != nil && len(data) > 0 && data[0]>>4 == 6 {
+		parser = d.parser6
+	}
+	if parser == nil {
+		return d.decodePacket(data)
+	}
+
+	var (
+		err = parser.DecodeLayers(packet, &d.decoded)
+		nl  gopacket.NetworkLayer
+		tl  gopacket.TransportLayer
+	)
+	for i, typ := range d.decoded {
+		for _, previous := range d.decoded[:i] {
+			if typ == previous {
+				// a tunnel overwrote the outer layer
+				return d.decodePacket(data)
+			}
+		}
+		switch typ {
+		case layers.LayerTypeIPv4:
+			if nl == nil {
+				nl = &d.ip4
+			}
+		case layers.LayerTypeIPv6:
+			if nl == nil {
+				nl = &d.ip6
+			}
+		case layers.LayerTypeTCP:
+			tl = &d.tcp
+		case layers.LayerTypeUDP:
+			tl = &d.udp
+		}
+	}
+
+	if typ, ok := err.(gopacket.UnsupportedLayerType); ok {
+		switch {
+		case tl == nil && !deadEndLayers[gopacket.LayerType(typ)],
+			tl == &d.udp && tunnelLayers[gopacket.LayerType(typ)]:
+			return d.decodePacket(data)
+		}
+	}
+	return nl, tl
+}
+
+// parseSLL2 returns the parser for the packet following the Linux SLL2 header in data and the packet,
+// or a nil parser if it is neither IPv4 nor IPv6.
+func (d *PacketDecoder) parseSLL2(data []byte) (*gopacket.DecodingLayerParser, []byte) {
+	if len(data) < sll2HeaderLen {
+		return nil, nil
+	}
+	switch layers.EthernetType(binary.BigEndian.Uint16(data)) {
+	case layers.EthernetTypeIPv4:
+		return d.parser, data[sll2HeaderLen:]
+	case layers.EthernetTypeIPv6:
+		return d.parser6, data[sll2HeaderLen:]
+	}
+	return nil, nil
+}
+
+// decodePacket decodes data with gopacket.NewPacket and returns the layers the assembler uses.
+func (d *PacketDecoder) decodePacket(data []byte) (gopacket.NetworkLayer, gopacket.TransportLayer) {
+	p := gopacket.NewPacket(data, d.link, gopacket.Lazy)
+	if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		return p.NetworkLayer(), tcp
+	}
+	if udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		return p.NetworkLayer(), udp
+	}
+	return p.NetworkLayer(), nil
+}
+
+// Bare returns the Ja3 bare string for the packet in data like BarePacket,
+// but for the TCP segment of tunnelled packets, like the readers use.
+func (d *PacketDecoder) Bare(data []byte) []byte {
+	_, tl := d.Decode(data)
+	return bareTransport(tl)
+}
+
+// BareJa3s returns the Ja3s bare string for the packet in data like BarePacketJa3s,
+// but for the TCP segment of tunnelled packets, like the readers use.
+func (d *PacketDecoder) BareJa3s(data []byte) []byte {
+	_, tl := d.Decode(data)
+	return bareJa3sTransport(tl)
+}
+
+// AppendBare appends the Ja3 bare string for the packet in data to dst.
+// TLS client hellos in a TCP segment are fingerprinted without allocating,
+// all other packets are handled like by Bare.
+func (d *PacketDecoder) AppendBare(dst, data []byte) []byte {
+	_, tl := d.Decode(data)
+	if tcp, ok := tl.(*layers.TCP); ok && !tcp.SYN && !tcp.FIN && !tcp.RST && len(tcp.LayerPayload()) > 0 {
+		if out, err := d.fp.AppendBare(dst, tcp.LayerPayload()); err == nil {
+			return out
+		}
+	}
+	return append(dst, bareTransport(tl)...)
+}
@@ -0,0 +1,210 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// serializePacket serializes the layers, fixing lengths and checksums.
+func serializePacket(t *testing.T, l ...gopacket.SerializableLayer) []byte {
+	for _, layer := range l {
+		switch tl := layer.(type) {
+		case *layers.TCP:
+			tl.SetNetworkLayerForChecksum(networkLayer(l))
+		case *layers.UDP:
+			tl.SetNetworkLayerForChecksum(networkLayer(l))
+		}
+	}
+	buf := gopacket.NewSerializeBuffer()
+	if err := gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, l...); err != nil {
+		t.Fatal(err)
+	}
+	return append([]byte{}, buf.Bytes()...)
+}
+
+// networkLayer returns the last network layer, which transport checksums are computed with.
+func networkLayer(l []gopacket.SerializableLayer) gopacket.NetworkLayer {
+	var nl gopacket.NetworkLayer
+	for _, layer := range l {
+		if n, ok := layer.(gopacket.NetworkLayer); ok {
+			nl = n
+		}
+	}
+	return nl
+}
+
+/*
+ *	Tests
+ */
+
+func TestPacketDecoder(t *testing.T) {
+
+	var (
+		eth = func(typ layers.EthernetType) *layers.Ethernet {
+			return &layers.Ethernet{
+				SrcMAC:       net.HardwareAddr{0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a},
+				DstMAC:       net.HardwareAddr{0x68, 0x7f, 0x74, 0xd6, 0x95, 0xc1},
+				EthernetType: typ,
+			}
+		}
+		ip4 = func(protocol layers.IPProtocol, last byte) *layers.IPv4 {
+			return &layers.IPv4{Version: 4, TTL: 64, Protocol: protocol, SrcIP: net.IP{10, 0, 0, last}, DstIP: net.IP{10, 0, 1, last}}
+		}
+		ip6 = &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolUDP, SrcIP: net.ParseIP("2001:db8::1"), DstIP: net.ParseIP("2001:db8::2")}
+		tcp = func() *layers.TCP {
+			return &layers.TCP{SrcPort: 49391, DstPort: 443, Seq: 1001, ACK: true, PSH: true, Window: 256}
+		}
+		udp  = &layers.UDP{SrcPort: 49391, DstPort: 443}
+		sll  = []byte{0, 0, 0, 1, 0, 6, 0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a, 0, 0, 0x08, 0x00}
+		sll2 = func(protocol layers.EthernetType) []byte {
+			return []byte{byte(protocol >> 8), byte(protocol), 0, 0, 0, 0, 0, 2, 0, 1, 0, 6, 0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a, 0, 0}
+		}
+		tls   = gopacket.Payload(clientHelloPayload())
+		arp   = &layers.ARP{AddrType: layers.LinkTypeEthernet, Protocol: layers.EthernetTypeIPv4, HwAddressSize: 6, ProtAddressSize: 4, Operation: 1, SourceHwAddress: make([]byte, 6), SourceProtAddress: make([]byte, 4), DstHwAddress: make([]byte, 6), DstProtAddress: make([]byte, 4)}
+		vxlan = &layers.VXLAN{ValidIDFlag: true, VNI: 42}
+	)
+
+	tests := []struct {
+		name    string
+		link    layers.LinkType
+		data    []byte
+		hello   bool
+		noLayer bool
+	}{
+		{"ethernet", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeIPv4), ip4(layers.IPProtocolTCP, 1), tcp(), tls), true, false},
+		{"dot1q", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeDot1Q), &layers.Dot1Q{VLANIdentifier: 7, Type: layers.EthernetTypeIPv6}, ip6, udp, gopacket.Payload("data")), false, false},
+		{"loopback", layers.LinkTypeNull, serializePacket(t, &layers.Loopback{Family: layers.ProtocolFamilyIPv4}, ip4(layers.IPProtocolTCP, 2), tcp(), tls), true, false},
+		{"raw ipv6", layers.LinkTypeRaw, serializePacket(t, ip6, udp, gopacket.Payload("data")), false, false},
+		{"sll", layers.LinkTypeLinuxSLL, append(append([]byte{}, sll...), serializePacket(t, ip4(layers.IPProtocolTCP, 3), tcp(), tls)...), true, false},
+		{"sll2", LinkTypeLinuxSLL2, append(sll2(layers.EthernetTypeIPv4), serializePacket(t, ip4(layers.IPProtocolTCP, 9), tcp(), tls)...), true, false},
+		{"sll2 ipv6", LinkTypeLinuxSLL2, append(sll2(layers.EthernetTypeIPv6), serializePacket(t, ip6, udp, gopacket.Payload("data"))...), false, false},
+		{"ipip", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeIPv4), ip4(layers.IPProtocolIPv4, 4), ip4(layers.IPProtocolTCP, 5), tcp(), tls), true, false},
+		{"vxlan", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeIPv4), ip4(layers.IPProtocolUDP, 6), &layers.UDP{SrcPort: 50000, DstPort: 4789}, vxlan, eth(layers.EthernetTypeIPv4), ip4(layers.IPProtocolTCP, 7), tcp(), tls), true, false},
+		{"arp", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeARP), arp), false, true},
+		{"truncated", layers.LinkTypeEthernet, serializePacket(t, eth(layers.EthernetTypeIPv4), ip4(layers.IPProtocolTCP, 8), tcp(), tls)[:40], false, true},
+	}
+
+	for _, test := range tests {
+		var (
+			d      = NewPacketDecoder(test.link)
+			p      = gopacket.NewPacket(test.data, linkDecoder(test.link), gopacket.Lazy)
+			nl, tl = d.Decode(test.data)
+		)
+
+		if test.noLayer {
+			if tl != nil {
+				t.Fatal(test.name, "unexpected transport layer", tl)
+			}
+			continue
+		}
+		expectedTL := p.TransportLayer()
+		if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+			expectedTL = tcp
+		}
+		if nl == nil || tl == nil || expectedTL == nil {
+			t.Fatal(test.name, "missing layers", nl, tl, expectedTL)
+		}
+		if nl.NetworkFlow() != p.NetworkLayer().NetworkFlow() || tl.TransportFlow() != expectedTL.TransportFlow() || tl.LayerType() != expectedTL.LayerType() {
+			t.Fatal(test.name, "unexpected layers", nl.NetworkFlow(), tl.TransportFlow(), "expected", p.NetworkLayer().NetworkFlow(), expectedTL.TransportFlow())
+		}
+		if !bytes.Equal(tl.LayerPayload(), expectedTL.LayerPayload()) {
+			t.Fatal(test.name, "unexpected payload")
+		}
+
+		if test.hello {
+			bare := bareTransport(expectedTL)
+			if len(bare) == 0 || !bytes.Equal(d.Bare(test.data), bare) || !bytes.Equal(d.AppendBare(nil, test.data), bare) {
+				t.Fatal(test.name, "unexpected bare", string(d.Bare(test.data)), string(bare))
+			}
+		}
+	}
+
+	// fingerprinting client hellos in Ethernet frames does not allocate
+	var (
+		d   = NewPacketDecoder(layers.LinkTypeEthernet)
+		dst = make([]byte, 0, 512)
+	)
+	allocs := testing.AllocsPerRun(100, func() {
+		dst = d.AppendBare(dst[:0], tlsPacket)
+	})
+	if allocs != 0 || string(dst) != string(d.Bare(tlsPacket)) {
+		t.Fatal("unexpected result", allocs, string(dst))
+	}
+}
+
+/*
+ *	Benchmarks
+ */
+
+func BenchmarkNewPacketBare(b *testing.B) {
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		BarePacket(gopacket.NewPacket(tlsPacket, layers.LinkTypeEthernet, gopacket.Lazy))
+	}
+}
+
+func BenchmarkPacketDecoderBare(b *testing.B) {
+
+	d := NewPacketDecoder(layers.LinkTypeEthernet)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		d.Bare(tlsPacket)
+	}
+}
+
+func BenchmarkPacketDecoderAppendBare(b *testing.B) {
+
+	var (
+		d   = NewPacketDecoder(layers.LinkTypeEthernet)
+		dst = make([]byte, 0, 512)
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		dst = d.AppendBare(dst[:0], tlsPacket)
+	}
+}
+
+func BenchmarkNewPacketDecode(b *testing.B) {
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		p := gopacket.NewPacket(tlsPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+		_, _ = p.NetworkLayer(), p.Layer(layers.LayerTypeTCP)
+	}
+}
+
+func BenchmarkPacketDecoderDecode(b *testing.B) {
+
+	d := NewPacketDecoder(layers.LinkTypeEthernet)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		d.Decode(tlsPacket)
+	}
+}
@@ -0,0 +1,223 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+	"time"
+
+	"github.com/dreadl0ck/tlsx"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// content type, version, epoch, sequence number and length
+	dtlsRecordHeaderLength = 13
+
+	// type, length, message sequence, fragment offset and fragment length
+	dtlsHandshakeHeaderLength = 12
+
+	// DTLS versions count downwards from 0xfeff (DTLS 1.0), all share the major version.
+	dtlsMajorVersion = 0xfe
+)
+
+// isDTLSRecord checks whether data starts with a DTLS handshake record header.
+func isDTLSRecord(data []byte) bool {
+	return len(data) >= dtlsRecordHeaderLength && data[0] == recordTypeHandshake && data[1] == dtlsMajorVersion
+}
+
+// dtlsFragment is a fragment of a handshake message from an unencrypted DTLS record.
+type dtlsFragment struct {
+	recordVersion uint16
+	typ           byte
+
+	// length of the complete message
+	length int
+
+	// message sequence number and offset of the fragment within the message
+	seq    uint16
+	offset int
+	data   []byte
+}
+
+// walkDTLSFragments invokes fn for each handshake fragment in the unencrypted records of the datagram.
+// DTLS 1.3 uses the same record format for client and server hellos, later messages are encrypted.
+func walkDTLSFragments(datagram []byte, fn func(f *dtlsFragment)) {
+
+	s := cursor(datagram)
+	for len(s) >= dtlsRecordHeaderLength {
+		var (
+			typ     = s[0]
+			version = binary.BigEndian.Uint16(s[1:3])
+			epoch   = binary.BigEndian.Uint16(s[3:5])
+		)
+		s.skip(11)
+		body, ok := s.vector(2)
+		if !ok {
+			return
+		}
+		if typ != recordTypeHandshake || epoch != 0 || version>>8 != dtlsMajorVersion {
+			continue
+		}
+
+		for len(body) >= dtlsHandshakeHeaderLength {
+			f := &dtlsFragment{
+				recordVersion: version,
+				typ:           body[0],
+				length:        int(body[1])<<16 | int(body[2])<<8 | int(body[3]),
+				seq:           binary.BigEndian.Uint16(body[4:6]),
+				offset:        int(body[6])<<16 | int(body[7])<<8 | int(body[8]),
+			}
+			body.skip(9)
+			if f.data, ok = body.vector(3); !ok || f.offset+len(f.data) > f.length {
+				break
+			}
+			fn(f)
+		}
+	}
+}
+
+// dtlsMessage reassembles the fragments of a DTLS handshake message.
+type dtlsMessage struct {
+	started bool
+	seq     uint16
+	length  int
+	version uint16
+	body    halfStream
+}
+
+// add adds a fragment and returns the complete message converted to the TLS format,
+// once all of its fragments have been seen.
+// A fragment of a message with a higher sequence number, like a client hello repeated with a cookie, starts over.
+func (m *dtlsMessage) add(f *dtlsFragment) []byte {
+
+	if f.length > maxStreamBuffer || (m.started && f.seq < m.seq) {
+		return nil
+	}
+	if !m.started || f.seq != m.seq || f.length != m.length {
+		*m = dtlsMessage{
+			started: true,
+			seq:     f.seq,
+			length:  f.length,
+			version: f.recordVersion,
+			body:    halfStream{seqKnown: true},
+		}
+	}
+
+	m.body.reassemble(uint32(f.offset), f.data)
+	if len(m.body.buf) < m.length {
+		return nil
+	}
+	return dtlsToTLSHandshake(f.typ, m.body.buf[:m.length])
+}
+
+// dtlsToTLSHandshake converts the body of a DTLS client or server hello into a TLS handshake message,
+// which differs only by the cookie of client hellos and the fragmentation fields of the header.
+func dtlsToTLSHandshake(typ byte, body []byte) []byte {
+
+	if typ == handshakeTypeClientHello {
+		// version (2) + random (32), session ID
+		s := cursor(body)
+		if !s.skip(34) || !s.skipVector(1) {
+			return nil
+		}
+		n := len(body) - len(s)
+		if !s.skipVector(1) {
+			return nil
+		}
+		body = append(body[:n:n], s...)
+	}
+
+	msg := make([]byte, 4, 4+len(body))
+	msg[0] = typ
+	msg[1], msg[2], msg[3] = byte(len(body)>>16), byte(len(body)>>8), byte(len(body))
+	return append(msg, body...)
+}
+
+// dtlsHello returns the first client or server hello in the datagram wrapped into a TLS record,
+// if all of its fragments are contained in the datagram.
+func dtlsHello(datagram []byte, typ byte) []byte {
+
+	var (
+		m   dtlsMessage
+		msg []byte
+	)
+	walkDTLSFragments(datagram, func(f *dtlsFragment) {
+		if msg == nil && f.typ == typ {
+			msg = m.add(f)
+		}
+	})
+	if msg == nil {
+		return nil
+	}
+	return handshakeRecord(m.version, msg)
+}
+
+// BareDTLS returns the JA3 bare string of the client hello in a UDP payload carrying DTLS records,
+// or an empty byte slice. Fragmented client hellos must be contained in the same payload.
+// The versions of DTLS are kept as they are, e.g. 65277 for DTLS 1.2.
+func BareDTLS(payload []byte) []byte {
+	var hello tlsx.ClientHelloBasic
+	if record := dtlsHello(payload, handshakeTypeClientHello); record != nil && hello.Unmarshal(record) == nil {
+		return Bare(&hello)
+	}
+	return []byte{}
+}
+
+// BareDTLSJa3s returns the JA3S bare string of the server hello in a UDP payload carrying DTLS records,
+// or an empty byte slice.
+func BareDTLSJa3s(payload []byte) []byte {
+	var hello tlsx.ServerHelloBasic
+	if record := dtlsHello(payload, handshakeTypeServerHello); record != nil && hello.Unmarshal(record) == nil {
+		return BareJa3s(&hello)
+	}
+	return []byte{}
+}
+
+// assembleDTLS reassembles the client and server hello of a DTLS connection from the handshake records of a datagram.
+func (a *assembler) assembleDTLS(network gopacket.Flow, udp *layers.UDP, ts time.Time) {
+
+	var (
+		transport = udp.TransportFlow()
+		key       = newFlowKey(network, transport)
+		f         = a.flows[key]
+	)
+
+	walkDTLSFragments(udp.LayerPayload(), func(frag *dtlsFragment) {
+		if frag.typ != handshakeTypeClientHello && frag.typ != handshakeTypeServerHello {
+			return
+		}
+		if f == nil {
+			f = &flow{protocol: JA4ProtocolDTLS}
+			a.flows[key] = f
+		}
+		f.lastSeen, f.packet = ts, a.packet
+
+		h := f.half(network, transport)
+		if h.done {
+			return
+		}
+		if h.dtls == nil {
+			h.dtls = &dtlsMessage{}
+		}
+		if msg := h.dtls.add(frag); msg != nil {
+			h.recordVersion = h.dtls.version
+			a.handleHandshake(f, h, msg, ts)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/dreadl0ck/tlsx"
+)
+
+// dtlsClientHelloBody converts the body of clientHelloMessage to DTLS 1.2, with the given cookie.
+func dtlsClientHelloBody(cookie []byte) []byte {
+
+	var (
+		tls = clientHelloMessage()[4:]
+		// version (2) + random (32), session ID
+		n    = 34 + 1 + int(tls[34])
+		body = []byte{0xfe, 0xfd}
+	)
+	body = append(body, tls[2:n]...)
+	body = append(body, byte(len(cookie)))
+	body = append(body, cookie...)
+	return append(body, tls[n:]...)
+}
+
+// dtlsServerHelloBody converts the body of serverHelloMessage to DTLS 1.2.
+func dtlsServerHelloBody(t testing.TB) []byte {
+	return append([]byte{0xfe, 0xfd}, serverHelloMessage(t)[6:]...)
+}
+
+// dtlsHandshake encodes the fragment of a handshake message body starting at offset with n bytes.
+func dtlsHandshake(typ byte, seq uint16, body []byte, offset, n int) []byte {
+	return append([]byte{
+		typ,
+		byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body)),
+		byte(seq >> 8), byte(seq),
+		byte(offset >> 16), byte(offset >> 8), byte(offset),
+		byte(n >> 16), byte(n >> 8), byte(n),
+	}, body[offset:offset+n]...)
+}
+
+// dtlsRecord wraps the handshake fragments into a record of epoch zero.
+func dtlsRecord(fragments ...[]byte) []byte {
+	var data []byte
+	for _, f := range fragments {
+		data = append(data, f...)
+	}
+	record := []byte{recordTypeHandshake, 0xfe, 0xfd, 0, 0, 0, 0, 0, 0, 0, 0, byte(len(data) >> 8), byte(len(data))}
+	return append(record, data...)
+}
+
+// dtlsBare returns the expected JA3 bare string for the DTLS version of the test client hello.
+func dtlsBare(t *testing.T) string {
+	var hello tlsx.ClientHelloBasic
+	if err := hello.Unmarshal(clientHelloPayload()); err != nil {
+		t.Fatal(err)
+	}
+	return "65277" + strings.TrimPrefix(string(Bare(&hello)), "771")
+}
+
+/*
+ *	Tests
+ */
+
+func TestDTLSHandshake(t *testing.T) {
+
+	var (
+		first  = dtlsClientHelloBody(nil)
+		second = dtlsClientHelloBody([]byte{0x01, 0x02, 0x03, 0x04})
+		server = dtlsServerHelloBody(t)
+
+		// hello verify request with the cookie
+		verify = dtlsHandshake(3, 0, []byte{0xfe, 0xff, 0x04, 0x01, 0x02, 0x03, 0x04}, 0, 7)
+	)
+
+	records := collectRecordsWith(t, []Option{WithJA4()},
+		// first client hello, fragmented into two records in separate datagrams that arrive out of order
+		udpPacket(t, false, dtlsRecord(dtlsHandshake(1, 0, first, 100, len(first)-100))),
+		udpPacket(t, false, dtlsRecord(dtlsHandshake(1, 0, first, 0, 100))),
+		udpPacket(t, true, dtlsRecord(verify)),
+		// client hello with cookie and server hello, which must not be fingerprinted again
+		udpPacket(t, false, dtlsRecord(dtlsHandshake(1, 1, second, 0, len(second)))),
+		udpPacket(t, true, dtlsRecord(dtlsHandshake(2, 1, server, 0, len(server)))),
+	)
+	if len(records) != 2 {
+		t.Fatal("expected 2 records, got", len(records))
+	}
+
+	c, s := records[0], records[1]
+	if c.JA3 != dtlsBare(t) || c.Transport != TransportDTLS || c.SourcePort != 49391 {
+		t.Fatal("unexpected client record", c.JA3, c.Transport, c.SourcePort)
+	}
+	if !strings.HasPrefix(c.JA4, "dd2d210500_") || c.SNI != "beacon.krxd.net" {
+		t.Fatal("unexpected ja4", c.JA4, c.SNI)
+	}
+	if !strings.HasPrefix(s.JA3S, "65277,") || s.SourcePort != 443 || s.JA4S[0] != JA4ProtocolDTLS {
+		t.Fatal("unexpected server record", s.JA3S, s.JA4S, s.SourcePort)
+	}
+}
+
+func TestBarePacketDTLS(t *testing.T) {
+
+	var (
+		body   = dtlsClientHelloBody([]byte{0x01, 0x02})
+		server = dtlsServerHelloBody(t)
+
+		// fragments in separate records of the same datagram
+		p = udpPacket(t, false, append(
+			dtlsRecord(dtlsHandshake(1, 0, body, 0, 50)),
+			dtlsRecord(dtlsHandshake(1, 0, body, 50, len(body)-50))...,
+		))
+	)
+
+	if bare := string(BarePacket(p)); bare != dtlsBare(t) {
+		t.Fatal("unexpected bare", bare)
+	}
+	if ja4 := JA4Packet(p); !strings.HasPrefix(ja4, "dd2d210500_") {
+		t.Fatal("unexpected ja4", ja4)
+	}
+
+	p = udpPacket(t, true, dtlsRecord(dtlsHandshake(2, 0, server, 0, len(server))))
+	if bare := string(BarePacketJa3s(p)); !strings.HasPrefix(bare, "65277,") {
+		t.Fatal("unexpected bare", bare)
+	}
+
+	// missing fragment
+	p = udpPacket(t, false, dtlsRecord(dtlsHandshake(1, 0, body, 0, 50)))
+	if bare := BarePacket(p); len(bare) != 0 {
+		t.Fatal("unexpected bare", string(bare))
+	}
+}
@@ -0,0 +1,591 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"io/ioutil"
+
+	"github.com/dreadl0ck/tlsx"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Extensions of Encrypted Client Hello, see draft-ietf-tls-esni.
+const (
+	extensionECH                = 0xfe0d
+	extensionECHOuterExtensions = 0xfd00
+
+	echVersion     = 0xfe0d
+	echClientOuter = 0
+)
+
+// Types of the use of ECH reported in records.
+const (
+	// ECHReal is reported if the inner client hello has been decrypted, or if the public name and the config ID
+	// match a key of the server, which does not decrypt the extension, e.g. after a key rotation.
+	ECHReal = "real"
+
+	// ECHGrease is reported if keys of the public name are known, but none of them has the config ID.
+	// Clients without an ECH configuration send such an extension with random values.
+	ECHGrease = "grease"
+
+	// ECHUnknown is reported if no key of the public name is known.
+	ECHUnknown = "unknown"
+)
+
+// HPKE algorithms supported for ECH, see RFC 9180.
+const (
+	hpkeKEMX25519        = 0x0020
+	hpkeKDFSHA256        = 0x0001
+	hpkeKDFSHA384        = 0x0002
+	hpkeKDFSHA512        = 0x0003
+	hpkeAES128GCM        = 0x0001
+	hpkeAES256GCM        = 0x0002
+	hpkeChaCha20Poly1305 = 0x0003
+)
+
+var (
+	// ErrNoECH is returned if a client hello does not carry an outer encrypted_client_hello extension.
+	ErrNoECH = errors.New("client hello without encrypted_client_hello extension")
+
+	// ErrECHDecryption is returned if none of the keys decrypts the inner client hello.
+	ErrECHDecryption = errors.New("failed to decrypt the inner client hello")
+
+	// pkcs8X25519 is the DER prefix of a PKCS #8 encoded X25519 private key, followed by the 32 byte key.
+	pkcs8X25519 = []byte{0x30, 0x2e, 0x02, 0x01, 0x00, 0x30, 0x05, 0x06, 0x03, 0x2b, 0x65, 0x6e, 0x04, 0x22, 0x04, 0x20}
+)
+
+// ECH describes the encrypted_client_hello extension of a client hello,
+// along with the fingerprints of the inner client hello if it could be decrypted.
+type ECH struct {
+	Type           string `json:"type"`
+	ConfigID       uint8  `json:"config_id"`
+	PublicName     string `json:"public_name,omitempty"`
+	InnerSNI       string `json:"inner_sni,omitempty"`
+	InnerJA3       string `json:"inner_ja3,omitempty"`
+	InnerJA3Digest string `json:"inner_ja3_digest,omitempty"`
+	InnerJA4       string `json:"inner_ja4,omitempty"`
+}
+
+// ECHClientHello is the outer encrypted_client_hello extension of a client hello.
+type ECHClientHello struct {
+	KDF      uint16
+	AEAD     uint16
+	ConfigID uint8
+	Enc      []byte
+	Payload  []byte
+
+	// offset of the payload in the body of the client hello
+	payloadOffset int
+}
+
+// ParseECH decodes the outer encrypted_client_hello extension of a client hello message, including its 4 byte header.
+// ErrNoECH is returned if the client hello does not carry the extension.
+func ParseECH(msg []byte) (*ECHClientHello, error) {
+
+	body, err := clientHelloBody(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		s   = cursor(body)
+		ech *ECHClientHello
+	)
+	if !s.skip(34) || !s.skipVector(1) || !s.skipVector(2) || !s.skipVector(1) {
+		return nil, ErrBadLength
+	}
+	extensions, ok := s.vector(2)
+	if !ok {
+		return nil, ErrNoECH
+	}
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok {
+			return nil, ErrBadLength
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return nil, ErrBadLength
+		}
+		if typ != extensionECH {
+			continue
+		}
+
+		var e ECHClientHello
+		if kind, ok := data.uint8(); !ok || kind != echClientOuter {
+			return nil, ErrNoECH
+		}
+		e.KDF, _ = data.uint16()
+		e.AEAD, _ = data.uint16()
+		e.ConfigID, _ = data.uint8()
+		enc, ok := data.vector(2)
+		if !ok {
+			return nil, ErrBadLength
+		}
+		payload, ok := data.vector(2)
+		if !ok {
+			return nil, ErrBadLength
+		}
+		e.Enc, e.Payload = enc, payload
+		e.payloadOffset = len(body) - len(extensions) - len(data) - len(payload)
+		ech = &e
+	}
+	if ech == nil {
+		return nil, ErrNoECH
+	}
+	return ech, nil
+}
+
+// InspectECH describes the encrypted_client_hello extension of a client hello message, including its 4 byte header,
+// and fingerprints the inner client hello if one of the keys decrypts it. The keys may be nil.
+// It returns nil if the client hello does not use ECH.
+func InspectECH(msg []byte, keys *ECHKeys, protocol byte) *ECH {
+
+	ech, err := ParseECH(msg)
+	if err != nil {
+		return nil
+	}
+
+	e := &ECH{
+		Type:     ECHUnknown,
+		ConfigID: ech.ConfigID,
+	}
+	var ext ClientHelloExtensions
+	if err := ext.Unmarshal(handshakeRecord(tlsVersion12, msg)); err == nil {
+		e.PublicName = ext.ServerName
+	}
+	if keys == nil {
+		return e
+	}
+
+	inner, err := keys.DecryptECH(msg)
+	if err != nil {
+		// the outer SNI is the public name of the server's configurations, GREASE uses a random config ID
+		switch server, config := keys.match(e.PublicName, e.ConfigID); {
+		case config:
+			e.Type = ECHReal
+		case server:
+			e.Type = ECHGrease
+		}
+		return e
+	}
+	e.Type = ECHReal
+
+	var (
+		record = handshakeRecord(tlsVersion12, inner)
+		hello  tlsx.ClientHelloBasic
+	)
+	if err := hello.Unmarshal(record); err != nil {
+		return e
+	}
+	bare := Bare(&hello)
+	e.InnerJA3 = string(bare)
+	e.InnerJA3Digest = BareToDigestHex(bare)
+
+	var innerExt ClientHelloExtensions
+	if err := innerExt.Unmarshal(record); err == nil {
+		e.InnerSNI = innerExt.ServerName
+		e.InnerJA4 = JA4(&hello, &innerExt, protocol)
+	}
+	return e
+}
+
+// clientHelloBody returns the body of a client hello message, including its 4 byte header.
+func clientHelloBody(msg []byte) ([]byte, error) {
+	s := cursor(msg)
+	if typ, ok := s.uint8(); !ok || typ != handshakeTypeClientHello {
+		return nil, ErrNoHandshake
+	}
+	body, ok := s.vector(3)
+	if !ok {
+		return nil, ErrBadLength
+	}
+	return body, nil
+}
+
+// echKey is the private key of an ECH configuration of a server.
+type echKey struct {
+	configID   uint8
+	kem        uint16
+	publicName string
+	publicKey  []byte
+	privateKey []byte
+	suites     [][2]uint16
+
+	// the complete ECHConfig, which is part of the HPKE info
+	config []byte
+}
+
+// ECHKeys holds the private keys of ECH configurations, which decrypt the inner client hellos sent to a server.
+type ECHKeys struct {
+	keys []*echKey
+}
+
+// LoadECHKeys reads PEM files with an X25519 private key in PKCS #8 format ("PRIVATE KEY")
+// followed by the ECHConfigList it belongs to ("ECHCONFIG"), as used by OpenSSL and other ECH servers.
+func LoadECHKeys(files ...string) (*ECHKeys, error) {
+	k := &ECHKeys{}
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if err := k.Load(data); err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return k, nil
+}
+
+// Len returns the number of ECH configurations with a private key.
+func (k *ECHKeys) Len() int {
+	return len(k.keys)
+}
+
+// Load adds the private keys and ECH configurations of PEM encoded data.
+// Each ECHCONFIG block uses the last private key that precedes it.
+func (k *ECHKeys) Load(data []byte) error {
+	var privateKey []byte
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return nil
+		}
+		switch block.Type {
+		case "PRIVATE KEY":
+			if len(block.Bytes) != len(pkcs8X25519)+32 || !bytes.HasPrefix(block.Bytes, pkcs8X25519) {
+				return errors.New("ECH private key is not an X25519 key")
+			}
+			privateKey = block.Bytes[len(pkcs8X25519):]
+		case "ECHCONFIG":
+			if privateKey == nil {
+				return errors.New("ECH configuration without private key")
+			}
+			if err := k.Add(block.Bytes, privateKey); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// Add adds the ECH configurations of an ECHConfigList, including its length, with their X25519 private key.
+// Configurations of other versions or key encapsulation mechanisms are skipped.
+func (k *ECHKeys) Add(configList []byte, privateKey []byte) error {
+
+	s := cursor(configList)
+	list, ok := s.vector(2)
+	if !ok {
+		return ErrBadLength
+	}
+	for len(list) > 0 {
+		start := list
+		version, _ := list.uint16()
+		contents, ok := list.vector(2)
+		if !ok {
+			return ErrBadLength
+		}
+		if version != echVersion {
+			continue
+		}
+
+		key := &echKey{
+			privateKey: privateKey,
+			config:     start[:len(start)-len(list)],
+		}
+		key.configID, _ = contents.uint8()
+		key.kem, _ = contents.uint16()
+		publicKey, ok := contents.vector(2)
+		if !ok {
+			return ErrBadLength
+		}
+		key.publicKey = publicKey
+		suites, ok := contents.vector(2)
+		if !ok {
+			return ErrBadLength
+		}
+		for len(suites) >= 4 {
+			kdf, _ := suites.uint16()
+			aead, _ := suites.uint16()
+			key.suites = append(key.suites, [2]uint16{kdf, aead})
+		}
+		if !contents.skip(1) {
+			return ErrBadLength
+		}
+		name, ok := contents.vector(1)
+		if !ok {
+			return ErrBadLength
+		}
+		key.publicName = string(name)
+
+		if key.kem == hpkeKEMX25519 {
+			k.keys = append(k.keys, key)
+		}
+	}
+	return nil
+}
+
+// match checks whether a key for the public name is known, and whether one of them has the config ID.
+func (k *ECHKeys) match(name string, configID uint8) (server, config bool) {
+	for _, key := range k.keys {
+		if key.publicName == name {
+			server = true
+			config = config || key.configID == configID
+		}
+	}
+	return server, config
+}
+
+// DecryptECH decrypts the inner client hello of a client hello message, both including their 4 byte header.
+// The extensions the inner client hello shares with the outer one are restored.
+func (k *ECHKeys) DecryptECH(msg []byte) ([]byte, error) {
+
+	ech, err := ParseECH(msg)
+	if err != nil {
+		return nil, err
+	}
+	outer := msg[4:]
+
+	// the outer client hello with the payload set to zeros is the additional data
+	aad := append([]byte(nil), outer...)
+	for i := range ech.Payload {
+		aad[ech.payloadOffset+i] = 0
+	}
+
+	for _, key := range k.keys {
+		if key.configID != ech.ConfigID || !key.supports(ech.KDF, ech.AEAD) {
+			continue
+		}
+		aead, nonce, err := key.hpkeContext(ech.KDF, ech.AEAD, ech.Enc)
+		if err != nil {
+			continue
+		}
+		encoded, err := aead.Open(nil, nonce, ech.Payload, aad)
+		if err != nil {
+			continue
+		}
+		return decodeClientHelloInner(encoded, outer)
+	}
+	return nil, ErrECHDecryption
+}
+
+// supports checks whether the configuration offers the cipher suite.
+func (key *echKey) supports(kdf, aead uint16) bool {
+	for _, s := range key.suites {
+		if s[0] == kdf && s[1] == aead {
+			return true
+		}
+	}
+	return false
+}
+
+// hpkeContext sets up the HPKE receiver context in base mode for the encapsulated key of a client,
+// and returns the AEAD with the nonce of the first message, see RFC 9180 section 5.1.
+func (key *echKey) hpkeContext(kdf, aeadID uint16, enc []byte) (cipher.AEAD, []byte, error) {
+
+	dh, err := curve25519.X25519(key.privateKey, enc)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// DHKEM(X25519, HKDF-SHA256)
+	var (
+		kemSuite = []byte{'K', 'E', 'M', hpkeKEMX25519 >> 8, hpkeKEMX25519 & 0xff}
+		prk      = hpkeLabeledExtract(sha256.New, nil, kemSuite, "eae_prk", dh)
+		shared   = hpkeLabeledExpand(sha256.New, prk, kemSuite, "shared_secret", append(append([]byte(nil), enc...), key.publicKey...), 32)
+		info     = append([]byte("tls ech\x00"), key.config...)
+	)
+	return hpkeKeySchedule(kdf, aeadID, shared, info)
+}
+
+// hpkeKeySchedule derives the AEAD and the base nonce from the shared secret of DHKEM(X25519, HKDF-SHA256) in base mode.
+func hpkeKeySchedule(kdf, aeadID uint16, shared, info []byte) (cipher.AEAD, []byte, error) {
+
+	var newHash func() hash.Hash
+	switch kdf {
+	case hpkeKDFSHA256:
+		newHash = sha256.New
+	case hpkeKDFSHA384:
+		newHash = sha512.New384
+	case hpkeKDFSHA512:
+		newHash = sha512.New
+	default:
+		return nil, nil, fmt.Errorf("unsupported HPKE KDF %#04x", kdf)
+	}
+
+	keyLength := 16
+	if aeadID != hpkeAES128GCM {
+		keyLength = 32
+	}
+
+	var (
+		suite   = []byte{'H', 'P', 'K', 'E', hpkeKEMX25519 >> 8, hpkeKEMX25519 & 0xff, byte(kdf >> 8), byte(kdf), byte(aeadID >> 8), byte(aeadID)}
+		context = []byte{0} // mode base
+	)
+	context = append(context, hpkeLabeledExtract(newHash, nil, suite, "psk_id_hash", nil)...)
+	context = append(context, hpkeLabeledExtract(newHash, nil, suite, "info_hash", info)...)
+	secret := hpkeLabeledExtract(newHash, shared, suite, "secret", nil)
+	key := hpkeLabeledExpand(newHash, secret, suite, "key", context, keyLength)
+	nonce := hpkeLabeledExpand(newHash, secret, suite, "base_nonce", context, 12)
+
+	var (
+		aead cipher.AEAD
+		err  error
+	)
+	switch aeadID {
+	case hpkeAES128GCM, hpkeAES256GCM:
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	case hpkeChaCha20Poly1305:
+		aead, err = chacha20poly1305.New(key)
+	default:
+		err = fmt.Errorf("unsupported HPKE AEAD %#04x", aeadID)
+	}
+	return aead, nonce, err
+}
+
+// hpkeLabeledExtract implements LabeledExtract of RFC 9180.
+func hpkeLabeledExtract(newHash func() hash.Hash, salt, suite []byte, label string, ikm []byte) []byte {
+	labeled := append([]byte("HPKE-v1"), suite...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, ikm...)
+	return hkdf.Extract(newHash, labeled, salt)
+}
+
+// hpkeLabeledExpand implements LabeledExpand of RFC 9180.
+func hpkeLabeledExpand(newHash func() hash.Hash, prk, suite []byte, label string, info []byte, length int) []byte {
+	labeled := []byte{byte(length >> 8), byte(length)}
+	labeled = append(labeled, "HPKE-v1"...)
+	labeled = append(labeled, suite...)
+	labeled = append(labeled, label...)
+	labeled = append(labeled, info...)
+
+	out := make([]byte, length)
+	// cannot fail for the small lengths used here
+	hkdf.Expand(newHash, prk, labeled).Read(out)
+	return out
+}
+
+// decodeClientHelloInner restores the inner client hello message from its encoded form,
+// which lacks the session ID, may refer to extensions of the outer client hello body and is padded with zeros.
+func decodeClientHelloInner(encoded, outer []byte) ([]byte, error) {
+
+	var (
+		s   = cursor(encoded)
+		o   = cursor(outer)
+		out = make([]byte, 4, len(encoded)+len(outer))
+	)
+
+	// version (2) + random (32)
+	head, ok := s.bytes(34)
+	if !ok || !s.skipVector(1) {
+		return nil, ErrBadLength
+	}
+	out = append(out, head...)
+
+	// the session ID is copied from the outer client hello
+	if !o.skip(34) {
+		return nil, ErrBadLength
+	}
+	sessionID, ok := o.vector(1)
+	if !ok || !o.skipVector(2) || !o.skipVector(1) {
+		return nil, ErrBadLength
+	}
+	out = append(out, byte(len(sessionID)))
+	out = append(out, sessionID...)
+
+	start := len(encoded) - len(s)
+	if !s.skipVector(2) || !s.skipVector(1) {
+		return nil, ErrBadLength
+	}
+	out = append(out, encoded[start:len(encoded)-len(s)]...)
+
+	extensions, ok := s.vector(2)
+	if !ok {
+		return nil, ErrBadLength
+	}
+	outerExtensions, _ := o.vector(2)
+
+	var list []byte
+	for len(extensions) > 0 {
+		ext := extensions
+		typ, ok := extensions.uint16()
+		if !ok {
+			return nil, ErrBadLength
+		}
+		data, ok := extensions.vector(2)
+		if !ok {
+			return nil, ErrBadLength
+		}
+		if typ != extensionECHOuterExtensions {
+			list = append(list, ext[:len(ext)-len(extensions)]...)
+			continue
+		}
+
+		// copy the referenced extensions from the outer client hello, in order
+		types, ok := data.vector(1)
+		if !ok {
+			return nil, ErrBadLength
+		}
+		for len(types) > 0 {
+			ref, ok := types.uint16()
+			if !ok {
+				return nil, ErrBadLength
+			}
+			found := false
+			for len(outerExtensions) > 0 && !found {
+				ext := outerExtensions
+				typ, _ := outerExtensions.uint16()
+				if !outerExtensions.skipVector(2) {
+					return nil, ErrBadLength
+				}
+				if typ == ref {
+					list = append(list, ext[:len(ext)-len(outerExtensions)]...)
+					found = true
+				}
+			}
+			if !found {
+				return nil, errors.New("inner client hello refers to a missing outer extension")
+			}
+		}
+	}
+	out = append(out, byte(len(list)>>8), byte(len(list)))
+	out = append(out, list...)
+
+	// the remainder is padding
+	for _, b := range s {
+		if b != 0 {
+			return nil, ErrBadLength
+		}
+	}
+
+	out[0] = handshakeTypeClientHello
+	length := len(out) - 4
+	out[1], out[2], out[3] = byte(length>>16), byte(length>>8), byte(length)
+	return out, nil
+}
@@ -0,0 +1,196 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/pem"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+const testECHConfigID = 0x2a
+
+// testECHConfig returns an ECHConfigList for the X25519 public key and the public name,
+// offering HKDF-SHA256 with AES-128-GCM and ChaCha20Poly1305.
+func testECHConfig(publicKey []byte, publicName string) []byte {
+
+	contents := []byte{testECHConfigID}
+	contents = appendUint16(contents, hpkeKEMX25519)
+	contents = appendUint16(contents, uint16(len(publicKey)))
+	contents = append(contents, publicKey...)
+	contents = append(contents, 0, 8, 0, 1, 0, 1, 0, 1, 0, 3) // cipher suites
+	contents = append(contents, 0, byte(len(publicName)))     // maximum name length
+	contents = append(contents, publicName...)
+	contents = append(contents, 0, 0) // extensions
+
+	config := appendUint16(nil, echVersion)
+	config = appendUint16(config, uint16(len(contents)))
+	config = append(config, contents...)
+	return append(appendUint16(nil, uint16(len(config))), config...)
+}
+
+// testECHKeys returns the private and public key and the ECHConfigList of a server.
+func testECHKeys(t *testing.T) (privateKey, publicKey, configList []byte) {
+	privateKey = bytes.Repeat([]byte{7}, 32)
+	publicKey, err := curve25519.X25519(privateKey, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return privateKey, publicKey, testECHConfig(publicKey, "public.example")
+}
+
+// sealECH returns a client hello record with the outer extensions followed by an encrypted_client_hello extension,
+// which carries the encoded inner client hello encrypted to the server with the ECHConfigList using ChaCha20Poly1305.
+func sealECH(t *testing.T, configList, publicKey []byte, outer []tlsExtension, encoded []byte) []byte {
+
+	ephemeral := bytes.Repeat([]byte{9}, 32)
+	enc, err := curve25519.X25519(ephemeral, curve25519.Basepoint)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dh, err := curve25519.X25519(ephemeral, publicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		kemSuite = []byte{'K', 'E', 'M', 0, hpkeKEMX25519}
+		prk      = hpkeLabeledExtract(sha256.New, nil, kemSuite, "eae_prk", dh)
+		shared   = hpkeLabeledExpand(sha256.New, prk, kemSuite, "shared_secret", append(append([]byte{}, enc...), publicKey...), 32)
+	)
+	aead, nonce, err := hpkeKeySchedule(hpkeKDFSHA256, hpkeChaCha20Poly1305, shared, append([]byte("tls ech\x00"), configList[2:]...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the payload is zero while computing the additional data
+	ext := []byte{echClientOuter, 0, hpkeKDFSHA256, 0, hpkeChaCha20Poly1305, testECHConfigID}
+	ext = appendUint16(ext, uint16(len(enc)))
+	ext = append(ext, enc...)
+	ext = appendUint16(ext, uint16(len(encoded)+aead.Overhead()))
+	ext = append(ext, make([]byte, len(encoded)+aead.Overhead())...)
+
+	record := clientHelloRecord([]uint16{0x1301, 0x1303}, append(outer, tlsExtension{typ: extensionECH, data: ext}))
+	payload := aead.Seal(nil, nonce, encoded, record[9:])
+	copy(record[len(record)-len(payload):], payload)
+	return record
+}
+
+/*
+ *	Tests
+ */
+
+func TestECH(t *testing.T) {
+
+	privateKey, publicKey, configList := testECHKeys(t)
+
+	var (
+		sni = func(name string) tlsExtension {
+			data := appendUint16(nil, uint16(len(name)+3))
+			data = append(data, 0)
+			data = appendUint16(data, uint16(len(name)))
+			return tlsExtension{typ: extensionServerName, data: append(data, name...)}
+		}
+		alpn     = tlsExtension{typ: extensionALPN, data: []byte{0x00, 0x03, 0x02, 'h', '2'}}
+		versions = tlsExtension{typ: extensionSupportedVersions, data: []byte{0x02, 0x03, 0x04}}
+		algs     = tlsExtension{typ: extensionSignatureAlgorithms, data: []byte{0x00, 0x02, 0x04, 0x03}}
+		inner    = tlsExtension{typ: extensionECH, data: []byte{1}}
+	)
+
+	// the inner client hello refers to the ALPN and supported versions extensions of the outer one
+	expected := clientHelloRecord([]uint16{0x1301, 0x1302, 0x1303}, []tlsExtension{sni("secret.example"), alpn, versions, algs, inner})
+	encoded := clientHelloRecord([]uint16{0x1301, 0x1302, 0x1303}, []tlsExtension{
+		sni("secret.example"),
+		{typ: extensionECHOuterExtensions, data: []byte{4, 0x00, 0x10, 0x00, 0x2b}},
+		algs,
+		inner,
+	})[9:]
+	encoded = append(encoded, make([]byte, 17)...) // padding
+
+	outer := sealECH(t, configList, publicKey, []tlsExtension{sni("public.example"), alpn, versions}, encoded)
+
+	keys := &ECHKeys{}
+	if err := keys.Add(configList, privateKey); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := keys.DecryptECH(outer[5:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(msg, expected[5:]) {
+		t.Fatalf("unexpected inner client hello %x", msg)
+	}
+
+	e := InspectECH(outer[5:], keys, JA4ProtocolTCP)
+	hello, ext := decodeClientHello(t, expected)
+	if e == nil || e.Type != ECHReal || e.ConfigID != testECHConfigID || e.PublicName != "public.example" || e.InnerSNI != "secret.example" {
+		t.Fatal("unexpected ECH", e)
+	}
+	if e.InnerJA3 != string(Bare(hello)) || e.InnerJA4 != JA4(hello, ext, JA4ProtocolTCP) {
+		t.Fatal("unexpected inner fingerprints", e.InnerJA3, e.InnerJA4)
+	}
+
+	// a payload that cannot be decrypted is real, if the public name and the config ID are known
+	corrupted := append([]byte{}, outer...)
+	corrupted[len(corrupted)-1] ^= 1
+	if e := InspectECH(corrupted[5:], keys, JA4ProtocolTCP); e == nil || e.Type != ECHReal || e.InnerJA3 != "" {
+		t.Fatal("unexpected ECH", e)
+	}
+
+	// GREASE uses a config ID none of the keys of the server has
+	idx := bytes.Index(outer, []byte{echClientOuter, 0, hpkeKDFSHA256, 0, hpkeChaCha20Poly1305, testECHConfigID})
+	grease := append([]byte{}, outer...)
+	grease[idx+5]++
+	if e := InspectECH(grease[5:], keys, JA4ProtocolTCP); e == nil || e.Type != ECHGrease || e.ConfigID != testECHConfigID+1 {
+		t.Fatal("unexpected ECH", e)
+	}
+
+	// without a key for the public name, the type is unknown
+	other := &ECHKeys{}
+	if err := other.Add(testECHConfig(publicKey, "other.example"), privateKey); err != nil {
+		t.Fatal(err)
+	}
+	if e := InspectECH(grease[5:], other, JA4ProtocolTCP); e == nil || e.Type != ECHUnknown {
+		t.Fatal("unexpected ECH", e)
+	}
+	if e := InspectECH(outer[5:], nil, JA4ProtocolTCP); e == nil || e.Type != ECHUnknown || e.PublicName != "public.example" {
+		t.Fatal("unexpected ECH", e)
+	}
+	if e := InspectECH(modernClientHello()[5:], keys, JA4ProtocolTCP); e != nil {
+		t.Fatal("unexpected ECH", e)
+	}
+
+	// keys in PEM format
+	var file []byte
+	file = append(file, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: append(append([]byte{}, pkcs8X25519...), privateKey...)})...)
+	file = append(file, pem.EncodeToMemory(&pem.Block{Type: "ECHCONFIG", Bytes: configList})...)
+	keys, err = LoadECHKeys(tempFile(t, file))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys.Len() != 1 {
+		t.Fatal("expected 1 key, got", keys.Len())
+	}
+
+	records := collectRecordsWith(t, []Option{WithECH(keys)}, conversation(t, outer)...)
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if r := records[0]; r.ECH == nil || r.ECH.Type != ECHReal || r.ECH.InnerJA3Digest != BareToDigestHex(Bare(hello)) || r.JA3 == r.ECH.InnerJA3 {
+		t.Fatal("unexpected record", r.ECH)
+	}
+}
@@ -0,0 +1,93 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/google/gopacket/layers"
+)
+
+// ErrUnknownFormat is returned if a file is neither a PCAP nor a PCAPNG file.
+var ErrUnknownFormat = errors.New("not a pcap or pcapng file")
+
+// UnsupportedLinkTypeError is returned if packets of the given link type cannot be decoded.
+// LinkType is the DLT of the capture, which can be larger than the byte gopacket stores link types in.
+type UnsupportedLinkTypeError struct {
+	LinkType int
+}
+
+func (e *UnsupportedLinkTypeError) Error() string {
+	return fmt.Sprintf("unsupported link type %d", e.LinkType)
+}
+
+// TruncatedFileError is returned if a capture file ends in the middle of a packet.
+// All fingerprints found in the packets before have been written when this error is returned.
+type TruncatedFileError struct {
+	File    string
+	Packets int
+	Err     error
+}
+
+func (e *TruncatedFileError) Error() string {
+	msg := fmt.Sprintf("file truncated after %d packets: %v", e.Packets, e.Err)
+	if e.File != "" {
+		return e.File + ": " + msg
+	}
+	return msg
+}
+
+func (e *TruncatedFileError) Unwrap() error {
+	return e.Err
+}
+
+// WriteError is returned if writing the results to the output failed.
+type WriteError struct {
+	Err error
+}
+
+func (e *WriteError) Error() string {
+	return "failed to write output: " + e.Err.Error()
+}
+
+func (e *WriteError) Unwrap() error {
+	return e.Err
+}
+
+// checkLinkType returns an UnsupportedLinkTypeError if gopacket has no decoder for the DLT,
+// or if the DLT does not fit into a layers.LinkType and would be mistaken for another link type.
+func checkLinkType(dlt int) error {
+	link := layers.LinkType(dlt)
+	if linkTypeDLT(link) != dlt {
+		return &UnsupportedLinkTypeError{LinkType: dlt}
+	}
+	if l, ok := linkDecoder(link).(layers.LinkType); ok && l.String() == "UnknownLinkType" {
+		return &UnsupportedLinkTypeError{LinkType: dlt}
+	}
+	return nil
+}
+
+// write writes b to out and wraps a failure into a WriteError.
+func write(out io.Writer, b []byte) error {
+	_, err := out.Write(b)
+	if err != nil {
+		return &WriteError{Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,165 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// tempFile writes data to a file in a new temporary directory and returns its path.
+// The caller must remove the directory.
+func tempFile(t *testing.T, data []byte) string {
+	dir, err := ioutil.TempDir("", "ja3")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	file := filepath.Join(dir, "test.pcap")
+	if err := ioutil.WriteFile(file, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// failingWriter fails after n successful writes.
+type failingWriter struct {
+	n int
+}
+
+func (w *failingWriter) Write(b []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("disk full")
+	}
+	w.n--
+	return len(b), nil
+}
+
+/*
+ *	Tests
+ */
+
+func TestReadFileTruncated(t *testing.T) {
+
+	data, err := ioutil.ReadFile("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		b       bytes.Buffer
+		records []*Record
+		file    = tempFile(t, data[:len(data)-10])
+	)
+	defer os.RemoveAll(filepath.Dir(file))
+
+	err = ReadFileJSONErr(file, &b, true)
+
+	var errTruncated *TruncatedFileError
+	if !errors.As(err, &errTruncated) {
+		t.Fatal("expected TruncatedFileError, got", err)
+	}
+	if errTruncated.File != file || errTruncated.Packets == 0 {
+		t.Fatal("unexpected error details", errTruncated)
+	}
+
+	// records before the truncated packet must still be written
+	err = json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatal("expected records")
+	}
+}
+
+func TestReadFileUnsupportedLinkType(t *testing.T) {
+
+	tests := []struct {
+		linkType int
+		data     []byte
+	}{
+		// pcap file header for link type 147 (USER0) without packets
+		{147, []byte{
+			0xd4, 0xc3, 0xb2, 0xa1, 0x02, 0x00, 0x04, 0x00,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0xff, 0xff, 0x00, 0x00, 0x93, 0x00, 0x00, 0x00,
+		}},
+		// link type 257, which gopacket truncates to ethernet
+		{257, []byte{
+			0xa1, 0xb2, 0xc3, 0xd4, 0x00, 0x02, 0x00, 0x04,
+			0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+			0x00, 0x00, 0xff, 0xff, 0x00, 0x00, 0x01, 0x01,
+		}},
+		// pcapng section header and interface description block for link type 257
+		{257, []byte{
+			0x0a, 0x0d, 0x0d, 0x0a, 0x1c, 0x00, 0x00, 0x00,
+			0x4d, 0x3c, 0x2b, 0x1a, 0x01, 0x00, 0x00, 0x00,
+			0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+			0x1c, 0x00, 0x00, 0x00,
+			0x01, 0x00, 0x00, 0x00, 0x14, 0x00, 0x00, 0x00,
+			0x01, 0x01, 0x00, 0x00, 0xff, 0xff, 0x00, 0x00,
+			0x14, 0x00, 0x00, 0x00,
+		}},
+	}
+
+	for _, test := range tests {
+		file := tempFile(t, test.data)
+		defer os.RemoveAll(filepath.Dir(file))
+
+		err := ReadFileCSVErr(file, ioutil.Discard, ",", true)
+
+		var errLinkType *UnsupportedLinkTypeError
+		if !errors.As(err, &errLinkType) {
+			t.Fatal("expected UnsupportedLinkTypeError, got", err)
+		}
+		if errLinkType.LinkType != test.linkType || !strings.HasSuffix(err.Error(), fmt.Sprint("unsupported link type ", test.linkType)) {
+			t.Fatal("unexpected link type", errLinkType.LinkType, err)
+		}
+	}
+}
+
+func TestReadFileUnknownFormat(t *testing.T) {
+
+	file := tempFile(t, []byte("this is not a capture file"))
+	defer os.RemoveAll(filepath.Dir(file))
+
+	if err := ReadFileJa3sErr(file, ioutil.Discard); !errors.Is(err, ErrUnknownFormat) {
+		t.Fatal("expected ErrUnknownFormat, got", err)
+	}
+	if err := ReadFileJSONErr(file+".missing", ioutil.Discard, true); !os.IsNotExist(err) {
+		t.Fatal("expected a not exist error, got", err)
+	}
+}
+
+func TestReadFileWriteError(t *testing.T) {
+
+	err := ReadFileCSVErr("test2.pcap", &failingWriter{n: 3}, ",", true)
+
+	var errWrite *WriteError
+	if !errors.As(err, &errWrite) {
+		t.Fatal("expected WriteError, got", err)
+	}
+	if errWrite.Err.Error() != "disk full" {
+		t.Fatal("unexpected error", errWrite.Err)
+	}
+}
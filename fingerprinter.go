@@ -0,0 +1,304 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"hash"
+
+	"github.com/dreadl0ck/tlsx"
+)
+
+// TLS extensions decoded for JA3 fingerprints.
+const (
+	extensionSupportedGroups = 0x000a
+	extensionECPointFormats  = 0x000b
+)
+
+// Fingerprinter computes JA3 and JA3S fingerprints of TLS records without allocating,
+// by decoding into a reusable tlsx.ClientHelloBasic and tlsx.ServerHelloBasic and hashing from a reusable buffer.
+// Once the buffers have grown to the size of the largest hello seen, no further allocations take place.
+//
+// The results of a call, including the returned hellos, are only valid until the next call.
+// A Fingerprinter must not be used concurrently, use one per goroutine instead.
+type Fingerprinter struct {
+	client tlsx.ClientHelloBasic
+	server tlsx.ServerHelloBasic
+
+	buf []byte
+	md5 hash.Hash
+	sum [md5.Size]byte
+}
+
+// NewFingerprinter returns a Fingerprinter with buffers sized for typical client hellos.
+func NewFingerprinter() *Fingerprinter {
+	return &Fingerprinter{
+		buf: make([]byte, 0, 512),
+		md5: md5.New(),
+	}
+}
+
+// ClientHello decodes a TLS record carrying a client hello, like tlsx.ClientHelloBasic.Unmarshal does,
+// into the reusable hello of the Fingerprinter. The SNI is validated but not copied into the hello,
+// as that would allocate a string.
+func (f *Fingerprinter) ClientHello(payload []byte) (*tlsx.ClientHelloBasic, error) {
+
+	ch := &f.client
+	*ch = tlsx.ClientHelloBasic{
+		CipherSuites:    ch.CipherSuites[:0],
+		SupportedGroups: ch.SupportedGroups[:0],
+		SupportedPoints: ch.SupportedPoints[:0],
+		AllExtensions:   ch.AllExtensions[:0],
+	}
+
+	if len(payload) < 6 {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	ch.Type = payload[0]
+	ch.Version = tlsx.Version(payload[1])<<8 | tlsx.Version(payload[2])
+	if ch.Type != recordTypeHandshake {
+		return nil, tlsx.ErrHandshakeWrongType
+	}
+
+	hs := payload[5:]
+	if len(hs) < 6 {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	ch.HandshakeType = hs[0]
+	if ch.HandshakeType != handshakeTypeClientHello {
+		return nil, tlsx.ErrHandshakeWrongType
+	}
+	ch.HandshakeVersion = tlsx.Version(hs[4])<<8 | tlsx.Version(hs[5])
+
+	// random (32) + session ID
+	hs = hs[6:]
+	if len(hs) < 33 {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	ch.SessionIDLen = uint32(hs[32])
+	hs = hs[33:]
+	if len(hs) < int(ch.SessionIDLen)+2 {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	hs = hs[ch.SessionIDLen:]
+
+	ch.CipherSuiteLen = uint16(hs[0])<<8 | uint16(hs[1])
+	if len(hs) < int(ch.CipherSuiteLen)+2 {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	for i := 0; i < int(ch.CipherSuiteLen/2); i++ {
+		ch.CipherSuites = append(ch.CipherSuites, tlsx.CipherSuite(hs[2+2*i])<<8|tlsx.CipherSuite(hs[3+2*i]))
+	}
+	hs = hs[2+ch.CipherSuiteLen:]
+
+	// compression methods
+	if len(hs) < 1 || len(hs) < 1+int(hs[0]) {
+		return nil, tlsx.ErrHandshakeBadLength
+	}
+	hs = hs[1+int(hs[0]):]
+	if len(hs) < 2 {
+		// no extensions
+		return ch, nil
+	}
+
+	ch.ExtensionLen = uint16(hs[0])<<8 | uint16(hs[1])
+	if len(hs) < int(ch.ExtensionLen)+2 {
+		return nil, tlsx.ErrHandshakeExtBadLength
+	}
+	hs = hs[2:]
+	for len(hs) > 0 {
+		if len(hs) < 4 {
+			return nil, tlsx.ErrHandshakeExtBadLength
+		}
+		typ := uint16(hs[0])<<8 | uint16(hs[1])
+		length := int(hs[2])<<8 | int(hs[3])
+		if len(hs) < 4+length {
+			return nil, tlsx.ErrHandshakeExtBadLength
+		}
+		data := hs[4 : 4+length]
+		hs = hs[4+length:]
+
+		ch.AllExtensions = append(ch.AllExtensions, typ)
+
+		switch typ {
+		case extensionServerName:
+			if len(data) < 2 || len(data)-2 < int(data[0])<<8|int(data[1]) {
+				return nil, tlsx.ErrHandshakeExtBadLength
+			}
+			for data = data[2:]; len(data) > 0; {
+				if len(data) < 3 {
+					return nil, tlsx.ErrHandshakeExtBadLength
+				}
+				nameLength := int(data[1])<<8 | int(data[2])
+				if len(data) < nameLength {
+					return nil, tlsx.ErrHandshakeExtBadLength
+				}
+				data = data[3:]
+				if len(data) < nameLength {
+					return nil, tlsx.ErrHandshakeExtBadLength
+				}
+				data = data[nameLength:]
+			}
+		case extensionSupportedGroups:
+			if len(data) < 2 {
+				return nil, tlsx.ErrHandshakeExtBadLength
+			}
+			n := int(data[0])<<8 | int(data[1])
+			data = data[2:]
+			if len(data) < n {
+				return nil, tlsx.ErrHandshakeExtBadLength
+			}
+			ch.SupportedGroups = ch.SupportedGroups[:0]
+			for i := 0; i < n/2; i++ {
+				ch.SupportedGroups = append(ch.SupportedGroups, uint16(data[2*i])<<8|uint16(data[2*i+1]))
+			}
+		case extensionECPointFormats:
+			if len(data) < 1 || len(data)-1 < int(data[0]) {
+				return nil, tlsx.ErrHandshakeExtBadLength
+			}
+			ch.SupportedPoints = append(ch.SupportedPoints[:0], data[1:1+int(data[0])]...)
+		}
+	}
+	return ch, nil
+}
+
+// ServerHello decodes a TLS record carrying a server hello, like tlsx.ServerHelloBasic.Unmarshal does,
+// into the reusable hello of the Fingerprinter. Random and SessionID refer to the payload.
+func (f *Fingerprinter) ServerHello(payload []byte) (*tlsx.ServerHelloBasic, error) {
+
+	sh := &f.server
+	*sh = tlsx.ServerHelloBasic{Extensions: sh.Extensions[:0]}
+
+	if len(payload) < 9 {
+		return nil, ErrBadLength
+	}
+	length := int(payload[6])<<16 | int(payload[7])<<8 | int(payload[8])
+	if length >= len(payload) || len(payload) < 9+length {
+		return nil, ErrBadLength
+	}
+
+	s := cursor(payload[9 : 9+length])
+	var ok bool
+	if sh.Vers, ok = s.uint16(); !ok {
+		return nil, ErrNoHandshake
+	}
+	if sh.Random, ok = s.bytes(32); !ok {
+		return nil, ErrNoHandshake
+	}
+	if sh.SessionID, ok = s.vector(1); !ok {
+		return nil, ErrNoHandshake
+	}
+	if sh.CipherSuite, ok = s.uint16(); !ok {
+		return nil, ErrNoHandshake
+	}
+	if sh.CompressionMethod, ok = s.uint8(); !ok {
+		return nil, ErrNoHandshake
+	}
+	if len(s) == 0 {
+		// the extensions are optional
+		return sh, nil
+	}
+
+	extensions, ok := s.vector(2)
+	if !ok || len(s) != 0 {
+		return nil, ErrBadLength
+	}
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok || !extensions.skipVector(2) {
+			return nil, ErrBadLength
+		}
+		sh.Extensions = append(sh.Extensions, typ)
+	}
+	return sh, nil
+}
+
+// AppendBare appends the JA3 bare string of the client hello in a TLS record to dst.
+func (f *Fingerprinter) AppendBare(dst, payload []byte) ([]byte, error) {
+	hello, err := f.ClientHello(payload)
+	if err != nil {
+		return dst, err
+	}
+	return AppendBare(dst, hello), nil
+}
+
+// AppendBareJa3s appends the JA3S bare string of the server hello in a TLS record to dst.
+func (f *Fingerprinter) AppendBareJa3s(dst, payload []byte) ([]byte, error) {
+	hello, err := f.ServerHello(payload)
+	if err != nil {
+		return dst, err
+	}
+	return AppendBareJa3s(dst, hello), nil
+}
+
+// SumInto stores the JA3 digest of the client hello in a TLS record in sum.
+func (f *Fingerprinter) SumInto(sum *[md5.Size]byte, payload []byte) error {
+	var err error
+	if f.buf, err = f.AppendBare(f.buf[:0], payload); err != nil {
+		return err
+	}
+	*sum = f.digest()
+	return nil
+}
+
+// SumJa3sInto stores the JA3S digest of the server hello in a TLS record in sum.
+func (f *Fingerprinter) SumJa3sInto(sum *[md5.Size]byte, payload []byte) error {
+	var err error
+	if f.buf, err = f.AppendBareJa3s(f.buf[:0], payload); err != nil {
+		return err
+	}
+	*sum = f.digest()
+	return nil
+}
+
+// AppendDigestHex appends the hex encoded JA3 digest of the client hello in a TLS record to dst.
+func (f *Fingerprinter) AppendDigestHex(dst, payload []byte) ([]byte, error) {
+	var sum [md5.Size]byte
+	if err := f.SumInto(&sum, payload); err != nil {
+		return dst, err
+	}
+	return appendHex(dst, sum[:]), nil
+}
+
+// AppendDigestHexJa3s appends the hex encoded JA3S digest of the server hello in a TLS record to dst.
+func (f *Fingerprinter) AppendDigestHexJa3s(dst, payload []byte) ([]byte, error) {
+	var sum [md5.Size]byte
+	if err := f.SumJa3sInto(&sum, payload); err != nil {
+		return dst, err
+	}
+	return appendHex(dst, sum[:]), nil
+}
+
+// digest hashes the bare string in the buffer.
+func (f *Fingerprinter) digest() [md5.Size]byte {
+	if f.md5 == nil {
+		f.md5 = md5.New()
+	}
+	f.md5.Reset()
+	f.md5.Write(f.buf)
+	f.md5.Sum(f.sum[:0])
+	return f.sum
+}
+
+// appendHex appends the hex encoding of src to dst.
+func appendHex(dst, src []byte) []byte {
+	n := len(dst)
+	for i := 0; i < hex.EncodedLen(len(src)); i++ {
+		dst = append(dst, 0)
+	}
+	hex.Encode(dst[n:], src)
+	return dst
+}
@@ -3,7 +3,11 @@ module github.com/dreadl0ck/ja3
 require (
 	github.com/dreadl0ck/tlsx v1.0.3
 	github.com/google/gopacket v1.1.18
-	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a // indirect
+	github.com/klauspost/compress v1.13.4
+	github.com/pierrec/lz4/v4 v4.1.22
+	github.com/ulikunitz/xz v0.5.15
+	golang.org/x/crypto v0.0.0-20200820211705-5c72a883971a
+	gopkg.in/yaml.v2 v2.4.0
 )
 
-go 1.13
+go 1.14
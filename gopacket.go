@@ -66,10 +66,16 @@ func DigestHexPacketJa3s(p gopacket.Packet) string {
 	return hex.EncodeToString(sum[:])
 }
 
-// BarePacket returns the Ja3 digest if the supplied packet contains a TLS client hello
+// BarePacket returns the Ja3 digest if the supplied packet contains a TLS or SSLv2 client hello
+// over TCP, in DTLS records or in the QUIC Initial packets of a single datagram
 // otherwise returns an empty string
 func BarePacket(p gopacket.Packet) []byte {
-	if tl := p.TransportLayer(); tl != nil {
+	return bareTransport(p.TransportLayer())
+}
+
+// bareTransport returns the Ja3 bare string for the client hello carried by a TCP or UDP layer.
+func bareTransport(tl gopacket.TransportLayer) []byte {
+	if tl != nil {
 		if tcp, ok := tl.(*layers.TCP); ok {
 			if tcp.SYN {
 				// Connection setup
@@ -86,6 +92,11 @@ func BarePacket(p gopacket.Packet) []byte {
 					err   = hello.Unmarshal(tcp.LayerPayload())
 				)
 				if err != nil {
+					// legacy clients may send the hello in an SSLv2 record
+					var v2 SSLv2ClientHello
+					if v2.Unmarshal(tcp.LayerPayload()) == nil {
+						return BareSSLv2(&v2)
+					}
 					if Debug {
 						fmt.Println(err)
 						//fmt.Println(p.Dump())
@@ -96,15 +107,31 @@ func BarePacket(p gopacket.Packet) []byte {
 				// return JA3 bare
 				return Bare(&hello)
 			}
+		} else if udp, ok := tl.(*layers.UDP); ok {
+			if isDTLSRecord(udp.LayerPayload()) {
+				return BareDTLS(udp.LayerPayload())
+			}
+
+			// QUIC Initial packets
+			var hello tlsx.ClientHelloBasic
+			if record := quicClientHello(udp.LayerPayload()); record != nil && hello.Unmarshal(record) == nil {
+				return Bare(&hello)
+			}
 		}
 	}
 	return []byte{}
 }
 
 // BarePacket returns the Ja3 digest if the supplied packet contains a TLS client hello
+// over TCP or in DTLS records
 // otherwise returns an empty string
 func BarePacketJa3s(p gopacket.Packet) []byte {
-	if tl := p.TransportLayer(); tl != nil {
+	return bareJa3sTransport(p.TransportLayer())
+}
+
+// bareJa3sTransport returns the Ja3s bare string for the server hello carried by a TCP or UDP layer.
+func bareJa3sTransport(tl gopacket.TransportLayer) []byte {
+	if tl != nil {
 		if tcp, ok := tl.(*layers.TCP); ok {
 			if tcp.SYN {
 				// Connection setup
@@ -122,7 +149,7 @@ func BarePacketJa3s(p gopacket.Packet) []byte {
 				)
 				if err != nil {
 					if Debug {
-						fmt.Println(err, p.NetworkLayer().NetworkFlow(), p.TransportLayer().TransportFlow())
+						fmt.Println(err, tcp.TransportFlow())
 						//fmt.Println(p.Dump())
 					}
 					return []byte{}
@@ -131,7 +158,103 @@ func BarePacketJa3s(p gopacket.Packet) []byte {
 				// return JA3 bare
 				return BareJa3s(&hello)
 			}
+		} else if udp, ok := tl.(*layers.UDP); ok {
+			return BareDTLSJa3s(udp.LayerPayload())
 		}
 	}
 	return []byte{}
 }
+
+// JA4Packet returns the JA4 fingerprint if the supplied packet contains a TLS client hello
+// otherwise returns an empty string
+func JA4Packet(p gopacket.Packet) string {
+	if tl := p.TransportLayer(); tl != nil {
+		if tcp, ok := tl.(*layers.TCP); ok && !tcp.SYN && !tcp.FIN && !tcp.RST && len(tcp.LayerPayload()) > 0 {
+			var (
+				hello   tlsx.ClientHelloBasic
+				ext     ClientHelloExtensions
+				payload = tcp.LayerPayload()
+			)
+			if err := hello.Unmarshal(payload); err != nil {
+				if Debug {
+					fmt.Println(err)
+				}
+				return ""
+			}
+			if err := ext.Unmarshal(payload); err != nil {
+				if Debug {
+					fmt.Println(err)
+				}
+				return ""
+			}
+
+			return JA4(&hello, &ext, JA4ProtocolTCP)
+		}
+		if udp, ok := tl.(*layers.UDP); ok {
+			var (
+				hello    tlsx.ClientHelloBasic
+				ext      ClientHelloExtensions
+				record   = quicClientHello(udp.LayerPayload())
+				protocol = byte(JA4ProtocolQUIC)
+			)
+			if isDTLSRecord(udp.LayerPayload()) {
+				record = dtlsHello(udp.LayerPayload(), handshakeTypeClientHello)
+				protocol = JA4ProtocolDTLS
+			}
+			if record == nil || hello.Unmarshal(record) != nil || ext.Unmarshal(record) != nil {
+				return ""
+			}
+			return JA4(&hello, &ext, protocol)
+		}
+	}
+	return ""
+}
+
+// JA4SPacket returns the JA4S fingerprint if the supplied packet contains a TLS server hello
+// otherwise returns an empty string
+func JA4SPacket(p gopacket.Packet) string {
+	if tl := p.TransportLayer(); tl != nil {
+		if tcp, ok := tl.(*layers.TCP); ok && !tcp.SYN && !tcp.FIN && !tcp.RST && len(tcp.LayerPayload()) > 0 {
+			var (
+				hello   tlsx.ServerHelloBasic
+				ext     ServerHelloExtensions
+				payload = tcp.LayerPayload()
+			)
+			if err := hello.Unmarshal(payload); err != nil {
+				if Debug {
+					fmt.Println(err)
+				}
+				return ""
+			}
+			if err := ext.Unmarshal(payload); err != nil {
+				if Debug {
+					fmt.Println(err)
+				}
+				return ""
+			}
+
+			return JA4S(&hello, &ext, JA4ProtocolTCP)
+		}
+		if udp, ok := tl.(*layers.UDP); ok {
+			var (
+				hello  tlsx.ServerHelloBasic
+				ext    ServerHelloExtensions
+				record = dtlsHello(udp.LayerPayload(), handshakeTypeServerHello)
+			)
+			if record == nil || hello.Unmarshal(record) != nil || ext.Unmarshal(record) != nil {
+				return ""
+			}
+			return JA4S(&hello, &ext, JA4ProtocolDTLS)
+		}
+	}
+	return ""
+}
+
+// JA4TPacket returns the JA4T fingerprint if the supplied packet is a TCP SYN,
+// or the JA4TS fingerprint if it is a SYN-ACK, otherwise returns an empty string
+func JA4TPacket(p gopacket.Packet) string {
+	if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok && tcp.SYN {
+		return JA4T(tcp)
+	}
+	return ""
+}
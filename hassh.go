@@ -0,0 +1,104 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import "errors"
+
+// sshMsgKexInit is the message number of SSH_MSG_KEXINIT.
+const sshMsgKexInit = 20
+
+// ErrNoKexInit is returned if the payload does not contain an SSH key exchange init message.
+var ErrNoKexInit = errors.New("payload is not an SSH_MSG_KEXINIT message")
+
+// KexInit contains the name-lists of an SSH_MSG_KEXINIT message, as comma separated strings.
+type KexInit struct {
+	KexAlgorithms                       string
+	ServerHostKeyAlgorithms             string
+	EncryptionAlgorithmsClientToServer  string
+	EncryptionAlgorithmsServerToClient  string
+	MACAlgorithmsClientToServer         string
+	MACAlgorithmsServerToClient         string
+	CompressionAlgorithmsClientToServer string
+	CompressionAlgorithmsServerToClient string
+}
+
+// Unmarshal decodes the payload of an SSH binary packet carrying an SSH_MSG_KEXINIT message,
+// starting with the message number.
+func (k *KexInit) Unmarshal(payload []byte) error {
+
+	*k = KexInit{}
+
+	// message number (1) + cookie (16)
+	s := cursor(payload)
+	if typ, ok := s.uint8(); !ok || typ != sshMsgKexInit {
+		return ErrNoKexInit
+	}
+	if !s.skip(16) {
+		return ErrBadLength
+	}
+
+	for _, v := range []*string{
+		&k.KexAlgorithms,
+		&k.ServerHostKeyAlgorithms,
+		&k.EncryptionAlgorithmsClientToServer,
+		&k.EncryptionAlgorithmsServerToClient,
+		&k.MACAlgorithmsClientToServer,
+		&k.MACAlgorithmsServerToClient,
+		&k.CompressionAlgorithmsClientToServer,
+		&k.CompressionAlgorithmsServerToClient,
+	} {
+		list, ok := s.vector(4)
+		if !ok {
+			return ErrBadLength
+		}
+		*v = string(list)
+	}
+
+	// the language name-lists, first_kex_packet_follows and the reserved field are not needed
+	return nil
+}
+
+// BareHASSH returns the HASSH bare string of the key exchange init message of an SSH client.
+// HASSH was developed by Salesforce to fingerprint SSH clients and servers,
+// the reference implementation can be found here: https://github.com/salesforce/hassh
+// It concatenates the algorithms the client offers for the key exchange, encryption, message authentication
+// and compression, using a ";" to delimit each field:
+// KexAlgorithms;EncryptionAlgorithmsClientToServer;MACAlgorithmsClientToServer;CompressionAlgorithmsClientToServer
+// The MD5 of the bare string, see BareToDigestHex, is the HASSH fingerprint.
+func BareHASSH(k *KexInit) []byte {
+	return bareHASSH(k.KexAlgorithms, k.EncryptionAlgorithmsClientToServer, k.MACAlgorithmsClientToServer, k.CompressionAlgorithmsClientToServer)
+}
+
+// BareHASSHServer returns the HASSHServer bare string of the key exchange init message of an SSH server,
+// which uses the algorithms for the direction from server to client:
+// KexAlgorithms;EncryptionAlgorithmsServerToClient;MACAlgorithmsServerToClient;CompressionAlgorithmsServerToClient
+func BareHASSHServer(k *KexInit) []byte {
+	return bareHASSH(k.KexAlgorithms, k.EncryptionAlgorithmsServerToClient, k.MACAlgorithmsServerToClient, k.CompressionAlgorithmsServerToClient)
+}
+
+func bareHASSH(fields ...string) []byte {
+	n := len(fields) - 1
+	for _, f := range fields {
+		n += len(f)
+	}
+	buffer := make([]byte, 0, n)
+	for i, f := range fields {
+		if i > 0 {
+			buffer = append(buffer, ';')
+		}
+		buffer = append(buffer, f...)
+	}
+	return buffer
+}
@@ -0,0 +1,157 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+var (
+	clientKexInit = []string{
+		"curve25519-sha256,ecdh-sha2-nistp256,ext-info-c",
+		"ssh-ed25519,rsa-sha2-512",
+		"chacha20-poly1305@openssh.com,aes128-ctr",
+		"aes128-ctr",
+		"umac-64-etm@openssh.com,hmac-sha2-256",
+		"hmac-sha2-256",
+		"none,zlib@openssh.com",
+		"none",
+		"",
+		"",
+	}
+	serverKexInit = []string{
+		"curve25519-sha256,diffie-hellman-group14-sha256",
+		"rsa-sha2-512",
+		"aes256-ctr",
+		"aes256-gcm@openssh.com,aes256-ctr",
+		"hmac-sha2-512",
+		"hmac-sha2-512-etm@openssh.com,hmac-sha2-512",
+		"none",
+		"none,zlib",
+		"",
+		"",
+	}
+)
+
+// kexInitPayload encodes an SSH_MSG_KEXINIT message with the name-lists.
+func kexInitPayload(lists []string) []byte {
+	payload := make([]byte, 17)
+	payload[0] = sshMsgKexInit
+	for _, l := range lists {
+		payload = append(payload, byte(len(l)>>24), byte(len(l)>>16), byte(len(l)>>8), byte(len(l)))
+		payload = append(payload, l...)
+	}
+	// first_kex_packet_follows and reserved
+	return append(payload, 0, 0, 0, 0, 0)
+}
+
+// sshPacket wraps the payload into an unencrypted SSH binary packet.
+func sshPacket(payload []byte) []byte {
+	padding := 8 - (5+len(payload))%8
+	if padding < 4 {
+		padding += 8
+	}
+	packet := make([]byte, 5, 5+len(payload)+padding)
+	binary.BigEndian.PutUint32(packet, uint32(1+len(payload)+padding))
+	packet[4] = byte(padding)
+	packet = append(packet, payload...)
+	return append(packet, make([]byte, padding)...)
+}
+
+/*
+ *	Tests
+ */
+
+func TestHASSH(t *testing.T) {
+
+	var k KexInit
+	if err := k.Unmarshal(kexInitPayload(clientKexInit)); err != nil {
+		t.Fatal(err)
+	}
+	if k.ServerHostKeyAlgorithms != clientKexInit[1] || k.CompressionAlgorithmsServerToClient != clientKexInit[7] {
+		t.Fatal("unexpected name-lists", k)
+	}
+
+	expected := "curve25519-sha256,ecdh-sha2-nistp256,ext-info-c;chacha20-poly1305@openssh.com,aes128-ctr;umac-64-etm@openssh.com,hmac-sha2-256;none,zlib@openssh.com"
+	if bare := string(BareHASSH(&k)); bare != expected {
+		t.Fatal("unexpected hassh", bare)
+	}
+	if bare := string(BareHASSHServer(&k)); bare != "curve25519-sha256,ecdh-sha2-nistp256,ext-info-c;aes128-ctr;hmac-sha2-256;none" {
+		t.Fatal("unexpected hassh server", bare)
+	}
+
+	if err := k.Unmarshal(kexInitPayload(clientKexInit)[:40]); err != ErrBadLength {
+		t.Fatal("expected ErrBadLength, got", err)
+	}
+	if err := k.Unmarshal([]byte{21}); err != ErrNoKexInit {
+		t.Fatal("expected ErrNoKexInit, got", err)
+	}
+}
+
+func TestHASSHStream(t *testing.T) {
+
+	var (
+		client = sshPacket(kexInitPayload(clientKexInit))
+		server = sshPacket(kexInitPayload(serverKexInit))
+
+		packets = conversation(t,
+			[]byte("S:SSH-2.0-OpenSSH_8.9p1 Ubuntu-3\r\n"),
+			[]byte("SSH-2.0-OpenSSH_9.0\r\n"),
+			append([]byte("S:"), server...),
+			// key exchange init split across two segments
+			client[:100],
+			client[100:],
+		)
+
+		c, s KexInit
+	)
+	if err := c.Unmarshal(kexInitPayload(clientKexInit)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Unmarshal(kexInitPayload(serverKexInit)); err != nil {
+		t.Fatal(err)
+	}
+	var (
+		hassh       = BareToDigestHex(BareHASSH(&c))
+		hasshServer = BareToDigestHex(BareHASSHServer(&s))
+	)
+
+	records := collectRecordsWith(t, []Option{WithHASSH()}, packets...)
+	if len(records) != 2 {
+		t.Fatal("expected 2 records, got", len(records))
+	}
+	if r := records[0]; r.HASSHServer != hasshServer || r.HASSHServerAlgorithms != string(BareHASSHServer(&s)) || r.SourcePort != 443 || r.HASSH != "" {
+		t.Fatal("unexpected server record", r.HASSHServer, r.SourcePort)
+	}
+	if r := records[1]; r.HASSH != hassh || r.HASSHAlgorithms != string(BareHASSH(&c)) || r.SourcePort != 49391 || r.HASSHServer != "" {
+		t.Fatal("unexpected client record", r.HASSH, r.SourcePort)
+	}
+
+	// pairing reports both fingerprints from the point of view of the client
+	records = collectRecordsWith(t, []Option{WithHASSH(), WithPairing(time.Second)}, packets...)
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if r := records[0]; r.HASSH != hassh || r.HASSHServer != hasshServer || r.SourcePort != 49391 {
+		t.Fatal("unexpected record", r.HASSH, r.HASSHServer, r.SourcePort)
+	}
+
+	// without the option the stream is only inspected for STARTTLS
+	if records = collectRecords(t, packets...); len(records) != 0 {
+		t.Fatal("unexpected records", len(records))
+	}
+}
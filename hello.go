@@ -0,0 +1,394 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+const (
+	recordTypeHandshake = 22
+
+	handshakeTypeClientHello         = 1
+	handshakeTypeServerHello         = 2
+	handshakeTypeEncryptedExtensions = 8
+	handshakeTypeCertificate         = 11
+	handshakeTypeCertificateRequest  = 13
+
+	tlsVersion12 = 0x0303
+	tlsVersion13 = 0x0304
+
+	// maxRecordLength is the maximum TLS record payload length (2^14 + 2048 for ciphertext expansion).
+	maxRecordLength = 16384 + 2048
+)
+
+// TLS extension types decoded by this package.
+const (
+	extensionServerName          = 0x0000
+	extensionSignatureAlgorithms = 0x000d
+	extensionALPN                = 0x0010
+	extensionSupportedVersions   = 0x002b
+)
+
+var (
+	// ErrNoHandshake is returned if the payload does not contain a TLS handshake record of the expected type.
+	ErrNoHandshake = errors.New("payload is not a TLS handshake record of the expected type")
+
+	// ErrBadLength is returned if a length field points beyond the end of the payload.
+	ErrBadLength = errors.New("malformed length in TLS handshake")
+)
+
+// ClientHelloExtensions contains the values of client hello extensions
+// that are needed for JA4, but are not decoded by tlsx.ClientHelloBasic.
+type ClientHelloExtensions struct {
+	ServerName          string
+	ALPNs               []string
+	SignatureAlgorithms []uint16
+	SupportedVersions   []uint16
+}
+
+// Unmarshal decodes the extensions from a TLS record carrying a client hello,
+// the same payload that is passed to tlsx.ClientHelloBasic.Unmarshal.
+func (e *ClientHelloExtensions) Unmarshal(payload []byte) error {
+
+	*e = ClientHelloExtensions{}
+
+	msg, err := handshakeBody(payload, handshakeTypeClientHello)
+	if err != nil {
+		return err
+	}
+
+	// version (2) + random (32)
+	s := cursor(msg)
+	if !s.skip(34) || !s.skipVector(1) || !s.skipVector(2) || !s.skipVector(1) {
+		return ErrBadLength
+	}
+
+	return walkExtensions(s, func(typ uint16, data cursor) bool {
+		switch typ {
+		case extensionServerName:
+			list, ok := data.vector(2)
+			if !ok {
+				return false
+			}
+			for len(list) > 0 {
+				nameType, ok := list.uint8()
+				if !ok {
+					return false
+				}
+				name, ok := list.vector(2)
+				if !ok {
+					return false
+				}
+				// host_name
+				if nameType == 0 && e.ServerName == "" {
+					e.ServerName = string(name)
+				}
+			}
+		case extensionALPN:
+			list, ok := data.vector(2)
+			if !ok {
+				return false
+			}
+			for len(list) > 0 {
+				proto, ok := list.vector(1)
+				if !ok {
+					return false
+				}
+				e.ALPNs = append(e.ALPNs, string(proto))
+			}
+		case extensionSignatureAlgorithms:
+			list, ok := data.vector(2)
+			if !ok {
+				return false
+			}
+			e.SignatureAlgorithms, ok = list.uint16s()
+			return ok
+		case extensionSupportedVersions:
+			list, ok := data.vector(1)
+			if !ok {
+				return false
+			}
+			e.SupportedVersions, ok = list.uint16s()
+			return ok
+		}
+		return true
+	})
+}
+
+// ServerHelloExtensions contains the values of server hello extensions
+// that are needed for JA4S, but are not decoded by tlsx.ServerHelloBasic.
+type ServerHelloExtensions struct {
+	ALPN            string
+	SelectedVersion uint16
+}
+
+// Unmarshal decodes the extensions from a TLS record carrying a server hello,
+// the same payload that is passed to tlsx.ServerHelloBasic.Unmarshal.
+func (e *ServerHelloExtensions) Unmarshal(payload []byte) error {
+
+	*e = ServerHelloExtensions{}
+
+	msg, err := handshakeBody(payload, handshakeTypeServerHello)
+	if err != nil {
+		return err
+	}
+
+	// version (2) + random (32), session id, cipher suite (2) + compression method (1)
+	s := cursor(msg)
+	if !s.skip(34) || !s.skipVector(1) || !s.skip(3) {
+		return ErrBadLength
+	}
+
+	return walkExtensions(s, func(typ uint16, data cursor) bool {
+		switch typ {
+		case extensionALPN:
+			list, ok := data.vector(2)
+			if !ok {
+				return false
+			}
+			proto, ok := list.vector(1)
+			if !ok {
+				return false
+			}
+			e.ALPN = string(proto)
+		case extensionSupportedVersions:
+			var ok bool
+			e.SelectedVersion, ok = data.uint16()
+			return ok
+		}
+		return true
+	})
+}
+
+// EncryptedExtensions contains the extensions a TLS 1.3 server sends encrypted after its hello.
+type EncryptedExtensions struct {
+	Extensions []uint16
+	ALPN       string
+}
+
+// Unmarshal decodes an EncryptedExtensions handshake message, including its 4 byte header.
+func (e *EncryptedExtensions) Unmarshal(msg []byte) error {
+
+	*e = EncryptedExtensions{}
+
+	s := cursor(msg)
+	if typ, ok := s.uint8(); !ok || typ != handshakeTypeEncryptedExtensions {
+		return ErrNoHandshake
+	}
+	body, ok := s.vector(3)
+	if !ok {
+		return ErrBadLength
+	}
+
+	return walkExtensions(body, func(typ uint16, data cursor) bool {
+		e.Extensions = append(e.Extensions, typ)
+		if typ == extensionALPN {
+			list, ok := data.vector(2)
+			if !ok {
+				return false
+			}
+			proto, ok := list.vector(1)
+			if !ok {
+				return false
+			}
+			e.ALPN = string(proto)
+		}
+		return true
+	})
+}
+
+// handshakeBody returns the body of the handshake message of the given type in a TLS record.
+func handshakeBody(payload []byte, handshakeType byte) ([]byte, error) {
+	if len(payload) < 9 || payload[0] != recordTypeHandshake || payload[5] != handshakeType {
+		return nil, ErrNoHandshake
+	}
+	length := int(payload[6])<<16 | int(payload[7])<<8 | int(payload[8])
+	if len(payload) < 9+length {
+		return nil, ErrBadLength
+	}
+	return payload[9 : 9+length], nil
+}
+
+// handshakeRecord wraps a complete handshake message into a single TLS record for decoding with tlsx.
+func handshakeRecord(version uint16, msg []byte) []byte {
+	if len(msg) > 0xffff {
+		return nil
+	}
+	record := make([]byte, 5, 5+len(msg))
+	record[0] = recordTypeHandshake
+	binary.BigEndian.PutUint16(record[1:3], version)
+	binary.BigEndian.PutUint16(record[3:5], uint16(len(msg)))
+	return append(record, msg...)
+}
+
+// walkExtensions invokes fn for every extension in the extension block at the start of s.
+// A missing extension block is not an error.
+func walkExtensions(s cursor, fn func(typ uint16, data cursor) bool) error {
+	if len(s) == 0 {
+		return nil
+	}
+	extensions, ok := s.vector(2)
+	if !ok {
+		return ErrBadLength
+	}
+	for len(extensions) > 0 {
+		typ, ok := extensions.uint16()
+		if !ok {
+			return ErrBadLength
+		}
+		data, ok := extensions.vector(2)
+		if !ok || !fn(typ, data) {
+			return ErrBadLength
+		}
+	}
+	return nil
+}
+
+// cursor is a byte slice that is consumed from the front while decoding.
+type cursor []byte
+
+func (s *cursor) skip(n int) bool {
+	if len(*s) < n {
+		return false
+	}
+	*s = (*s)[n:]
+	return true
+}
+
+func (s *cursor) uint8() (uint8, bool) {
+	if len(*s) < 1 {
+		return 0, false
+	}
+	v := (*s)[0]
+	*s = (*s)[1:]
+	return v, true
+}
+
+func (s *cursor) uint16() (uint16, bool) {
+	if len(*s) < 2 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint16(*s)
+	*s = (*s)[2:]
+	return v, true
+}
+
+func (s *cursor) uint24() (int, bool) {
+	if len(*s) < 3 {
+		return 0, false
+	}
+	v := int((*s)[0])<<16 | int((*s)[1])<<8 | int((*s)[2])
+	*s = (*s)[3:]
+	return v, true
+}
+
+func (s *cursor) uint32() (uint32, bool) {
+	if len(*s) < 4 {
+		return 0, false
+	}
+	v := binary.BigEndian.Uint32(*s)
+	*s = (*s)[4:]
+	return v, true
+}
+
+// varint consumes a QUIC variable length integer, whose length is encoded in the two most significant bits.
+func (s *cursor) varint() (uint64, bool) {
+	if len(*s) < 1 {
+		return 0, false
+	}
+	n := 1 << ((*s)[0] >> 6)
+	if len(*s) < n {
+		return 0, false
+	}
+	v := uint64((*s)[0] & 0x3f)
+	for _, b := range (*s)[1:n] {
+		v = v<<8 | uint64(b)
+	}
+	*s = (*s)[n:]
+	return v, true
+}
+
+// skipVarints consumes n QUIC variable length integers.
+func (s *cursor) skipVarints(n int) bool {
+	for i := 0; i < n; i++ {
+		if _, ok := s.varint(); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// skipVarintVector consumes a vector with a QUIC variable length integer as length prefix.
+func (s *cursor) skipVarintVector() bool {
+	n, ok := s.varint()
+	return ok && n <= uint64(len(*s)) && s.skip(int(n))
+}
+
+// bytes consumes n bytes.
+func (s *cursor) bytes(n int) (cursor, bool) {
+	if n < 0 || len(*s) < n {
+		return nil, false
+	}
+	v := (*s)[:n]
+	*s = (*s)[n:]
+	return v, true
+}
+
+// vector consumes a variable length vector with a length prefix of the given size in bytes.
+func (s *cursor) vector(lengthSize int) (cursor, bool) {
+	var (
+		n  int
+		ok bool
+	)
+	switch lengthSize {
+	case 1:
+		var v uint8
+		v, ok = s.uint8()
+		n = int(v)
+	case 2:
+		var v uint16
+		v, ok = s.uint16()
+		n = int(v)
+	case 3:
+		n, ok = s.uint24()
+	case 4:
+		var v uint32
+		v, ok = s.uint32()
+		n = int(v)
+	}
+	if !ok {
+		return nil, false
+	}
+	return s.bytes(n)
+}
+
+func (s *cursor) skipVector(lengthSize int) bool {
+	_, ok := s.vector(lengthSize)
+	return ok
+}
+
+// uint16s decodes the remaining bytes as a list of uint16 values.
+func (s cursor) uint16s() ([]uint16, bool) {
+	if len(s)%2 != 0 {
+		return nil, false
+	}
+	values := make([]uint16, 0, len(s)/2)
+	for i := 0; i < len(s); i += 2 {
+		values = append(values, binary.BigEndian.Uint16(s[i:]))
+	}
+	return values, true
+}
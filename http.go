@@ -0,0 +1,227 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+const (
+	// maxHTTPHeader limits the number of bytes buffered for the header of an HTTP request.
+	maxHTTPHeader = 1 << 16
+
+	// maxSkippedRecords limits the number of records a TLS 1.3 client sends before its application data,
+	// which are protected with its handshake traffic keys: the finished message and a certificate chain.
+	maxSkippedRecords = 4
+)
+
+// consumeHTTP fingerprints the HTTP request at the start of the stream and skips its body.
+// It reports whether the request has been consumed completely, so that the next one can follow.
+// Streams with request bodies of unknown length, like chunked uploads, are given up.
+func (a *assembler) consumeHTTP(f *flow, h *halfStream, ts time.Time) bool {
+
+	if h.httpBody == 0 {
+		end := httpHeaderEnd(h.buf)
+		if end < 0 {
+			if len(h.buf) > maxHTTPHeader {
+				h.release()
+			}
+			return false
+		}
+
+		var req HTTPRequest
+		if err := req.Unmarshal(h.buf[:end]); err != nil {
+			if Debug {
+				fmt.Println(err, h.network, h.transport)
+			}
+			h.release()
+			return false
+		}
+		h.buf = h.buf[end:]
+
+		r := f.newRecord(h, ts)
+		r.JA4H = JA4H(&req)
+		r.JA4HR = JA4HR(&req)
+		r.HTTPMethod = req.Method
+		r.HTTPVersion = req.Version
+		r.HTTPCookie = len(req.Cookies()) > 0
+		r.AcceptLanguage = req.Header("Accept-Language")
+		r.UserAgent = req.Header("User-Agent")
+		a.output(r)
+
+		h.httpBody = httpContentLength(&req)
+		if h.httpBody < 0 {
+			h.release()
+			return false
+		}
+	}
+
+	n := h.httpBody
+	if n > len(h.buf) {
+		n = len(h.buf)
+	}
+	h.buf = h.buf[n:]
+	h.httpBody -= n
+	if h.httpBody > 0 {
+		return false
+	}
+
+	// the next request may follow on the same connection
+	h.http = false
+	h.plain = false
+	return true
+}
+
+// consumeHTTP2 fingerprints the frames a client sends after the cleartext HTTP/2 connection preface,
+// once the header block of the first request is complete. No more data is needed from the stream afterwards.
+// The fingerprint is emitted in a record of its own, the frames of TLS connections are handled by consumeApplicationData.
+func (a *assembler) consumeHTTP2(f *flow, h *halfStream, ts time.Time) {
+
+	var c HTTP2Connection
+	err := c.Unmarshal(h.buf)
+	if err == ErrIncompleteHTTP2 {
+		return
+	}
+	defer h.release()
+	if err != nil {
+		if Debug {
+			fmt.Println(err, h.network, h.transport)
+		}
+		return
+	}
+
+	bare := BareHTTP2(&c)
+	r := f.newRecord(h, ts)
+	r.HTTP2 = string(bare)
+	r.HTTP2Digest = BareToDigestHex(bare)
+	a.output(r)
+}
+
+// followHTTP2 sets up the decryption of the application data of a TLS 1.3 client, whose hello record waits
+// for the HTTP/2 frames, once the server hello has selected the cipher suite and the version.
+// The record is no longer held back if the application data cannot be decrypted.
+func (a *assembler) followHTTP2(f *flow, suite uint16, version uint16) {
+
+	var h *halfStream
+	for _, c := range f.halves {
+		if c != nil && c.http2 {
+			h = c
+		}
+	}
+	if h == nil {
+		a.endHTTP2(f, nil)
+		return
+	}
+	if version == tlsVersion13 {
+		h.keys = newTLS13Keys(suite, a.opts.keyLog.clientTrafficSecret(f.random))
+	}
+	if h.keys == nil {
+		a.endHTTP2(f, h)
+	}
+}
+
+// consumeApplicationData decrypts the records of a TLS 1.3 client after its hello, and adds the fingerprint
+// of the HTTP/2 frames at the start of its application data to the client hello record of the connection.
+// Records sent before the server hello, and those protected with the handshake traffic keys, are passed over.
+func (a *assembler) consumeApplicationData(f *flow, h *halfStream) {
+
+	for len(h.buf) >= 5 {
+		length := int(binary.BigEndian.Uint16(h.buf[3:5]))
+		if length > maxRecordLength {
+			a.endHTTP2(f, h)
+			return
+		}
+		if len(h.buf) < 5+length {
+			return
+		}
+		record := h.buf[:5+length]
+		h.buf = h.buf[5+length:]
+
+		switch record[0] {
+		case recordTypeChangeCipherSpec, recordTypeHandshake:
+			// sent for middlebox compatibility, or the client hello following a hello retry request
+			continue
+		case recordTypeApplicationData:
+		default:
+			a.endHTTP2(f, h)
+			return
+		}
+		if h.keys == nil {
+			// early data
+			continue
+		}
+
+		typ, plaintext, err := h.keys.open(record)
+		if err != nil {
+			if h.skipped++; h.skipped > maxSkippedRecords {
+				if Debug {
+					fmt.Println("failed to decrypt application data:", err, h.network, h.transport)
+				}
+				a.endHTTP2(f, h)
+				return
+			}
+			continue
+		}
+		if typ != recordTypeApplicationData {
+			// post-handshake messages
+			continue
+		}
+
+		h.appData = append(h.appData, plaintext...)
+		if !isHTTP2Preface(h.appData) {
+			a.endHTTP2(f, h)
+			return
+		}
+
+		var c HTTP2Connection
+		err = c.Unmarshal(h.appData)
+		if err == ErrIncompleteHTTP2 {
+			if len(h.appData) > maxStreamBuffer {
+				a.endHTTP2(f, h)
+				return
+			}
+			continue
+		}
+		if err != nil {
+			if Debug {
+				fmt.Println(err, h.network, h.transport)
+			}
+		} else if r := f.http2; r != nil {
+			bare := BareHTTP2(&c)
+			r.HTTP2 = string(bare)
+			r.HTTP2Digest = BareToDigestHex(bare)
+		}
+		a.endHTTP2(f, h)
+		return
+	}
+}
+
+// endHTTP2 stops following the application data of the client, and emits the client hello record
+// unless it still waits for the server hello or the certificate chain.
+func (a *assembler) endHTTP2(f *flow, h *halfStream) {
+	if h != nil {
+		h.http2 = false
+		h.release()
+	}
+	r := f.http2
+	f.http2 = nil
+	if r != nil && r != f.client && r != f.server {
+		a.output(r)
+	}
+}
@@ -0,0 +1,334 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+)
+
+// HTTP/2 frame types and flags used for fingerprinting, see RFC 7540 section 6.
+const (
+	http2FrameHeaders      = 0x1
+	http2FramePriority     = 0x2
+	http2FrameSettings     = 0x4
+	http2FrameWindowUpdate = 0x8
+	http2FrameContinuation = 0x9
+
+	http2FlagAck        = 0x1
+	http2FlagEndHeaders = 0x4
+	http2FlagPadded     = 0x8
+	http2FlagPriority   = 0x20
+
+	// http2FrameHeaderLength is the length of the header preceding the payload of every frame.
+	http2FrameHeaderLength = 9
+)
+
+var (
+	// ErrNoHTTP2Preface is returned if the payload does not start with the HTTP/2 client connection preface.
+	ErrNoHTTP2Preface = errors.New("payload is not an HTTP/2 client connection preface")
+
+	// ErrIncompleteHTTP2 is returned if the payload ends before the header block of the first request.
+	ErrIncompleteHTTP2 = errors.New("incomplete HTTP/2 connection start")
+
+	// http2Preface is sent by HTTP/2 clients before the first frame.
+	http2Preface = []byte("PRI * HTTP/2.0\r\n\r\nSM\r\n\r\n")
+)
+
+// HTTP2Setting is a parameter of a SETTINGS frame.
+type HTTP2Setting struct {
+	ID    uint16
+	Value uint32
+}
+
+// HTTP2Priority is the stream dependency sent in a PRIORITY frame.
+type HTTP2Priority struct {
+	StreamID  uint32
+	Exclusive bool
+	DependsOn uint32
+	Weight    uint8
+}
+
+// HTTP2Connection contains the frames an HTTP/2 client sends at the start of a connection,
+// up to and including the header block of its first request.
+type HTTP2Connection struct {
+	Settings      []HTTP2Setting
+	WindowUpdate  uint32
+	Priorities    []HTTP2Priority
+	PseudoHeaders []string
+}
+
+// Unmarshal decodes the frames following the client connection preface at the start of payload,
+// up to the end of the first header block. ErrIncompleteHTTP2 is returned if more data is needed.
+func (c *HTTP2Connection) Unmarshal(payload []byte) error {
+
+	*c = HTTP2Connection{}
+
+	if !bytes.HasPrefix(payload, http2Preface) {
+		if len(payload) < len(http2Preface) && bytes.HasPrefix(http2Preface, payload) {
+			return ErrIncompleteHTTP2
+		}
+		return ErrNoHTTP2Preface
+	}
+
+	var (
+		s        = cursor(payload[len(http2Preface):])
+		block    []byte
+		settings bool
+	)
+	for {
+		length, ok := s.uint24()
+		if !ok {
+			return ErrIncompleteHTTP2
+		}
+		typ, _ := s.uint8()
+		flags, _ := s.uint8()
+		stream, _ := s.uint32()
+		stream &= 0x7fffffff
+		data, ok := s.bytes(length)
+		if !ok {
+			return ErrIncompleteHTTP2
+		}
+
+		if block != nil && typ != http2FrameContinuation {
+			return ErrBadLength
+		}
+
+		switch typ {
+		case http2FrameSettings:
+			// only the parameters of the first SETTINGS frame are fingerprinted
+			if flags&http2FlagAck != 0 || settings {
+				continue
+			}
+			settings = true
+			for len(data) >= 6 {
+				id, _ := data.uint16()
+				value, _ := data.uint32()
+				c.Settings = append(c.Settings, HTTP2Setting{ID: id, Value: value})
+			}
+
+		case http2FrameWindowUpdate:
+			if increment, ok := data.uint32(); ok && stream == 0 {
+				c.WindowUpdate = increment & 0x7fffffff
+			}
+
+		case http2FramePriority:
+			dependency, _ := data.uint32()
+			weight, ok := data.uint8()
+			if !ok {
+				return ErrBadLength
+			}
+			c.Priorities = append(c.Priorities, HTTP2Priority{
+				StreamID:  stream,
+				Exclusive: dependency&0x80000000 != 0,
+				DependsOn: dependency & 0x7fffffff,
+				Weight:    weight,
+			})
+
+		case http2FrameHeaders:
+			var padding uint8
+			if flags&http2FlagPadded != 0 {
+				if padding, ok = data.uint8(); !ok {
+					return ErrBadLength
+				}
+			}
+			if flags&http2FlagPriority != 0 && !data.skip(5) {
+				return ErrBadLength
+			}
+			if int(padding) > len(data) {
+				return ErrBadLength
+			}
+			block = append([]byte{}, data[:len(data)-int(padding)]...)
+
+		case http2FrameContinuation:
+			if block == nil {
+				return ErrBadLength
+			}
+			block = append(block, data...)
+		}
+
+		if block != nil && flags&http2FlagEndHeaders != 0 {
+			c.PseudoHeaders = hpackPseudoHeaders(block)
+			return nil
+		}
+	}
+}
+
+// hpackStaticPseudoHeaders are the names of the entries 1 to 14 of the HPACK static table, see RFC 7541 appendix A.
+var hpackStaticPseudoHeaders = []string{
+	":authority", ":method", ":method", ":path", ":path", ":scheme", ":scheme",
+	":status", ":status", ":status", ":status", ":status", ":status", ":status",
+}
+
+// hpackPseudoHeaders returns the names of the pseudo-header fields at the start of an HPACK header block.
+// Pseudo-header fields precede all other fields, so at the start of a connection they either refer to
+// the static table or carry their name as a literal. Decoding stops at the first regular field.
+func hpackPseudoHeaders(block []byte) []string {
+
+	var (
+		s     = cursor(block)
+		names []string
+	)
+	for len(s) > 0 {
+		var prefix uint
+		switch b := s[0]; {
+		case b&0x80 != 0:
+			// indexed header field
+			prefix = 7
+		case b&0xc0 == 0x40:
+			// literal header field with incremental indexing
+			prefix = 6
+		case b&0xe0 == 0x20:
+			// dynamic table size update
+			if _, ok := hpackInteger(&s, 5); !ok {
+				return names
+			}
+			continue
+		default:
+			// literal header field without indexing or never indexed
+			prefix = 4
+		}
+
+		indexed := prefix == 7
+		index, ok := hpackInteger(&s, prefix)
+		if !ok {
+			return names
+		}
+
+		var name string
+		switch {
+		case index > 0 && index <= uint64(len(hpackStaticPseudoHeaders)):
+			name = hpackStaticPseudoHeaders[index-1]
+		case index == 0:
+			// literal name, pseudo-header names are never huffman encoded by the common implementations
+			if len(s) == 0 || s[0]&0x80 != 0 {
+				return names
+			}
+			n, ok := hpackInteger(&s, 7)
+			if !ok {
+				return names
+			}
+			raw, ok := s.bytes(int(n))
+			if !ok {
+				return names
+			}
+			name = string(raw)
+		}
+		if len(name) < 2 || name[0] != ':' {
+			return names
+		}
+		names = append(names, name)
+
+		if !indexed {
+			n, ok := hpackInteger(&s, 7)
+			if !ok || !s.skip(int(n)) {
+				return names
+			}
+		}
+	}
+	return names
+}
+
+// hpackInteger decodes an integer with an N-bit prefix, see RFC 7541 section 5.1.
+func hpackInteger(s *cursor, prefix uint) (uint64, bool) {
+	b, ok := s.uint8()
+	if !ok {
+		return 0, false
+	}
+	max := uint64(1)<<prefix - 1
+	v := uint64(b) & max
+	if v < max {
+		return v, true
+	}
+	for shift := uint(0); shift < 63; shift += 7 {
+		b, ok = s.uint8()
+		if !ok {
+			return 0, false
+		}
+		v += uint64(b&0x7f) << shift
+		if b&0x80 == 0 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// BareHTTP2 returns the HTTP/2 fingerprint of a client as proposed by Akamai in
+// "Passive Fingerprinting of HTTP/2 Clients", which is made up of four fields delimited by a "|":
+// SETTINGS: the parameters of the first SETTINGS frame as id:value, separated by ";"
+// WINDOW_UPDATE: the increment of the connection window, or 00 if no WINDOW_UPDATE was sent
+// PRIORITY: the PRIORITY frames as stream:exclusive:dependency:weight, separated by ",", or 0 if none were sent
+// Pseudo-header order: the first letter of the pseudo-header fields of the first request, separated by ","
+// Example:
+// 1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p
+// The MD5 of the bare string, see BareToDigestHex, can be used as a shorter fingerprint.
+func BareHTTP2(c *HTTP2Connection) []byte {
+
+	buffer := make([]byte, 0, 64)
+
+	for i, s := range c.Settings {
+		if i > 0 {
+			buffer = append(buffer, ';')
+		}
+		buffer = strconv.AppendUint(buffer, uint64(s.ID), 10)
+		buffer = append(buffer, ':')
+		buffer = strconv.AppendUint(buffer, uint64(s.Value), 10)
+	}
+	buffer = append(buffer, '|')
+
+	if c.WindowUpdate == 0 {
+		buffer = append(buffer, "00"...)
+	} else {
+		buffer = strconv.AppendUint(buffer, uint64(c.WindowUpdate), 10)
+	}
+	buffer = append(buffer, '|')
+
+	if len(c.Priorities) == 0 {
+		buffer = append(buffer, '0')
+	}
+	for i, p := range c.Priorities {
+		if i > 0 {
+			buffer = append(buffer, sepFieldByte)
+		}
+		exclusive := byte('0')
+		if p.Exclusive {
+			exclusive = '1'
+		}
+		buffer = strconv.AppendUint(buffer, uint64(p.StreamID), 10)
+		buffer = append(buffer, ':', exclusive, ':')
+		buffer = strconv.AppendUint(buffer, uint64(p.DependsOn), 10)
+		buffer = append(buffer, ':')
+		// the weight is transmitted as a value between 0 and 255, representing 1 to 256
+		buffer = strconv.AppendUint(buffer, uint64(p.Weight)+1, 10)
+	}
+	buffer = append(buffer, '|')
+
+	for i, name := range c.PseudoHeaders {
+		if i > 0 {
+			buffer = append(buffer, sepFieldByte)
+		}
+		buffer = append(buffer, name[1])
+	}
+	return buffer
+}
+
+// isHTTP2Preface checks whether data starts with the HTTP/2 client connection preface, or with a part of it.
+func isHTTP2Preface(data []byte) bool {
+	if len(data) < len(http2Preface) {
+		return len(data) > 0 && bytes.HasPrefix(http2Preface, data)
+	}
+	return bytes.HasPrefix(data, http2Preface)
+}
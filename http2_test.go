@@ -0,0 +1,129 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"testing"
+)
+
+// http2Frame serializes an HTTP/2 frame.
+func http2Frame(typ, flags byte, stream uint32, payload ...byte) []byte {
+	n := len(payload)
+	return append([]byte{
+		byte(n >> 16), byte(n >> 8), byte(n),
+		typ, flags,
+		byte(stream >> 24), byte(stream >> 16), byte(stream >> 8), byte(stream),
+	}, payload...)
+}
+
+// testHTTP2Start returns the start of an HTTP/2 connection as sent by Chrome,
+// with the header block of the first request split into a HEADERS and a CONTINUATION frame.
+func testHTTP2Start() []byte {
+
+	block := []byte{
+		0x82,                                                            // :method GET
+		0x41, 11, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm', // :authority example.com
+		0x87,                        // :scheme https
+		0x84,                        // :path /
+		0x7a, 4, 't', 'e', 's', 't', // user-agent test
+	}
+
+	data := append([]byte{}, http2Preface...)
+	data = append(data, http2Frame(http2FrameSettings, 0, 0,
+		0, 1, 0, 1, 0, 0, // header table size 65536
+		0, 2, 0, 0, 0, 0, // push disabled
+		0, 4, 0, 0x60, 0, 0, // initial window size 6291456
+		0, 6, 0, 4, 0, 0, // max header list size 262144
+	)...)
+	data = append(data, http2Frame(http2FrameWindowUpdate, 0, 0, 0, 0xef, 0, 1)...)
+	// HEADERS with END_STREAM, PRIORITY and padding
+	data = append(data, http2Frame(http2FrameHeaders, 0x1|http2FlagPriority|http2FlagPadded, 1,
+		append(append([]byte{2, 0x80, 0, 0, 0, 255}, block[:5]...), 0, 0)...)...)
+	return append(data, http2Frame(http2FrameContinuation, http2FlagEndHeaders, 1, block[5:]...)...)
+}
+
+/*
+ *	Tests
+ */
+
+func TestHTTP2(t *testing.T) {
+
+	data := testHTTP2Start()
+
+	var c HTTP2Connection
+	if err := c.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if bare := string(BareHTTP2(&c)); bare != "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p" {
+		t.Fatal("unexpected fingerprint", bare)
+	}
+
+	for _, n := range []int{10, len(http2Preface), len(data) - 1} {
+		if err := c.Unmarshal(data[:n]); err != ErrIncompleteHTTP2 {
+			t.Fatal(n, "expected ErrIncompleteHTTP2, got", err)
+		}
+	}
+	if err := c.Unmarshal([]byte("GET / HTTP/1.1\r\n\r\n")); err != ErrNoHTTP2Preface {
+		t.Fatal("expected ErrNoHTTP2Preface, got", err)
+	}
+
+	// Firefox style priorities, literal pseudo-header names and no window update
+	data = append([]byte{}, http2Preface...)
+	data = append(data, http2Frame(http2FrameSettings, 0, 0, 0, 1, 0, 1, 0, 0)...)
+	data = append(data, http2Frame(http2FrameSettings, http2FlagAck, 0)...)
+	data = append(data, http2Frame(http2FrameSettings, 0, 0, 0, 4, 0, 0x10, 0, 0)...) // not the first SETTINGS frame
+	data = append(data, http2Frame(http2FramePriority, 0, 3, 0, 0, 0, 0, 200)...)
+	data = append(data, http2Frame(http2FramePriority, 0, 5, 0x80, 0, 0, 3, 100)...)
+	data = append(data, http2Frame(http2FrameHeaders, http2FlagEndHeaders, 15,
+		0x83,                                     // :method POST
+		0x00, 5, ':', 'p', 'a', 't', 'h', 1, '/', // :path / without indexing
+		0x20,                                                              // dynamic table size update
+		0x10, 7, ':', 's', 'c', 'h', 'e', 'm', 'e', 4, 'h', 't', 't', 'p', // :scheme http never indexed
+		0x01, 3, 'f', 'o', 'o', // :authority foo without indexing, indexed name
+		0x40, 3, 'x', '-', 'a', 1, 'b', // x-a b
+		0x86, // :scheme http after a regular field is ignored
+	)...)
+	if err := c.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if bare := string(BareHTTP2(&c)); bare != "1:65536|00|3:0:0:201,5:1:3:101|m,p,s,a" {
+		t.Fatal("unexpected fingerprint", bare)
+	}
+}
+
+func TestHTTP2Stream(t *testing.T) {
+
+	data := testHTTP2Start()
+
+	records := collectRecordsWith(t, []Option{WithHTTP2(), WithJA4H()}, conversation(t,
+		[]byte("GET / HTTP/1.1\r\nHost: example.com\r\nConnection: Upgrade, HTTP2-Settings\r\nUpgrade: h2c\r\n\r\n"),
+		[]byte("S:HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: h2c\r\n\r\n"),
+		// preface split across segments
+		data[:10],
+		data[10:40],
+		data[40:],
+	)...)
+	if len(records) != 2 {
+		t.Fatal("expected 2 records, got", len(records))
+	}
+
+	if records[0].JA4H == "" || records[0].HTTP2 != "" {
+		t.Fatal("unexpected record", records[0].JA4H, records[0].HTTP2)
+	}
+	r := records[1]
+	if r.HTTP2 != "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p" || r.HTTP2Digest != BareToDigestHex([]byte(r.HTTP2)) || r.SourcePort != 49391 {
+		t.Fatal("unexpected record", r.HTTP2, r.HTTP2Digest, r.SourcePort)
+	}
+}
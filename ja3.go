@@ -75,18 +75,18 @@ func DigestHex(hello *tlsx.ClientHelloBasic) string {
 // This is the JA3 SSL Client Fingerprint returned by this function.
 func Bare(hello *tlsx.ClientHelloBasic) []byte {
 
-	// TODO: refactor into struct with inbuilt buffer to reduce allocations to ~ zero
-	// i.e. only realloc if previously allocated buffer is too small for current packet
-
-	var (
-		maxPossibleBufferLength = 5 + 1 + // Version = uint16 => maximum = 65536 = 5chars + 1 field sep
-			(5+1)*len(hello.CipherSuites) + // CipherSuite = uint16 => maximum = 65536 = 5chars
-			(5+1)*len(hello.AllExtensions) + // uint16 = 2B => maximum = 65536 = 5chars
-			(5+1)*len(hello.SupportedGroups) + // uint16 = 2B => maximum = 65536 = 5chars
-			(3+1)*len(hello.SupportedPoints) // uint8 = 1B => maximum = 256 = 3chars
-
-		buffer = make([]byte, 0, maxPossibleBufferLength)
-	)
+	maxPossibleBufferLength := 5 + 1 + // Version = uint16 => maximum = 65536 = 5chars + 1 field sep
+		(5+1)*len(hello.CipherSuites) + // CipherSuite = uint16 => maximum = 65536 = 5chars
+		(5+1)*len(hello.AllExtensions) + // uint16 = 2B => maximum = 65536 = 5chars
+		(5+1)*len(hello.SupportedGroups) + // uint16 = 2B => maximum = 65536 = 5chars
+		(3+1)*len(hello.SupportedPoints) // uint8 = 1B => maximum = 256 = 3chars
+
+	return AppendBare(make([]byte, 0, maxPossibleBufferLength), hello)
+}
+
+// AppendBare appends the JA3 bare string for a given tlsx.ClientHelloBasic instance to buffer
+// and returns the extended buffer. It does not allocate if buffer has enough capacity.
+func AppendBare(buffer []byte, hello *tlsx.ClientHelloBasic) []byte {
 
 	buffer = strconv.AppendInt(buffer, int64(hello.HandshakeVersion), 10)
 	buffer = append(buffer, sepFieldByte)
@@ -16,8 +16,11 @@ package ja3
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/json"
 	"io/ioutil"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/dreadl0ck/tlsx"
@@ -131,6 +134,79 @@ func TestDigestHexComparePcap(t *testing.T) {
 	}
 }
 
+func TestReadFileNDJSON(t *testing.T) {
+
+	var (
+		b        bytes.Buffer
+		expected = readTestRecords(t)
+	)
+
+	ReadFileNDJSON("test2.pcap", &b, true)
+
+	lines := strings.Split(strings.TrimSuffix(b.String(), "\n"), "\n")
+	if len(lines) != len(expected) {
+		t.Fatal("expected", len(expected), "lines, got", len(lines))
+	}
+
+	for i, line := range lines {
+		var r *Record
+		err := json.Unmarshal([]byte(line), &r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r, expected[i]) {
+			t.Fatal("line", i, "does not match the JSON output:", line)
+		}
+	}
+}
+
+func TestFingerprinter(t *testing.T) {
+
+	var (
+		fp  = NewFingerprinter()
+		dst []byte
+		sum [md5.Size]byte
+	)
+	for _, payload := range [][]byte{tlsPacket[54:], modernClientHello(), clientHelloPayload(), tlsPacket[54:]} {
+		var hello tlsx.ClientHelloBasic
+		if err := hello.Unmarshal(payload); err != nil {
+			t.Fatal(err)
+		}
+		bare := Bare(&hello)
+
+		var err error
+		if dst, err = fp.AppendBare(dst[:0], payload); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(dst, bare) {
+			t.Fatal("unexpected bare", string(dst), "expected", string(bare))
+		}
+		if err := fp.SumInto(&sum, payload); err != nil || sum != md5.Sum(bare) {
+			t.Fatal("unexpected digest", sum, err)
+		}
+		if dst, err = fp.AppendDigestHex(dst[:0], payload); err != nil || string(dst) != BareToDigestHex(bare) {
+			t.Fatal("unexpected digest", string(dst), err)
+		}
+	}
+
+	for _, n := range []int{5, 10, 60, len(tlsPacket) - 60} {
+		if err := fp.SumInto(&sum, tlsPacket[54:54+n]); err == nil {
+			t.Fatal(n, "expected an error")
+		}
+	}
+
+	payload := tlsPacket[54:]
+	dst = make([]byte, 0, 512)
+	allocs := testing.AllocsPerRun(100, func() {
+		dst, _ = fp.AppendBare(dst[:0], payload)
+		_ = fp.SumInto(&sum, payload)
+		dst, _ = fp.AppendDigestHex(dst[:0], payload)
+	})
+	if allocs != 0 {
+		t.Fatal("expected no allocations, got", allocs)
+	}
+}
+
 /*
  *	Benchmarks
  */
@@ -212,3 +288,56 @@ func BenchmarkBare(b *testing.B) {
 		Bare(hello)
 	}
 }
+
+func BenchmarkFingerprinterAppendBare(b *testing.B) {
+
+	var (
+		fp      = NewFingerprinter()
+		payload = tlsPacket[54:]
+		dst     = make([]byte, 0, 512)
+		err     error
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if dst, err = fp.AppendBare(dst[:0], payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFingerprinterSumInto(b *testing.B) {
+
+	var (
+		fp      = NewFingerprinter()
+		payload = tlsPacket[54:]
+		sum     [md5.Size]byte
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := fp.SumInto(&sum, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkFingerprinterAppendDigestHex(b *testing.B) {
+
+	var (
+		fp      = NewFingerprinter()
+		payload = tlsPacket[54:]
+		dst     = make([]byte, 0, 2*md5.Size)
+		err     error
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if dst, err = fp.AppendDigestHex(dst[:0], payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
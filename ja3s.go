@@ -45,16 +45,16 @@ func DigestHexJa3s(hello *tlsx.ServerHelloBasic) string {
 // SSLVersion,Cipher,SSLExtension
 func BareJa3s(hello *tlsx.ServerHelloBasic) []byte {
 
-	// TODO: refactor into struct with inbuilt buffer to reduce allocations to ~ zero
-	// i.e. only realloc if previously allocated buffer is too small for current packet
+	maxPossibleBufferLength := 5 + 1 + // Version = uint16 => maximum = 65536 = 5chars + 1 field sep
+		(5+1)*1 + // CipherSuite = uint16 => maximum = 65536 = 5chars
+		(5+1)*len(hello.Extensions) // uint16 = 2B => maximum = 65536 = 5chars
 
-	var (
-		maxPossibleBufferLength = 5 + 1 + // Version = uint16 => maximum = 65536 = 5chars + 1 field sep
-			(5+1)*1 + // CipherSuite = uint16 => maximum = 65536 = 5chars
-			(5+1)*len(hello.Extensions) // uint16 = 2B => maximum = 65536 = 5chars
+	return AppendBareJa3s(make([]byte, 0, maxPossibleBufferLength), hello)
+}
 
-		buffer = make([]byte, 0, maxPossibleBufferLength)
-	)
+// AppendBareJa3s appends the JA3S bare string for a given tlsx.ServerHelloBasic instance to buffer
+// and returns the extended buffer. It does not allocate if buffer has enough capacity.
+func AppendBareJa3s(buffer []byte, hello *tlsx.ServerHelloBasic) []byte {
 
 	buffer = strconv.AppendInt(buffer, int64(hello.Vers), 10)
 	buffer = append(buffer, sepFieldByte)
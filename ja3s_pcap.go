@@ -3,76 +3,68 @@
 package ja3
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"strconv"
 	"strings"
-
-	"github.com/google/gopacket"
 )
 
 // ReadFileJa3s reads the PCAP file at the given path
 // and prints out all packets containing JA3S digests to the supplied io.Writer
-func ReadFileJa3s(file string, out io.Writer) {
-
-	r, f, link, err := openPcap(file)
+// It panics on errors, use ReadFileJa3sErr to handle them.
+func ReadFileJa3s(file string, out io.Writer, opts ...Option) {
+	err := ReadFileJa3sErr(file, out, opts...)
 	if err != nil {
 		panic(err)
 	}
-	defer f.Close()
+}
 
-	count := 0
-	for {
-		// read packet data
-		data, _, err := r.ReadPacketData()
-		if err == io.EOF {
-			if Debug {
-				fmt.Println(count, "fingerprints.")
-			}
-			return
-		} else if err != nil {
-			panic(err)
-		}
+// ReadFileJa3sErr is like ReadFileJa3s, but returns errors instead of panicking.
+func ReadFileJa3sErr(file string, out io.Writer, opts ...Option) error {
 
-		var (
-			// create gopacket
-			p = gopacket.NewPacket(data, link, gopacket.Lazy)
-			// get JA3 if possible
-			digest = DigestHexPacketJa3s(p)
-		)
+	r, f, link, err := openPcap(file, newOptions(opts).keyLog)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
 
-		// check if we got a result
-		if digest != "" {
+	a := newAssembler(true, ja3sWriter(out), opts...)
+	return a.readPackets(context.Background(), file, r, link)
+}
 
-			count++
+// ReadFilesJa3sErr is like ReadFileJa3sErr, but reads all files named by the paths, see ExpandPaths.
+func ReadFilesJa3sErr(paths []string, out io.Writer, opts ...Option) error {
 
-			var (
-				b  strings.Builder
-				nl = p.NetworkLayer()
-				tl = p.TransportLayer()
-			)
+	files, err := ExpandPaths(paths...)
+	if err != nil {
+		return err
+	}
+	return readFiles(context.Background(), files, true, opts, ja3sWriter(out))
+}
 
-			// got an a digest but no transport or network layer
-			if tl == nil || nl == nil {
-				if Debug {
-					fmt.Println("got a nil layer: ", nl, tl, p.Dump(), digest)
-				}
-				continue
-			}
+// ja3sWriter returns a function that writes the server address and the JA3S of records with server fingerprints.
+func ja3sWriter(out io.Writer) func(r *Record) error {
+	return func(r *Record) error {
+		if r.JA3SDigest == "" {
+			return nil
+		}
 
-			b.WriteString("[")
-			b.WriteString(nl.NetworkFlow().Dst().String())
-			b.WriteString(":")
-			b.WriteString(tl.TransportFlow().Dst().String())
-			b.WriteString("] JA3S: ")
-			b.WriteString(string(BarePacketJa3s(p)))
-			b.WriteString(" --> ")
-			b.WriteString(digest)
-			b.WriteString("\n")
+		var b strings.Builder
 
-			_, err := out.Write([]byte(b.String()))
-			if err != nil {
-				panic(err)
-			}
+		b.WriteString("[")
+		b.WriteString(r.DestinationIP)
+		b.WriteString(":")
+		b.WriteString(strconv.Itoa(r.DestinationPort))
+		b.WriteString("] JA3S: ")
+		b.WriteString(r.JA3S)
+		b.WriteString(" --> ")
+		b.WriteString(r.JA3SDigest)
+		if r.JA4S != "" {
+			b.WriteString(" JA4S: ")
+			b.WriteString(r.JA4S)
 		}
+		b.WriteString("\n")
+
+		return write(out, []byte(b.String()))
 	}
 }
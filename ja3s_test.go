@@ -16,6 +16,7 @@ package ja3
 
 import (
 	"bytes"
+	"crypto/md5"
 	"encoding/hex"
 	"io/ioutil"
 	"log"
@@ -119,6 +120,41 @@ func TestDigestHexJa3sComparePcap(t *testing.T) {
 	}
 }
 
+func TestFingerprinterJa3s(t *testing.T) {
+
+	var (
+		p       = gopacket.NewPacket(tlsServerHelloPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+		payload = p.TransportLayer().LayerPayload()
+		fp      = NewFingerprinter()
+		sum     [md5.Size]byte
+	)
+	for _, payload := range [][]byte{payload, serverHelloPayload(t), payload} {
+		var hello tlsx.ServerHelloBasic
+		if err := hello.Unmarshal(payload); err != nil {
+			t.Fatal(err)
+		}
+		bare := BareJa3s(&hello)
+
+		dst, err := fp.AppendBareJa3s(nil, payload)
+		if err != nil || !bytes.Equal(dst, bare) {
+			t.Fatal("unexpected bare", string(dst), err, "expected", string(bare))
+		}
+		if err := fp.SumJa3sInto(&sum, payload); err != nil || sum != md5.Sum(bare) {
+			t.Fatal("unexpected digest", sum, err)
+		}
+	}
+	if _, err := fp.ServerHello(payload[:40]); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		_ = fp.SumJa3sInto(&sum, payload)
+	})
+	if allocs != 0 {
+		t.Fatal("expected no allocations, got", allocs)
+	}
+}
+
 /*
  *	Benchmarks
  */
@@ -200,3 +236,21 @@ func BenchmarkBareJa3s(b *testing.B) {
 		BareJa3s(hello)
 	}
 }
+
+func BenchmarkFingerprinterSumJa3sInto(b *testing.B) {
+
+	var (
+		p       = gopacket.NewPacket(tlsServerHelloPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+		payload = p.TransportLayer().LayerPayload()
+		fp      = NewFingerprinter()
+		sum     [md5.Size]byte
+	)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		if err := fp.SumJa3sInto(&sum, payload); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
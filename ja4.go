@@ -0,0 +1,250 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"sort"
+
+	"github.com/dreadl0ck/tlsx"
+)
+
+// Transport protocols as encoded in the first character of JA4 fingerprints.
+const (
+	JA4ProtocolTCP  = 't'
+	JA4ProtocolQUIC = 'q'
+	JA4ProtocolDTLS = 'd'
+)
+
+const (
+	sepJA4Byte = byte('_')
+
+	// hash used for empty lists
+	ja4EmptyHash = "000000000000"
+)
+
+// JA4 returns the JA4 fingerprint for a given tlsx.ClientHelloBasic instance and its decoded extensions.
+// JA4 is the successor of JA3, developed by FoxIO: https://github.com/FoxIO-LLC/ja4
+// A JA4 fingerprint consists of three sections, separated by an underscore:
+// a: protocol, TLS version, SNI (d=domain, i=ip), number of ciphers, number of extensions and first ALPN value
+// b: truncated SHA256 of the sorted list of cipher suites
+// c: truncated SHA256 of the sorted list of extensions (without SNI and ALPN), followed by the signature algorithms in their original order
+// Example:
+// t13d1516h2_8daaf6152771_02713d6af862
+// GREASE values are ignored for all sections.
+func JA4(hello *tlsx.ClientHelloBasic, ext *ClientHelloExtensions, protocol byte) string {
+	return string(ja4(hello, ext, protocol, false, false))
+}
+
+// JA4R returns the raw JA4 fingerprint (ja4_r), with the sorted lists of sections b and c in clear text.
+func JA4R(hello *tlsx.ClientHelloBasic, ext *ClientHelloExtensions, protocol byte) string {
+	return string(ja4(hello, ext, protocol, false, true))
+}
+
+// JA4O returns the JA4 fingerprint with ciphers and extensions hashed in their original order (ja4_o).
+// In contrast to JA4, SNI and ALPN are kept in the extension list.
+func JA4O(hello *tlsx.ClientHelloBasic, ext *ClientHelloExtensions, protocol byte) string {
+	return string(ja4(hello, ext, protocol, true, false))
+}
+
+// JA4RO returns the raw JA4 fingerprint with ciphers and extensions in their original order (ja4_ro).
+func JA4RO(hello *tlsx.ClientHelloBasic, ext *ClientHelloExtensions, protocol byte) string {
+	return string(ja4(hello, ext, protocol, true, true))
+}
+
+// ja4 assembles all variants of the JA4 fingerprint.
+func ja4(hello *tlsx.ClientHelloBasic, ext *ClientHelloExtensions, protocol byte, original, raw bool) []byte {
+
+	var (
+		ciphers       = make([]uint16, 0, len(hello.CipherSuites))
+		extensions    = make([]uint16, 0, len(hello.AllExtensions))
+		numExtensions int
+		sni           = byte('i')
+	)
+
+	for _, c := range hello.CipherSuites {
+		// filter GREASE values
+		if !greaseValues[uint16(c)] {
+			ciphers = append(ciphers, uint16(c))
+		}
+	}
+
+	for _, e := range hello.AllExtensions {
+		// filter GREASE values
+		if greaseValues[uint16(e)] {
+			continue
+		}
+		numExtensions++
+		if uint16(e) == extensionServerName {
+			sni = 'd'
+		}
+		if !original && (uint16(e) == extensionServerName || uint16(e) == extensionALPN) {
+			continue
+		}
+		extensions = append(extensions, uint16(e))
+	}
+
+	if !original {
+		sortUint16s(ciphers)
+		sortUint16s(extensions)
+	}
+
+	version := uint16(hello.HandshakeVersion)
+	if v := highestVersion(ext.SupportedVersions); v != 0 {
+		version = v
+	}
+
+	/*
+	 *	a: protocol, version, sni, cipher count, extension count, alpn
+	 */
+
+	buffer := make([]byte, 0, 64)
+	buffer = append(buffer, protocol)
+	buffer = append(buffer, ja4Version(version)...)
+	buffer = append(buffer, sni)
+	buffer = appendCount(buffer, len(ciphers))
+	buffer = appendCount(buffer, numExtensions)
+	buffer = appendALPN(buffer, ext.ALPNs)
+	buffer = append(buffer, sepJA4Byte)
+
+	/*
+	 *	b: ciphers
+	 */
+
+	buffer = appendSection(buffer, appendHexList(nil, ciphers), raw)
+	buffer = append(buffer, sepJA4Byte)
+
+	/*
+	 *	c: extensions and signature algorithms
+	 */
+
+	var c []byte
+	if len(extensions) > 0 || len(ext.SignatureAlgorithms) > 0 {
+		c = appendHexList(c, extensions)
+		if len(ext.SignatureAlgorithms) > 0 {
+			c = append(c, sepJA4Byte)
+			c = appendHexList(c, ext.SignatureAlgorithms)
+		}
+	}
+
+	return appendSection(buffer, c, raw)
+}
+
+// highestVersion returns the highest non GREASE version of the supported_versions extension.
+func highestVersion(versions []uint16) uint16 {
+	var highest uint16
+	for _, v := range versions {
+		if !greaseValues[v] && ja4VersionRank(v) > ja4VersionRank(highest) {
+			highest = v
+		}
+	}
+	return highest
+}
+
+// ja4VersionRank orders versions so that DTLS versions (which count downwards) compare correctly to TLS versions.
+func ja4VersionRank(v uint16) int {
+	if v >= 0xfe00 {
+		return int(0xffff - v)
+	}
+	return int(v)
+}
+
+// ja4Version returns the two character version identifier.
+func ja4Version(v uint16) string {
+	switch v {
+	case 0x0304:
+		return "13"
+	case 0x0303:
+		return "12"
+	case 0x0302:
+		return "11"
+	case 0x0301:
+		return "10"
+	case 0x0300:
+		return "s3"
+	case 0x0002:
+		return "s2"
+	case 0xfeff:
+		return "d1"
+	case 0xfefd:
+		return "d2"
+	case 0xfefc:
+		return "d3"
+	}
+	return "00"
+}
+
+// appendCount appends a two digit count, capped at 99.
+func appendCount(buffer []byte, n int) []byte {
+	if n > 99 {
+		n = 99
+	}
+	return append(buffer, byte('0'+n/10), byte('0'+n%10))
+}
+
+// appendALPN appends the first and last character of the first ALPN value,
+// or the first and last character of its hex representation if these are not alphanumeric.
+func appendALPN(buffer []byte, alpns []string) []byte {
+	if len(alpns) == 0 || len(alpns[0]) == 0 {
+		return append(buffer, '0', '0')
+	}
+	alpn := alpns[0]
+	first, last := alpn[0], alpn[len(alpn)-1]
+	if !isAlphanumeric(first) || !isAlphanumeric(last) {
+		h := hex.EncodeToString([]byte(alpn))
+		return append(buffer, h[0], h[len(h)-1])
+	}
+	return append(buffer, first, last)
+}
+
+func isAlphanumeric(c byte) bool {
+	return (c >= '0' && c <= '9') || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z')
+}
+
+// appendSection appends a section either raw or as truncated SHA256 hash.
+func appendSection(buffer []byte, section []byte, raw bool) []byte {
+	if raw {
+		return append(buffer, section...)
+	}
+	if len(section) == 0 {
+		return append(buffer, ja4EmptyHash...)
+	}
+	return append(buffer, truncatedHash(section)...)
+}
+
+// truncatedHash returns the first 12 hex characters of the SHA256 hash of data.
+func truncatedHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:6])
+}
+
+// appendHexList appends the values as comma separated four character hex strings.
+func appendHexList(buffer []byte, values []uint16) []byte {
+	const digits = "0123456789abcdef"
+	for i, v := range values {
+		if i > 0 {
+			buffer = append(buffer, sepFieldByte)
+		}
+		buffer = append(buffer, digits[v>>12], digits[v>>8&0xf], digits[v>>4&0xf], digits[v&0xf])
+	}
+	return buffer
+}
+
+func sortUint16s(values []uint16) {
+	sort.Slice(values, func(i, j int) bool {
+		return values[i] < values[j]
+	})
+}
@@ -0,0 +1,195 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"testing"
+
+	"github.com/dreadl0ck/tlsx"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// tlsExtension is a raw extension used to build test hellos.
+type tlsExtension struct {
+	typ  uint16
+	data []byte
+}
+
+// clientHelloRecord builds a TLS record carrying a client hello with the given ciphers and extensions.
+func clientHelloRecord(ciphers []uint16, extensions []tlsExtension) []byte {
+
+	body := []byte{0x03, 0x03}
+	body = append(body, make([]byte, 32)...) // random
+	body = append(body, 0)                   // session id
+
+	body = appendUint16(body, uint16(2*len(ciphers)))
+	for _, c := range ciphers {
+		body = appendUint16(body, c)
+	}
+	body = append(body, 1, 0) // compression methods
+
+	var ext []byte
+	for _, e := range extensions {
+		ext = appendUint16(ext, e.typ)
+		ext = appendUint16(ext, uint16(len(e.data)))
+		ext = append(ext, e.data...)
+	}
+	body = appendUint16(body, uint16(len(ext)))
+	body = append(body, ext...)
+
+	msg := []byte{handshakeTypeClientHello, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}
+	return handshakeRecord(0x0301, append(msg, body...))
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	var tmp [2]byte
+	binary.BigEndian.PutUint16(tmp[:], v)
+	return append(b, tmp[:]...)
+}
+
+// modernClientHello returns a TLS 1.3 client hello including GREASE values, SNI and ALPN.
+func modernClientHello() []byte {
+	return clientHelloRecord(
+		[]uint16{0x0a0a, 0x1302, 0x1301},
+		[]tlsExtension{
+			{typ: 0x1a1a},
+			{typ: extensionServerName, data: []byte{0x00, 0x0e, 0x00, 0x00, 0x0b, 'e', 'x', 'a', 'm', 'p', 'l', 'e', '.', 'c', 'o', 'm'}},
+			{typ: extensionALPN, data: []byte{0x00, 0x0c, 0x02, 'h', '2', 0x08, 'h', 't', 't', 'p', '/', '1', '.', '1'}},
+			{typ: extensionSupportedVersions, data: []byte{0x06, 0x2a, 0x2a, 0x03, 0x04, 0x03, 0x03}},
+			{typ: extensionSignatureAlgorithms, data: []byte{0x00, 0x04, 0x04, 0x03, 0x08, 0x04}},
+		},
+	)
+}
+
+func decodeClientHello(t *testing.T, record []byte) (*tlsx.ClientHelloBasic, *ClientHelloExtensions) {
+	var (
+		hello tlsx.ClientHelloBasic
+		ext   ClientHelloExtensions
+	)
+	if err := hello.Unmarshal(record); err != nil {
+		t.Fatal(err)
+	}
+	if err := ext.Unmarshal(record); err != nil {
+		t.Fatal(err)
+	}
+	return &hello, &ext
+}
+
+/*
+ *	Tests
+ */
+
+func TestJA4Correct(t *testing.T) {
+
+	hello, ext := decodeClientHello(t, clientHelloPayload())
+
+	tests := []struct {
+		name, got, want string
+	}{
+		{"ja4", JA4(hello, ext, JA4ProtocolTCP), "t12d210500_b973bfd88a0e_677eed04e9fb"},
+		{"ja4_r", JA4R(hello, ext, JA4ProtocolTCP), "t12d210500_0004,0005,000a,0013,002f,0032,0035,0038,003c,003d,0040,006a,c009,c00a,c013,c014,c023,c024,c027,c02b,c02c_000a,000b,000d,ff01_0401,0501,0201,0403,0503,0203,0202"},
+		{"ja4_o", JA4O(hello, ext, JA4ProtocolTCP), "t12d210500_a30e4f8964b6_3e8c75fa6da8"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Fatal(test.name, test.got, "!=", test.want)
+		}
+	}
+}
+
+func TestJA4GreaseALPNAndSupportedVersions(t *testing.T) {
+
+	hello, ext := decodeClientHello(t, modernClientHello())
+
+	if got := JA4(hello, ext, JA4ProtocolTCP); got != "t13d0204h2_62ed6f6ca7ad_ef5f37ab036a" {
+		t.Fatal(got, "!=", "t13d0204h2_62ed6f6ca7ad_ef5f37ab036a")
+	}
+	if got := JA4O(hello, ext, JA4ProtocolQUIC); got != "q13d0204h2_dab8922e3c39_b4975639b335" {
+		t.Fatal(got, "!=", "q13d0204h2_dab8922e3c39_b4975639b335")
+	}
+}
+
+func TestJA4ALPNNonAlphanumeric(t *testing.T) {
+	if got := string(appendALPN(nil, []string{"\xab\x01"})); got != "a1" {
+		t.Fatal(got, "!=", "a1")
+	}
+	if got := string(appendALPN(nil, nil)); got != "00" {
+		t.Fatal(got, "!=", "00")
+	}
+}
+
+func TestJA4Packet(t *testing.T) {
+
+	p := gopacket.NewPacket(tlsPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+
+	if got := JA4Packet(p); got != "t12d210500_b973bfd88a0e_677eed04e9fb" {
+		t.Fatal(got, "!=", "t12d210500_b973bfd88a0e_677eed04e9fb")
+	}
+}
+
+func TestReadFileJSONWithJA4(t *testing.T) {
+
+	var (
+		b       bytes.Buffer
+		records []*Record
+	)
+
+	ReadFileJSON("test2.pcap", &b, false, WithJA4())
+
+	err := json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatal("expected records")
+	}
+
+	for _, r := range records {
+		if r.JA4 == "" || r.JA4R == "" || r.JA4O == "" {
+			t.Fatal("missing JA4 for record", r.JA3Digest)
+		}
+		if r.JA4[0] != JA4ProtocolTCP || r.JA4[:10] != r.JA4R[:10] {
+			t.Fatal("unexpected JA4", r.JA4, r.JA4R)
+		}
+	}
+}
+
+/*
+ *	Benchmarks
+ */
+
+func BenchmarkJA4(b *testing.B) {
+	var (
+		p     = gopacket.NewPacket(tlsPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+		hello = getHello(p, b)
+		ext   ClientHelloExtensions
+	)
+	if err := ext.Unmarshal(clientHelloPayload()); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		JA4(hello, &ext, JA4ProtocolTCP)
+	}
+}
@@ -0,0 +1,239 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoHTTPRequest is returned if the payload does not start with an HTTP/1.x request line.
+var ErrNoHTTPRequest = errors.New("payload is not an HTTP/1.x request")
+
+// HTTPHeader is a header field of an HTTP request, with the name in its original case.
+type HTTPHeader struct {
+	Name  string
+	Value string
+}
+
+// HTTPRequest contains the request line and header fields of an HTTP/1.x request.
+type HTTPRequest struct {
+	Method  string
+	Target  string
+	Version string
+	Headers []HTTPHeader
+}
+
+// Unmarshal decodes the request line and header fields of an HTTP/1.x request,
+// the payload must contain the complete header, up to the empty line.
+// Lines can be terminated by CRLF or LF, obsolete line folding is not supported.
+func (r *HTTPRequest) Unmarshal(payload []byte) error {
+
+	*r = HTTPRequest{}
+
+	end := httpHeaderEnd(payload)
+	if end < 0 {
+		return ErrNoHTTPRequest
+	}
+	lines := strings.Split(strings.Replace(string(payload[:end]), "\r\n", "\n", -1), "\n")
+
+	// METHOD SP request-target SP HTTP-version
+	fields := strings.Split(lines[0], " ")
+	if len(fields) != 3 || !strings.HasPrefix(fields[2], "HTTP/1.") || !isHTTPMethod(fields[0]) {
+		return ErrNoHTTPRequest
+	}
+	r.Method, r.Target, r.Version = fields[0], fields[1], fields[2]
+
+	for _, line := range lines[1:] {
+		if line == "" {
+			break
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return ErrNoHTTPRequest
+		}
+		r.Headers = append(r.Headers, HTTPHeader{
+			Name:  line[:i],
+			Value: strings.TrimSpace(line[i+1:]),
+		})
+	}
+	return nil
+}
+
+// Header returns the value of the first header field with the name, which is matched case insensitively.
+func (r *HTTPRequest) Header(name string) string {
+	for _, h := range r.Headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+// Cookies returns the cookies of all Cookie header fields as name=value pairs.
+func (r *HTTPRequest) Cookies() []string {
+	var cookies []string
+	for _, h := range r.Headers {
+		if !strings.EqualFold(h.Name, "Cookie") {
+			continue
+		}
+		for _, c := range strings.Split(h.Value, ";") {
+			if c = strings.TrimSpace(c); c != "" {
+				cookies = append(cookies, c)
+			}
+		}
+	}
+	return cookies
+}
+
+// httpMethods are the request methods of HTTP/1.x, see RFC 7231 and RFC 5789.
+var httpMethods = []string{"GET", "POST", "PUT", "HEAD", "DELETE", "OPTIONS", "CONNECT", "PATCH", "TRACE"}
+
+func isHTTPMethod(method string) bool {
+	for _, m := range httpMethods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// isHTTPRequest checks whether data starts with the method of an HTTP request.
+func isHTTPRequest(data []byte) bool {
+	i := bytes.IndexByte(data, ' ')
+	return i > 0 && isHTTPMethod(string(data[:i]))
+}
+
+// httpHeaderEnd returns the length of the header of an HTTP message including the empty line, or -1 if it is incomplete.
+func httpHeaderEnd(data []byte) int {
+	for i := 0; ; {
+		j := bytes.IndexByte(data[i:], '\n')
+		if j < 0 {
+			return -1
+		}
+		line := data[i : i+j]
+		i += j + 1
+		if len(line) == 0 || (len(line) == 1 && line[0] == '\r') {
+			return i
+		}
+	}
+}
+
+// JA4H returns the JA4H fingerprint of an HTTP request, developed by FoxIO: https://github.com/FoxIO-LLC/ja4
+// A JA4H fingerprint consists of four sections, separated by an underscore:
+// a: method, HTTP version, cookie (c or n), referer (r or n), number of header fields and the first accepted language
+// b: truncated SHA256 of the header field names in their original order, without Cookie and Referer
+// c: truncated SHA256 of the sorted cookie names
+// d: truncated SHA256 of the sorted cookies with their values
+// Example of section a for a GET request over HTTP/1.1 with cookies, without referer, with 11 other header fields
+// and Accept-Language en-US: ge11cn11enus
+func JA4H(req *HTTPRequest) string {
+	return string(ja4h(req, false))
+}
+
+// JA4HR returns the raw JA4H fingerprint (ja4h_r), with the lists of sections b, c and d in clear text.
+func JA4HR(req *HTTPRequest) string {
+	return string(ja4h(req, true))
+}
+
+func ja4h(req *HTTPRequest, raw bool) []byte {
+
+	var (
+		buffer  = make([]byte, 0, 64)
+		names   []byte
+		count   int
+		cookie  = byte('n')
+		referer = byte('n')
+	)
+
+	method := strings.ToLower(req.Method)
+	if len(method) > 2 {
+		method = method[:2]
+	}
+	buffer = append(buffer, method...)
+
+	// HTTP/1.1 -> 11
+	version := strings.Replace(strings.TrimPrefix(req.Version, "HTTP/"), ".", "", -1)
+	buffer = append(buffer, (version + "00")[:2]...)
+
+	for _, h := range req.Headers {
+		switch {
+		case strings.EqualFold(h.Name, "Cookie"):
+			cookie = 'c'
+			continue
+		case strings.EqualFold(h.Name, "Referer"):
+			referer = 'r'
+			continue
+		}
+		if count > 0 {
+			names = append(names, sepFieldByte)
+		}
+		names = append(names, h.Name...)
+		count++
+	}
+	buffer = append(buffer, cookie, referer)
+	buffer = appendCount(buffer, count)
+	buffer = append(buffer, ja4hLanguage(req.Header("Accept-Language"))...)
+
+	var (
+		cookies     = req.Cookies()
+		cookieNames = make([]string, len(cookies))
+	)
+	for i, c := range cookies {
+		cookieNames[i] = c
+		if j := strings.IndexByte(c, '='); j >= 0 {
+			cookieNames[i] = c[:j]
+		}
+	}
+	sort.Strings(cookies)
+	sort.Strings(cookieNames)
+
+	buffer = append(buffer, sepJA4Byte)
+	buffer = appendSection(buffer, names, raw)
+	buffer = append(buffer, sepJA4Byte)
+	buffer = appendSection(buffer, []byte(strings.Join(cookieNames, ",")), raw)
+	buffer = append(buffer, sepJA4Byte)
+	return appendSection(buffer, []byte(strings.Join(cookies, ",")), raw)
+}
+
+// ja4hLanguage returns the first four characters of the first accepted language without hyphens,
+// padded with zeros, e.g. enus for en-US,en;q=0.9.
+func ja4hLanguage(value string) string {
+	lang := strings.ToLower(strings.Replace(value, "-", "", -1))
+	if i := strings.IndexAny(lang, ",;"); i >= 0 {
+		lang = lang[:i]
+	}
+	lang = strings.TrimSpace(lang)
+	return (lang + "0000")[:4]
+}
+
+// httpContentLength returns the length of the body of a request, or -1 if it is unknown, e.g. for chunked encoding.
+func httpContentLength(req *HTTPRequest) int {
+	if req.Header("Transfer-Encoding") != "" {
+		return -1
+	}
+	v := req.Header("Content-Length")
+	if v == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 0 {
+		return -1
+	}
+	return n
+}
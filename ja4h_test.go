@@ -0,0 +1,114 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"testing"
+)
+
+const testHTTPRequest = "GET /index.html HTTP/1.1\r\n" +
+	"Host: www.example.com\r\n" +
+	"User-Agent: Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0\r\n" +
+	"Accept: text/html\r\n" +
+	"Accept-Language: en-US,en;q=0.5\r\n" +
+	"Referer: http://www.example.com/\r\n" +
+	"Cookie: session=abc; _ga=GA1.2\r\n" +
+	"Connection: keep-alive\r\n" +
+	"\r\n"
+
+/*
+ *	Tests
+ */
+
+func TestJA4H(t *testing.T) {
+
+	var req HTTPRequest
+	if err := req.Unmarshal([]byte(testHTTPRequest)); err != nil {
+		t.Fatal(err)
+	}
+	if req.Method != "GET" || req.Version != "HTTP/1.1" || len(req.Headers) != 7 {
+		t.Fatal("unexpected request", req)
+	}
+
+	var (
+		names   = "Host,User-Agent,Accept,Accept-Language,Connection"
+		cookies = "_ga,session"
+		values  = "_ga=GA1.2,session=abc"
+	)
+	if raw := JA4HR(&req); raw != "ge11cr05enus_"+names+"_"+cookies+"_"+values {
+		t.Fatal("unexpected ja4h_r", raw)
+	}
+	expected := "ge11cr05enus_" + truncatedHash([]byte(names)) + "_" + truncatedHash([]byte(cookies)) + "_" + truncatedHash([]byte(values))
+	if ja4h := JA4H(&req); ja4h != expected {
+		t.Fatal("unexpected ja4h", ja4h)
+	}
+
+	// without cookies, referer and language
+	if err := req.Unmarshal([]byte("POST /api HTTP/1.0\nHost: example.com\n\n")); err != nil {
+		t.Fatal(err)
+	}
+	if ja4h := JA4H(&req); ja4h != "po10nn010000_"+truncatedHash([]byte("Host"))+"_000000000000_000000000000" {
+		t.Fatal("unexpected ja4h", ja4h)
+	}
+
+	for _, invalid := range []string{
+		"HTTP/1.1 200 OK\r\n\r\n",
+		"GET / HTTP/1.1\r\nHost: example.com\r\n",
+		"GET / HTTP/1.1\r\nno header\r\n\r\n",
+	} {
+		if err := req.Unmarshal([]byte(invalid)); err != ErrNoHTTPRequest {
+			t.Fatal("expected ErrNoHTTPRequest, got", err)
+		}
+	}
+}
+
+func TestJA4HStream(t *testing.T) {
+
+	var (
+		request = []byte(testHTTPRequest)
+		post    = []byte("POST /upload HTTP/1.1\r\nHost: www.example.com\r\nContent-Length: 11\r\n\r\nGET / HTTP/")
+		chunked = []byte("PUT /upload HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nGET /\r\n0\r\n\r\n")
+	)
+
+	records := collectRecordsWith(t, []Option{WithJA4H()}, conversation(t,
+		// header split across segments
+		request[:50],
+		request[50:],
+		[]byte("S:HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n"),
+		// body that looks like a request, followed by a request in the same segment
+		post[:len(post)-5],
+		append(post[len(post)-5:], request...),
+		// requests after a body of unknown length are not fingerprinted
+		chunked,
+		request,
+	)...)
+	if len(records) != 4 {
+		t.Fatal("expected 4 records, got", len(records))
+	}
+
+	r := records[0]
+	if r.JA4H[:12] != "ge11cr05enus" || r.HTTPMethod != "GET" || r.HTTPVersion != "HTTP/1.1" || !r.HTTPCookie || r.SourcePort != 49391 {
+		t.Fatal("unexpected record", r.JA4H, r.HTTPMethod, r.HTTPVersion, r.HTTPCookie, r.SourcePort)
+	}
+	if r.AcceptLanguage != "en-US,en;q=0.5" || r.UserAgent != "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0" {
+		t.Fatal("unexpected record", r.AcceptLanguage, r.UserAgent)
+	}
+
+	for i, method := range []string{"GET", "POST", "GET", "PUT"} {
+		if records[i].HTTPMethod != method {
+			t.Fatal(i, "unexpected method", records[i].HTTPMethod)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"github.com/dreadl0ck/tlsx"
+)
+
+// JA4S returns the JA4S fingerprint for a given tlsx.ServerHelloBasic instance and its decoded extensions.
+// JA4S is the JA4 fingerprint for the server side of the TLS communication.
+// A JA4S fingerprint consists of three sections, separated by an underscore:
+// a: protocol, TLS version, number of extensions and chosen ALPN value
+// b: chosen cipher suite in hex
+// c: truncated SHA256 of the extensions in their original order
+// Example:
+// t130200_1301_a56c5b993250
+func JA4S(hello *tlsx.ServerHelloBasic, ext *ServerHelloExtensions, protocol byte) string {
+	return string(ja4s(hello, ext, protocol, false))
+}
+
+// JA4SR returns the raw JA4S fingerprint (ja4s_r), with the list of extensions in clear text.
+func JA4SR(hello *tlsx.ServerHelloBasic, ext *ServerHelloExtensions, protocol byte) string {
+	return string(ja4s(hello, ext, protocol, true))
+}
+
+// ja4s assembles the JA4S fingerprint.
+func ja4s(hello *tlsx.ServerHelloBasic, ext *ServerHelloExtensions, protocol byte, raw bool) []byte {
+
+	extensions := make([]uint16, 0, len(hello.Extensions))
+	for _, e := range hello.Extensions {
+		extensions = append(extensions, uint16(e))
+	}
+
+	version := uint16(hello.Vers)
+	if ext.SelectedVersion != 0 {
+		version = ext.SelectedVersion
+	}
+
+	var alpns []string
+	if ext.ALPN != "" {
+		alpns = []string{ext.ALPN}
+	}
+
+	/*
+	 *	a: protocol, version, extension count, alpn
+	 */
+
+	buffer := make([]byte, 0, 32)
+	buffer = append(buffer, protocol)
+	buffer = append(buffer, ja4Version(version)...)
+	buffer = appendCount(buffer, len(extensions))
+	buffer = appendALPN(buffer, alpns)
+	buffer = append(buffer, sepJA4Byte)
+
+	/*
+	 *	b: cipher
+	 */
+
+	buffer = appendHexList(buffer, []uint16{uint16(hello.CipherSuite)})
+	buffer = append(buffer, sepJA4Byte)
+
+	/*
+	 *	c: extensions
+	 */
+
+	return appendSection(buffer, appendHexList(nil, extensions), raw)
+}
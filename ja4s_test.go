@@ -0,0 +1,85 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/dreadl0ck/tlsx"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+/*
+ *	Tests
+ */
+
+func TestJA4SCorrect(t *testing.T) {
+
+	p := gopacket.NewPacket(tlsServerHelloPacket, layers.LinkTypeEthernet, gopacket.Lazy)
+	if p.ErrorLayer() != nil {
+		t.Fatal(p.ErrorLayer().Error())
+	}
+
+	if got := JA4SPacket(p); got != "t1204h2_c02f_80211cf3fcd0" {
+		t.Fatal(got, "!=", "t1204h2_c02f_80211cf3fcd0")
+	}
+
+	var (
+		payload = p.Layer(layers.LayerTypeTCP).LayerPayload()
+		hello   tlsx.ServerHelloBasic
+		ext     ServerHelloExtensions
+	)
+	if err := hello.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	if err := ext.Unmarshal(payload); err != nil {
+		t.Fatal(err)
+	}
+	if got := JA4SR(&hello, &ext, JA4ProtocolTCP); got != "t1204h2_c02f_0017,ff01,000b,0010" {
+		t.Fatal(got, "!=", "t1204h2_c02f_0017,ff01,000b,0010")
+	}
+}
+
+func TestReadFileJSONWithJA4S(t *testing.T) {
+
+	var (
+		b       bytes.Buffer
+		records []*Record
+		servers int
+	)
+
+	ReadFileJSON("test2.pcap", &b, true, WithJA4())
+
+	err := json.Unmarshal(b.Bytes(), &records)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range records {
+		if r.JA3SDigest == "" {
+			continue
+		}
+		servers++
+		if r.JA4S == "" || r.JA4SR == "" || r.JA4 != "" {
+			t.Fatal("unexpected JA4 values for server record", r.JA4S, r.JA4SR, r.JA4)
+		}
+	}
+	if servers == 0 {
+		t.Fatal("expected server records")
+	}
+}
@@ -0,0 +1,79 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"encoding/binary"
+	"strconv"
+
+	"github.com/google/gopacket/layers"
+)
+
+// JA4T returns the JA4T fingerprint of a TCP SYN, or the JA4TS fingerprint of a SYN-ACK,
+// which describe the TCP stack of the client or server.
+// The fingerprint consists of four sections, separated by an underscore:
+// a: the window size
+// b: the kinds of the TCP options in their original order, separated by "-"
+// c: the maximum segment size
+// d: the window scale
+// Missing options and values are encoded as 00, e.g. 1024_2_1460_00.
+func JA4T(tcp *layers.TCP) string {
+
+	var (
+		buffer    = make([]byte, 0, 48)
+		mss       = -1
+		scale     = -1
+		hasOption bool
+	)
+
+	buffer = strconv.AppendUint(buffer, uint64(tcp.Window), 10)
+	buffer = append(buffer, '_')
+	for _, o := range tcp.Options {
+		if hasOption {
+			buffer = append(buffer, '-')
+		}
+		hasOption = true
+		buffer = strconv.AppendUint(buffer, uint64(o.OptionType), 10)
+
+		switch o.OptionType {
+		case layers.TCPOptionKindMSS:
+			if len(o.OptionData) == 2 {
+				mss = int(binary.BigEndian.Uint16(o.OptionData))
+			}
+		case layers.TCPOptionKindWindowScale:
+			if len(o.OptionData) == 1 {
+				scale = int(o.OptionData[0])
+			}
+		}
+	}
+	if !hasOption {
+		buffer = append(buffer, "00"...)
+	}
+
+	buffer = append(buffer, '_')
+	buffer = appendOptional(buffer, mss)
+	buffer = append(buffer, '_')
+	return string(appendOptional(buffer, scale))
+}
+
+// appendOptional appends the decimal value, or 00 if it is negative.
+func appendOptional(buffer []byte, v int) []byte {
+	if v < 0 {
+		return append(buffer, "00"...)
+	}
+	return strconv.AppendInt(buffer, int64(v), 10)
+}
@@ -0,0 +1,181 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// linuxSYNOptions are the TCP options of a SYN sent by Linux: MSS, SACK permitted, timestamps, NOP and window scale.
+var linuxSYNOptions = []layers.TCPOption{
+	{OptionType: layers.TCPOptionKindMSS, OptionLength: 4, OptionData: []byte{0x05, 0xb4}},
+	{OptionType: layers.TCPOptionKindSACKPermitted, OptionLength: 2},
+	{OptionType: layers.TCPOptionKindTimestamps, OptionLength: 10, OptionData: []byte{0, 0, 0x12, 0x34, 0, 0, 0, 0}},
+	{OptionType: layers.TCPOptionKindNop, OptionLength: 1},
+	{OptionType: layers.TCPOptionKindWindowScale, OptionLength: 3, OptionData: []byte{7}},
+}
+
+// synPacket serializes a SYN with the options between the endpoints used by tcpPacket,
+// or a SYN-ACK in the opposite direction if reply is set.
+func synPacket(t testing.TB, reply bool, seq uint32, window uint16, options []layers.TCPOption) gopacket.Packet {
+
+	var (
+		eth = &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a},
+			DstMAC:       net.HardwareAddr{0x68, 0x7f, 0x74, 0xd6, 0x95, 0xc1},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip = &layers.IPv4{
+			Version:  4,
+			TTL:      62,
+			Id:       0x1234,
+			Flags:    layers.IPv4DontFragment,
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    net.IP{192, 168, 1, 14},
+			DstIP:    net.IP{23, 23, 97, 184},
+		}
+		tcp = &layers.TCP{
+			SrcPort: 49391,
+			DstPort: 443,
+			Seq:     seq,
+			SYN:     true,
+			Window:  window,
+			Options: options,
+		}
+		buf = gopacket.NewSerializeBuffer()
+	)
+
+	if reply {
+		eth.SrcMAC, eth.DstMAC = eth.DstMAC, eth.SrcMAC
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+		tcp.ACK = true
+		tcp.Ack = 1001
+	}
+
+	err := tcp.SetNetworkLayerForChecksum(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, tcp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+}
+
+const testP0f = `
+; comments and other sections are ignored
+[mtu]
+label = Ethernet or modem
+sig   = 1500
+
+[tcp:request]
+label = g:unix:Linux:generic
+sig   = *:64:0:*:*,*:mss,sok,ts,nop,ws:df,id+:0
+
+label = s:unix:Linux:3.11 and newer
+sig   = *:64:0:*:mss*20,10:mss,sok,ts,nop,ws:df,id+:0
+sig   = *:64:0:*:mss*44,7:mss,sok,ts,nop,ws:df,id+:0
+
+[tcp:response]
+label = s:unix:Linux:3.x
+sig   = *:64:0:*:%8,0:mss:df,id+:0
+`
+
+/*
+ *	Tests
+ */
+
+func TestJA4T(t *testing.T) {
+
+	if ja4t := JA4TPacket(synPacket(t, false, 1000, 64240, linuxSYNOptions)); ja4t != "64240_2-4-8-1-3_1460_7" {
+		t.Fatal("unexpected ja4t", ja4t)
+	}
+	if ja4t := JA4TPacket(synPacket(t, true, 5000, 1024, linuxSYNOptions[:1])); ja4t != "1024_2_1460_00" {
+		t.Fatal("unexpected ja4ts", ja4t)
+	}
+	if ja4t := JA4TPacket(synPacket(t, false, 1000, 512, nil)); ja4t != "512_00_00_00" {
+		t.Fatal("unexpected ja4t", ja4t)
+	}
+	if ja4t := JA4TPacket(tcpPacket(t, false, 1001, false, clientHelloPayload())); ja4t != "" {
+		t.Fatal("unexpected ja4t", ja4t)
+	}
+}
+
+func TestP0f(t *testing.T) {
+
+	var db P0fDatabase
+	if err := db.Load(strings.NewReader(testP0f)); err != nil {
+		t.Fatal(err)
+	}
+	if db.Len() != 4 {
+		t.Fatal("expected 4 signatures, got", db.Len())
+	}
+
+	tests := []struct {
+		packet gopacket.Packet
+		label  string
+	}{
+		// the specific signature is preferred
+		{synPacket(t, false, 1000, 64240, linuxSYNOptions), "Linux 3.11 and newer"},
+		{synPacket(t, false, 1000, 29200, linuxSYNOptions), "Linux generic"},
+		{synPacket(t, false, 1000, 64240, linuxSYNOptions[:1]), ""},
+		{synPacket(t, true, 5000, 64000, linuxSYNOptions[:1]), "Linux 3.x"},
+		{synPacket(t, true, 5000, 64001, linuxSYNOptions[:1]), ""},
+	}
+	for i, test := range tests {
+		if label := db.Match(test.packet); label != test.label {
+			t.Fatal(i, "unexpected label", label)
+		}
+	}
+
+	if err := db.Load(strings.NewReader("[tcp:request]\nlabel = s:unix:Linux:x\nsig = *:64:0:*:*,*:mss:bogus:0\n")); err == nil {
+		t.Fatal("expected an error for the unknown quirk")
+	}
+}
+
+func TestJA4TStream(t *testing.T) {
+
+	var db P0fDatabase
+	if err := db.Load(strings.NewReader(testP0f)); err != nil {
+		t.Fatal(err)
+	}
+
+	records := collectRecordsWith(t, []Option{WithJA4T(), WithP0f(&db), WithPairing(DefaultPairTimeout)},
+		synPacket(t, false, 1000, 64240, linuxSYNOptions),
+		synPacket(t, true, 5000, 64000, linuxSYNOptions[:1]),
+		tcpPacket(t, false, 1001, false, clientHelloPayload()),
+		tcpPacket(t, true, 5001, false, serverHelloPayload(t)),
+	)
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+
+	r := records[0]
+	if r.JA3Digest == "" || r.JA4T != "64240_2-4-8-1-3_1460_7" || r.JA4TS != "64000_2_1460_00" {
+		t.Fatal("unexpected tcp fingerprints", r.JA4T, r.JA4TS)
+	}
+	if r.P0f != "Linux 3.11 and newer" || r.P0fServer != "Linux 3.x" {
+		t.Fatal("unexpected p0f labels", r.P0f, r.P0fServer)
+	}
+}
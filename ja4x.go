@@ -0,0 +1,179 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// Certificate describes a certificate of the chain sent by a server.
+type Certificate struct {
+	JA4X      string    `json:"ja4x"`
+	Subject   string    `json:"subject"`
+	Issuer    string    `json:"issuer"`
+	NotBefore time.Time `json:"not_before"`
+	NotAfter  time.Time `json:"not_after"`
+	SHA1      string    `json:"sha1"`
+	SHA256    string    `json:"sha256"`
+}
+
+// NewCertificate returns the JA4X fingerprint and metadata of a certificate.
+func NewCertificate(cert *x509.Certificate) *Certificate {
+	var (
+		s1   = sha1.Sum(cert.Raw)
+		s256 = sha256.Sum256(cert.Raw)
+	)
+	return &Certificate{
+		JA4X:      JA4X(cert),
+		Subject:   cert.Subject.String(),
+		Issuer:    cert.Issuer.String(),
+		NotBefore: cert.NotBefore.UTC(),
+		NotAfter:  cert.NotAfter.UTC(),
+		SHA1:      hex.EncodeToString(s1[:]),
+		SHA256:    hex.EncodeToString(s256[:]),
+	}
+}
+
+// JA4X returns the JA4X fingerprint of a certificate, which describes how it was generated rather than its values.
+// A JA4X fingerprint consists of three truncated SHA256 hashes, separated by an underscore:
+// a: the OIDs of the issuer RDNs
+// b: the OIDs of the subject RDNs
+// c: the OIDs of the extensions
+// The OIDs are hex encoded in their DER form and kept in their original order.
+func JA4X(cert *x509.Certificate) string {
+
+	extensions := make([][]byte, 0, len(cert.Extensions))
+	for _, e := range cert.Extensions {
+		extensions = append(extensions, oidBytes(e.Id))
+	}
+
+	buffer := make([]byte, 0, 38)
+	buffer = appendSection(buffer, hexList(rdnOIDs(cert.RawIssuer)), false)
+	buffer = append(buffer, '_')
+	buffer = appendSection(buffer, hexList(rdnOIDs(cert.RawSubject)), false)
+	buffer = append(buffer, '_')
+	return string(appendSection(buffer, hexList(extensions), false))
+}
+
+// rdnAttribute is an attribute of a relative distinguished name, with the raw bytes of its type.
+type rdnAttribute struct {
+	Type  asn1.RawValue
+	Value asn1.RawValue
+}
+
+// rdnAttributeSET is decoded as SET OF by encoding/asn1 due to its name.
+type rdnAttributeSET []rdnAttribute
+
+// rdnOIDs returns the encoded OIDs of the attributes of a DER encoded distinguished name.
+func rdnOIDs(name []byte) [][]byte {
+	var rdns []rdnAttributeSET
+	if _, err := asn1.Unmarshal(name, &rdns); err != nil {
+		return nil
+	}
+
+	var oids [][]byte
+	for _, rdn := range rdns {
+		for _, a := range rdn {
+			oids = append(oids, a.Type.Bytes)
+		}
+	}
+	return oids
+}
+
+// oidBytes returns the DER encoded content of an OID.
+func oidBytes(oid asn1.ObjectIdentifier) []byte {
+	der, err := asn1.Marshal(oid)
+	if err != nil {
+		return nil
+	}
+	var v asn1.RawValue
+	if _, err := asn1.Unmarshal(der, &v); err != nil {
+		return nil
+	}
+	return v.Bytes
+}
+
+// hexList joins the hex encoded values with commas.
+func hexList(values [][]byte) []byte {
+	var buffer []byte
+	for i, v := range values {
+		if i > 0 {
+			buffer = append(buffer, ',')
+		}
+		n := len(buffer)
+		buffer = append(buffer, make([]byte, hex.EncodedLen(len(v)))...)
+		hex.Encode(buffer[n:], v)
+	}
+	return buffer
+}
+
+// ParseCertificateMessage decodes the certificate chain of a Certificate handshake message of TLS 1.2 and earlier,
+// including its 4 byte header. Certificates that cannot be parsed are skipped, the first error is returned along
+// with the other certificates.
+func ParseCertificateMessage(msg []byte) ([]*Certificate, error) {
+	return parseCertificateMessage(msg, false)
+}
+
+// ParseCertificateMessageTLS13 is like ParseCertificateMessage for the Certificate message of TLS 1.3,
+// which starts with a request context and carries extensions for each certificate.
+func ParseCertificateMessageTLS13(msg []byte) ([]*Certificate, error) {
+	return parseCertificateMessage(msg, true)
+}
+
+func parseCertificateMessage(msg []byte, tls13 bool) ([]*Certificate, error) {
+
+	s := cursor(msg)
+	typ, ok := s.uint8()
+	if !ok || typ != handshakeTypeCertificate {
+		return nil, errors.New("no certificate message")
+	}
+	body, ok := s.vector(3)
+	if !ok {
+		return nil, ErrBadLength
+	}
+	if tls13 && !body.skipVector(1) {
+		return nil, ErrBadLength
+	}
+	list, ok := body.vector(3)
+	if !ok {
+		return nil, ErrBadLength
+	}
+
+	var (
+		certs    []*Certificate
+		firstErr error
+	)
+	for len(list) > 0 {
+		der, ok := list.vector(3)
+		if !ok || tls13 && !list.skipVector(2) {
+			return certs, ErrBadLength
+		}
+		cert, err := x509.ParseCertificate(der)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		certs = append(certs, NewCertificate(cert))
+	}
+	return certs, firstErr
+}
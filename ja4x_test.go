@@ -0,0 +1,171 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"math/big"
+	"testing"
+	"time"
+)
+
+// testCertificate returns a self-signed DER encoded certificate for example.com.
+func testCertificate(t testing.TB) []byte {
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject: pkix.Name{
+			Organization: []string{"Example"},
+			CommonName:   "example.com",
+		},
+		NotBefore:             time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		NotAfter:              time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"example.com"},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// certificateMessage encodes a Certificate handshake message of TLS 1.2 with the certificates.
+func certificateMessage(certs ...[]byte) []byte {
+
+	var list []byte
+	for _, c := range certs {
+		list = append(list, byte(len(c)>>16), byte(len(c)>>8), byte(len(c)))
+		list = append(list, c...)
+	}
+	body := append([]byte{byte(len(list) >> 16), byte(len(list) >> 8), byte(len(list))}, list...)
+	return append([]byte{handshakeTypeCertificate, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// sha256Prefix returns the first 12 hex characters of the SHA256 of s.
+func sha256Prefix(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+/*
+ *	Tests
+ */
+
+func TestJA4X(t *testing.T) {
+
+	cert, err := x509.ParseCertificate(testCertificate(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		// organization and common name
+		names = sha256Prefix("55040a,550403")
+		// key usage, basic constraints and subject alternative name
+		extensions = sha256Prefix("551d0f,551d13,551d11")
+	)
+	if ja4x := JA4X(cert); ja4x != names+"_"+names+"_"+extensions {
+		t.Fatal("unexpected ja4x", ja4x)
+	}
+}
+
+func TestParseCertificateMessage(t *testing.T) {
+
+	var (
+		der = testCertificate(t)
+		sum = sha256.Sum256(der)
+	)
+
+	certs, err := ParseCertificateMessage(certificateMessage(der, []byte{0x30, 0x00}, der))
+	if err == nil {
+		t.Fatal("expected an error for the invalid certificate")
+	}
+	if len(certs) != 2 {
+		t.Fatal("expected 2 certificates, got", len(certs))
+	}
+
+	c := certs[0]
+	if c.SHA256 != hex.EncodeToString(sum[:]) || c.Subject != "CN=example.com,O=Example" || c.Issuer != c.Subject {
+		t.Fatal("unexpected certificate", c.SHA256, c.Subject, c.Issuer)
+	}
+	if !c.NotAfter.Equal(time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Fatal("unexpected expiry", c.NotAfter)
+	}
+
+	if _, err = ParseCertificateMessage(certificateMessage(der)[:100]); err != ErrBadLength {
+		t.Fatal("expected ErrBadLength, got", err)
+	}
+}
+
+func TestJA4XHandshake(t *testing.T) {
+
+	der := testCertificate(t)
+
+	records := collectRecordsWith(t, []Option{WithJA4X()}, conversation(t,
+		clientHelloPayload(),
+		append([]byte("S:"), handshakeRecord(tlsVersion12, serverHelloMessage(t))...),
+		append([]byte("S:"), handshakeRecord(tlsVersion12, certificateMessage(der))...),
+	)...)
+	if len(records) != 2 {
+		t.Fatal("expected 2 records, got", len(records))
+	}
+
+	s := records[1]
+	if s.JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" || len(s.Certificates) != 1 {
+		t.Fatal("unexpected server record", s.JA3SDigest, s.Certificates)
+	}
+	if sum := sha256.Sum256(der); s.Certificates[0].SHA256 != hex.EncodeToString(sum[:]) {
+		t.Fatal("unexpected certificate", s.Certificates[0].SHA256)
+	}
+}
+
+func TestJA4XResumedSession(t *testing.T) {
+
+	var (
+		records []*Record
+		a       = newAssembler(true, func(r *Record) error {
+			records = append(records, r)
+			return nil
+		}, WithJA4X())
+		packets = conversation(t,
+			clientHelloPayload(),
+			append([]byte("S:"), handshakeRecord(tlsVersion12, serverHelloMessage(t))...),
+			// change cipher spec
+			[]byte("S:\x14\x03\x03\x00\x01\x01"),
+		)
+	)
+	for _, p := range packets {
+		a.processPacket(p, p.Metadata().Timestamp)
+	}
+
+	// the server hello must not wait for a certificate that is never sent
+	if len(records) != 2 || records[1].JA3SDigest == "" || records[1].Certificates != nil {
+		t.Fatal("unexpected records", records)
+	}
+}
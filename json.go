@@ -17,115 +17,204 @@
 package ja3
 
 import (
-	"encoding/binary"
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strconv"
 	"time"
+)
 
-	"github.com/google/gopacket"
+// Transport protocols of records, TCP is not set explicitly.
+const (
+	TransportQUIC = "quic"
+	TransportDTLS = "dtls"
 )
 
 // Record contains all information for a calculated JA3
 type Record struct {
-	DestinationIP   string  `json:"destination_ip"`
-	DestinationPort int     `json:"destination_port"`
-	JA3             string  `json:"ja3"`
-	JA3Digest       string  `json:"ja3_digest"`
-	JA3S            string  `json:"ja3s"`
-	JA3SDigest      string  `json:"ja3s_digest"`
-	SourceIP        string  `json:"source_ip"`
-	SourcePort      int     `json:"source_port"`
-	Timestamp       float64 `json:"timestamp"`
+	DestinationIP         string         `json:"destination_ip"`
+	DestinationPort       int            `json:"destination_port"`
+	JA3                   string         `json:"ja3"`
+	JA3Digest             string         `json:"ja3_digest"`
+	JA3S                  string         `json:"ja3s"`
+	JA3SDigest            string         `json:"ja3s_digest"`
+	JA4                   string         `json:"ja4,omitempty"`
+	JA4R                  string         `json:"ja4_r,omitempty"`
+	JA4O                  string         `json:"ja4_o,omitempty"`
+	JA4S                  string         `json:"ja4s,omitempty"`
+	JA4SR                 string         `json:"ja4s_r,omitempty"`
+	JA4T                  string         `json:"ja4t,omitempty"`
+	JA4TS                 string         `json:"ja4ts,omitempty"`
+	P0f                   string         `json:"p0f,omitempty"`
+	P0fServer             string         `json:"p0f_server,omitempty"`
+	JA4H                  string         `json:"ja4h,omitempty"`
+	JA4HR                 string         `json:"ja4h_r,omitempty"`
+	HTTPMethod            string         `json:"http_method,omitempty"`
+	HTTPVersion           string         `json:"http_version,omitempty"`
+	HTTPCookie            bool           `json:"http_cookie,omitempty"`
+	AcceptLanguage        string         `json:"accept_language,omitempty"`
+	UserAgent             string         `json:"user_agent,omitempty"`
+	HTTP2                 string         `json:"http2,omitempty"`
+	HTTP2Digest           string         `json:"http2_digest,omitempty"`
+	SNI                   string         `json:"sni,omitempty"`
+	ECH                   *ECH           `json:"ech,omitempty"`
+	Certificates          []*Certificate `json:"certificates,omitempty"`
+	EncryptedExtensions   string         `json:"encrypted_extensions,omitempty"`
+	ALPN                  string         `json:"alpn,omitempty"`
+	HASSH                 string         `json:"hassh,omitempty"`
+	HASSHAlgorithms       string         `json:"hassh_algorithms,omitempty"`
+	HASSHServer           string         `json:"hassh_server,omitempty"`
+	HASSHServerAlgorithms string         `json:"hassh_server_algorithms,omitempty"`
+	Transport             string         `json:"transport,omitempty"`
+	SSLv2                 bool           `json:"sslv2,omitempty"`
+	StartTLS              string         `json:"starttls,omitempty"`
+	HandshakeRTT          float64        `json:"handshake_rtt,omitempty"`
+	Labels                []string       `json:"labels,omitempty"`
+	Severity              string         `json:"severity,omitempty"`
+	Sources               []string       `json:"sources,omitempty"`
+	SourceFile            string         `json:"source_file,omitempty"`
+	Packet                int            `json:"packet,omitempty"`
+	SourceIP              string         `json:"source_ip"`
+	SourcePort            int            `json:"source_port"`
+	Timestamp             float64        `json:"timestamp"`
+
+	// capture time and number of the packet that completed the handshake message
+	ts     time.Time
+	packet int
 }
 
 // ReadFileJSON reads the PCAP file at the given path
 // and prints out all packets containing JA3 digests formatted as JSON to the supplied io.Writer
-func ReadFileJSON(file string, out io.Writer, doJA3s bool) {
-
-	r, f, link, err := openPcap(file)
+// It panics on errors, use ReadFileJSONErr to handle them.
+func ReadFileJSON(file string, out io.Writer, doJA3s bool, opts ...Option) {
+	err := ReadFileJSONErr(file, out, doJA3s, opts...)
 	if err != nil {
 		panic(err)
 	}
+}
+
+// ReadFileJSONErr is like ReadFileJSON, but returns errors instead of panicking.
+// If the file is truncated, the records found so far are written before a *TruncatedFileError is returned.
+func ReadFileJSONErr(file string, out io.Writer, doJA3s bool, opts ...Option) error {
+
+	r, f, link, err := openPcap(file, newOptions(opts).keyLog)
+	if err != nil {
+		return err
+	}
 	defer f.Close()
 
-	var records []*Record
+	var (
+		records []*Record
+		a       = newAssembler(doJA3s, func(r *Record) error {
+			// append record and populate all fields
+			records = append(records, r)
+			return nil
+		}, opts...)
+	)
 
-	for {
-		// read packet data
-		data, ci, err := r.ReadPacketData()
-		if err == io.EOF {
-			break
-		} else if err != nil {
-			panic(err)
-		}
+	errRead := a.readPackets(context.Background(), file, r, link)
+	if _, ok := errRead.(*TruncatedFileError); errRead != nil && !ok {
+		return errRead
+	}
 
-		var (
-			// create gopacket
-			p = gopacket.NewPacket(data, link, gopacket.Lazy)
+	if err := writeJSON(out, records); err != nil {
+		return err
+	}
+	return errRead
+}
 
-			// get JA3 if possible
-			bare     = BarePacket(p)
-			isServer bool
-		)
+// ReadFilesJSONErr is like ReadFileJSONErr, but reads all files named by the paths, see ExpandPaths,
+// and adds the source file and the number of the packet that completed the handshake to the records.
+// If files are truncated, the records of all files are written before the first *TruncatedFileError is returned.
+func ReadFilesJSONErr(paths []string, out io.Writer, doJA3s bool, opts ...Option) error {
 
-		if doJA3s && len(bare) == 0 {
-			bare = BarePacketJa3s(p)
-			isServer = true
-		}
+	files, err := ExpandPaths(paths...)
+	if err != nil {
+		return err
+	}
 
-		// check if we got a result
-		if len(bare) > 0 {
-
-			var (
-				nl = p.NetworkLayer()
-				tl = p.TransportLayer()
-			)
-
-			// stop if either network or transport layer is nil
-			if tl == nil || nl == nil {
-				fmt.Println("error: ", nl, tl, p.Dump())
-				continue
-			}
-
-			r := &Record{
-				DestinationIP:   nl.NetworkFlow().Dst().String(),
-				DestinationPort: int(binary.BigEndian.Uint16(tl.TransportFlow().Dst().Raw())),
-				SourceIP:        nl.NetworkFlow().Src().String(),
-				SourcePort:      int(binary.BigEndian.Uint16(tl.TransportFlow().Src().Raw())),
-				Timestamp:       timeToFloat(ci.Timestamp),
-			}
-
-			if isServer {
-				r.JA3S = string(bare)
-				r.JA3SDigest = BareToDigestHex(bare)
-			} else {
-				r.JA3 = string(bare)
-				r.JA3Digest = BareToDigestHex(bare)
-			}
+	var records []*Record
+	errRead := readFiles(context.Background(), files, doJA3s, opts, func(r *Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if _, ok := errRead.(*TruncatedFileError); errRead != nil && !ok {
+		return errRead
+	}
 
-			// append record and populate all fields
-			records = append(records, r)
-		}
+	if err := writeJSON(out, records); err != nil {
+		return err
 	}
+	return errRead
+}
+
+// writeJSON writes the records as indented JSON array, nothing is written if there are no records.
+func writeJSON(out io.Writer, records []*Record) error {
 
 	// make it pretty please
 	b, err := json.MarshalIndent(records, "", "    ")
 	if err != nil {
-		panic(err)
+		return err
 	}
 
 	if string(b) != "null" { // no matches will result in "null" json
 		// write to output io.Writer
-		_, err = out.Write(b)
-		if err != nil {
-			panic(err)
-		}
+		return write(out, b)
+	}
+	return nil
+}
+
+// ReadFileNDJSON reads the PCAP file at the given path
+// and prints out each record as compact JSON object on a separate line as soon as it was found.
+// In contrast to ReadFileJSON the records are not held in memory.
+// It panics on errors, use ReadFileNDJSONErr to handle them.
+func ReadFileNDJSON(file string, out io.Writer, doJA3s bool, opts ...Option) {
+	err := ReadFileNDJSONErr(file, out, doJA3s, opts...)
+	if err != nil {
+		panic(err)
+	}
+}
+
+// ReadFileNDJSONErr is like ReadFileNDJSON, but returns errors instead of panicking.
+func ReadFileNDJSONErr(file string, out io.Writer, doJA3s bool, opts ...Option) error {
+
+	r, f, link, err := openPcap(file, newOptions(opts).keyLog)
+	if err != nil {
+		return err
 	}
+	defer f.Close()
+
+	a := newAssembler(doJA3s, ndjsonWriter(out), opts...)
+	return a.readPackets(context.Background(), file, r, link)
+}
+
+// ReadFilesNDJSONErr is like ReadFileNDJSONErr, but reads all files named by the paths, see ExpandPaths,
+// and adds the source file and the number of the packet that completed the handshake to the records.
+func ReadFilesNDJSONErr(paths []string, out io.Writer, doJA3s bool, opts ...Option) error {
 
-	if Debug {
-		fmt.Println(len(records), "fingerprints.")
+	files, err := ExpandPaths(paths...)
+	if err != nil {
+		return err
+	}
+	return readFiles(context.Background(), files, doJA3s, opts, ndjsonWriter(out))
+}
+
+// ndjsonWriter returns a function that writes records as compact JSON objects on separate lines.
+func ndjsonWriter(out io.Writer) func(r *Record) error {
+
+	var (
+		buf bytes.Buffer
+		enc = json.NewEncoder(&buf)
+	)
+	return func(r *Record) error {
+		buf.Reset()
+		// appends a newline
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		return write(out, buf.Bytes())
 	}
 }
 
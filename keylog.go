@@ -0,0 +1,321 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Labels of the TLS 1.3 secrets that are kept from a key log.
+const (
+	// the server handshake traffic keys decrypt the encrypted extensions and the certificate chain
+	keyLogServerHandshake = "SERVER_HANDSHAKE_TRAFFIC_SECRET"
+
+	// the first client application traffic keys decrypt the HTTP/2 frames a client sends after the handshake
+	keyLogClientTraffic = "CLIENT_TRAFFIC_SECRET_0"
+)
+
+// Block and secrets types of PCAPNG files, see draft-ietf-opsawg-pcapng.
+const (
+	pcapngSectionHeader     = 0x0a0d0d0a
+	pcapngByteOrderMagic    = 0x1a2b3c4d
+	pcapngDecryptionSecrets = 0x0000000a
+	pcapngSecretsTLSKeyLog  = 0x544c534b
+
+	// maxPcapngBlock limits the size of a block that is read into memory.
+	maxPcapngBlock = 1 << 24
+)
+
+// ErrNoPcapng is returned if a file does not start with a PCAPNG section header block.
+var ErrNoPcapng = errors.New("not a PCAPNG file")
+
+// KeyLog holds the TLS secrets of a key log file in the format of the SSLKEYLOGFILE written by browsers and TLS libraries,
+// indexed by the random of the client hello. Only the secrets needed to decrypt the handshake of a server
+// and the first application data of a client are kept. It is safe for concurrent use.
+type KeyLog struct {
+	mu      sync.RWMutex
+	secrets map[string]*tls13Secrets
+}
+
+// tls13Secrets are the secrets of a TLS 1.3 connection that are kept from a key log.
+type tls13Secrets struct {
+	serverHandshake []byte
+	clientTraffic   []byte
+}
+
+// NewKeyLog returns an empty KeyLog.
+func NewKeyLog() *KeyLog {
+	return &KeyLog{secrets: make(map[string]*tls13Secrets)}
+}
+
+// LoadKeyLog reads the key log file at the given path.
+func LoadKeyLog(file string) (*KeyLog, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	k := NewKeyLog()
+	if err := k.Load(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return k, nil
+}
+
+// Len returns the number of connections with secrets in the key log.
+func (k *KeyLog) Len() int {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	return len(k.secrets)
+}
+
+// Load adds the secrets of a key log, with lines in the format "<label> <client random> <secret>".
+// Comments and the labels of secrets that are not needed are ignored.
+func (k *KeyLog) Load(r io.Reader) error {
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return fmt.Errorf("line %d: malformed key log entry", n)
+		}
+		if fields[0] != keyLogServerHandshake && fields[0] != keyLogClientTraffic {
+			continue
+		}
+
+		random, err := hex.DecodeString(fields[1])
+		if err != nil || len(random) != 32 {
+			return fmt.Errorf("line %d: malformed client random", n)
+		}
+		secret, err := hex.DecodeString(fields[2])
+		if err != nil || len(secret) == 0 {
+			return fmt.Errorf("line %d: malformed secret", n)
+		}
+
+		k.mu.Lock()
+		if k.secrets == nil {
+			k.secrets = make(map[string]*tls13Secrets)
+		}
+		s := k.secrets[string(random)]
+		if s == nil {
+			s = &tls13Secrets{}
+			k.secrets[string(random)] = s
+		}
+		if fields[0] == keyLogServerHandshake {
+			s.serverHandshake = secret
+		} else {
+			s.clientTraffic = secret
+		}
+		k.mu.Unlock()
+	}
+	return s.Err()
+}
+
+// LoadPcapng adds the TLS key logs of the Decryption Secrets Blocks in a PCAPNG file,
+// as embedded by Wireshark or editcap --inject-secrets. All other blocks are skipped.
+func (k *KeyLog) LoadPcapng(r io.Reader) error {
+	s := &pcapngSecrets{r: r, k: k}
+	if _, err := io.Copy(ioutil.Discard, s); err != nil {
+		return err
+	}
+	return s.end()
+}
+
+// PcapngReader returns a reader for the PCAPNG data of r, which adds the TLS key logs of the Decryption Secrets Blocks
+// to the key log while the data is read, e.g. by a pcapgo.NgReader. The secrets are known once the packets following
+// them have been read, without reading the data twice. Malformed blocks stop the search for secrets,
+// the data is passed on unchanged.
+func (k *KeyLog) PcapngReader(r io.Reader) io.Reader {
+	return &pcapngSecrets{r: r, k: k}
+}
+
+// pcapngSecrets follows the blocks of the PCAPNG data read through it and loads the secrets of Decryption Secrets Blocks.
+type pcapngSecrets struct {
+	r      io.Reader
+	k      *KeyLog
+	order  binary.ByteOrder
+	header []byte // the start of the current block, until its type and length are known
+	skip   int64  // the remaining bytes of a block without secrets
+	body   []byte // the body of a Decryption Secrets Block read so far
+	length int    // the length of the body
+	err    error  // the first error, which stops the search for secrets
+}
+
+func (s *pcapngSecrets) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	if s.err == nil {
+		s.err = s.scan(p[:n])
+	}
+	return n, err
+}
+
+// scan follows the blocks in data, which continues the data scanned before.
+func (s *pcapngSecrets) scan(data []byte) error {
+	for len(data) > 0 {
+		switch {
+		case s.skip > 0:
+			n := s.skip
+			if n > int64(len(data)) {
+				n = int64(len(data))
+			}
+			s.skip -= n
+			data = data[n:]
+
+		case s.body != nil:
+			n := s.length - len(s.body)
+			if n > len(data) {
+				n = len(data)
+			}
+			s.body = append(s.body, data[:n]...)
+			data = data[n:]
+			if len(s.body) == s.length {
+				body := s.body
+				s.body = nil
+				if err := s.loadSecrets(body); err != nil {
+					return err
+				}
+			}
+
+		default:
+			// block type and length, and the byte order magic of section headers
+			n := 8
+			if len(s.header) >= 4 && binary.LittleEndian.Uint32(s.header) == pcapngSectionHeader {
+				n = 12
+			}
+			n -= len(s.header)
+			if n > len(data) {
+				n = len(data)
+			}
+			s.header = append(s.header, data[:n]...)
+			data = data[n:]
+			if err := s.nextBlock(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// nextBlock starts to skip or read the block, once its header is complete.
+func (s *pcapngSecrets) nextBlock() error {
+
+	if len(s.header) < 8 {
+		return nil
+	}
+
+	// the byte order is announced by each section header, whose type reads the same in both
+	if binary.LittleEndian.Uint32(s.header) == pcapngSectionHeader {
+		if len(s.header) < 12 {
+			return nil
+		}
+		switch {
+		case binary.LittleEndian.Uint32(s.header[8:]) == pcapngByteOrderMagic:
+			s.order = binary.LittleEndian
+		case binary.BigEndian.Uint32(s.header[8:]) == pcapngByteOrderMagic:
+			s.order = binary.BigEndian
+		default:
+			return ErrNoPcapng
+		}
+		length := s.order.Uint32(s.header[4:8])
+		if length < 28 || length%4 != 0 {
+			return ErrBadLength
+		}
+		s.skip = int64(length) - 12
+		s.header = s.header[:0]
+		return nil
+	}
+	if s.order == nil {
+		return ErrNoPcapng
+	}
+
+	typ, length := s.order.Uint32(s.header[:4]), s.order.Uint32(s.header[4:8])
+	s.header = s.header[:0]
+	if length < 12 || length%4 != 0 {
+		return ErrBadLength
+	}
+	if typ != pcapngDecryptionSecrets {
+		s.skip = int64(length) - 8
+		return nil
+	}
+	if length > maxPcapngBlock {
+		return ErrBadLength
+	}
+	s.length = int(length) - 8
+	s.body = make([]byte, 0, s.length)
+	return nil
+}
+
+// loadSecrets adds the TLS key log in the body of a Decryption Secrets Block:
+// secrets type (4), secrets length (4), secrets data, padding, options, block length (4).
+func (s *pcapngSecrets) loadSecrets(body []byte) error {
+	if len(body) < 12 {
+		return ErrBadLength
+	}
+	secretsType, secretsLength := s.order.Uint32(body[:4]), s.order.Uint32(body[4:8])
+	if uint64(secretsLength) > uint64(len(body)-12) {
+		return ErrBadLength
+	}
+	if secretsType != pcapngSecretsTLSKeyLog {
+		return nil
+	}
+	return s.k.Load(bytes.NewReader(body[8 : 8+secretsLength]))
+}
+
+// end returns the error that stopped the search for secrets, or io.ErrUnexpectedEOF if the data ended within a block.
+func (s *pcapngSecrets) end() error {
+	if s.err == nil && (len(s.header) > 0 || s.skip > 0 || s.body != nil) {
+		return io.ErrUnexpectedEOF
+	}
+	return s.err
+}
+
+// serverHandshakeSecret returns the server handshake traffic secret of the connection with the given client random,
+// or nil if it is unknown.
+func (k *KeyLog) serverHandshakeSecret(random []byte) []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if s := k.secrets[string(random)]; s != nil {
+		return s.serverHandshake
+	}
+	return nil
+}
+
+// clientTrafficSecret returns the first client application traffic secret of the connection with the given client random,
+// or nil if it is unknown.
+func (k *KeyLog) clientTrafficSecret(random []byte) []byte {
+	k.mu.RLock()
+	defer k.mu.RUnlock()
+	if s := k.secrets[string(random)]; s != nil {
+		return s.clientTraffic
+	}
+	return nil
+}
@@ -11,7 +11,6 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
 	"github.com/google/gopacket/pcap"
 	"github.com/google/gopacket/pcapgo"
@@ -20,142 +19,205 @@ import (
 // ReadInterface reads packets from the named interface
 // if asJSON is true the results will be dumped as newline separated JSON objects
 // otherwise CSV will be printed to the supplied io.Writer.
-func ReadInterface(iface, bpfFilter, dumpPkg string, out io.Writer, separator string, ja3s bool, asJSON bool, snaplen int, promisc bool, timeout time.Duration) {
-	h, err := pcap.OpenLive(iface, int32(snaplen), promisc, timeout)
+// Hellos split across several segments are only reassembled if the bpfFilter passes all of them.
+// If dumpPkg is not empty, the packets that completed a handshake message are written to a pcap file of that name,
+// for a message split across several segments only the last one is written.
+// It panics on errors, use ReadInterfaceErr to handle them.
+func ReadInterface(iface, bpfFilter, dumpPkg string, out io.Writer, separator string, ja3s bool, asJSON bool, snaplen int, promisc bool, timeout time.Duration, opts ...Option) {
+	err := ReadInterfaceErr(iface, bpfFilter, dumpPkg, out, separator, ja3s, asJSON, snaplen, promisc, timeout, opts...)
 	if err != nil {
 		panic(err)
 	}
+}
+
+// ReadInterfaceErr is like ReadInterface, but returns errors instead of panicking.
+// Expired read timeouts are not treated as errors, the flows that have been idle for longer than the flow
+// or pairing timeout are evicted on them, so that half-seen handshakes are also emitted on a quiet interface.
+func ReadInterfaceErr(iface, bpfFilter, dumpPkg string, out io.Writer, separator string, ja3s bool, asJSON bool, snaplen int, promisc bool, timeout time.Duration, opts ...Option) error {
+	h, err := pcap.OpenLive(iface, int32(snaplen), promisc, timeout)
+	if err != nil {
+		return err
+	}
 	defer h.Close()
 
 	if strings.TrimSpace(bpfFilter) != "" {
 		if err := h.SetBPFFilter(bpfFilter); err != nil {
-			panic(err)
+			return err
 		}
 	}
 
+	err = checkLinkType(linkTypeDLT(h.LinkType()))
+	if err != nil {
+		return err
+	}
+
 	var dumpFileHandle *os.File
 	var pcapWriter *pcapgo.Writer
 	if dumpPkg != "" {
 		dumpFileHandle, err = os.OpenFile(dumpPkg, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 		if err != nil {
-			panic(err)
+			return err
 		}
 		defer dumpFileHandle.Close()
 		pcapWriter = pcapgo.NewWriter(dumpFileHandle)
-		pcapWriter.WriteFileHeader(uint32(snaplen), h.LinkType())
+		err = writeFileHeader(dumpFileHandle, uint32(snaplen), linkTypeDLT(h.LinkType()))
+		if err != nil {
+			return &WriteError{Err: err}
+		}
 	}
 
+	return readLive(h, h.LinkType(), pcapWriter, out, separator, ja3s, asJSON, opts...)
+}
+
+// writeFileHeader writes the header of a pcap file with microsecond timestamps like pcapgo.Writer.WriteFileHeader,
+// but for the untruncated DLT.
+func writeFileHeader(w io.Writer, snaplen uint32, dlt int) error {
+	var buf [24]byte
+	binary.LittleEndian.PutUint32(buf[0:4], 0xa1b2c3d4)
+	binary.LittleEndian.PutUint16(buf[4:6], 2)
+	binary.LittleEndian.PutUint16(buf[6:8], 4)
+	binary.LittleEndian.PutUint32(buf[16:20], snaplen)
+	binary.LittleEndian.PutUint32(buf[20:24], uint32(dlt))
+	_, err := w.Write(buf[:])
+	return err
+}
+
+// readLive fingerprints the packets of a capture handle with the given link type and writes the results as they are found.
+// Packets that completed a handshake message are dumped to the pcapWriter, if not nil,
+// the preceding segments of a message split across several segments are not.
+func readLive(h PacketSource, link layers.LinkType, pcapWriter *pcapgo.Writer, out io.Writer, separator string, ja3s bool, asJSON bool, opts ...Option) error {
+
+	o := newOptions(opts)
 	if !asJSON {
 		columns := []string{"timestamp", "source_ip", "source_port", "destination_ip", "destination_port", "ja3_digest"}
+		if o.pair {
+			columns = append(columns, "ja3s_digest", "sni", "handshake_rtt")
+		}
+		if o.ja4 {
+			columns = append(columns, "ja4", "ja4_o", "ja4s")
+		}
+		if o.ja4x {
+			columns = append(columns, "ja4x")
+		}
+		if o.hassh {
+			columns = append(columns, "hassh", "hassh_server")
+		}
+		if o.ja4t {
+			columns = append(columns, "ja4t", "ja4ts")
+		}
+		if o.ja4h {
+			columns = append(columns, "ja4h")
+		}
+		if o.http2 {
+			columns = append(columns, "http2_digest")
+		}
+		if o.ech {
+			columns = append(columns, "ech", "ech_inner_ja3_digest")
+		}
+		if o.transport {
+			columns = append(columns, "transport")
+		}
+		if o.db != nil {
+			columns = append(columns, "severity")
+		}
 
-		_, err = out.Write([]byte(strings.Join(columns, separator) + "\n"))
+		err := write(out, []byte(strings.Join(columns, separator)+"\n"))
 		if err != nil {
-			panic(err)
+			return err
 		}
 	}
 
-	count := 0
+	var found bool
+	a := newAssembler(ja3s, func(r *Record) error {
+		found = true
+
+		if asJSON {
+
+			// make it pretty please
+			b, err := json.MarshalIndent(r, "", "    ")
+			if err != nil {
+				return err
+			}
+
+			if string(b) != "null" { // no matches will result in "null" json
+				// write to output io.Writer
+				return write(out, append(b, '\n'))
+			}
+			return nil
+		}
+
+		// CSV
+		var values []string
+		if o.pair {
+			values = []string{r.JA3Digest, r.JA3SDigest, r.SNI, rttString(r)}
+		} else if r.JA3Digest != "" {
+			values = []string{r.JA3Digest}
+		} else {
+			values = []string{r.JA3SDigest}
+		}
+		if o.ja4 {
+			values = append(values, r.JA4, r.JA4O, r.JA4S)
+		}
+		if o.ja4x {
+			values = append(values, ja4xString(r))
+		}
+		if o.hassh {
+			values = append(values, r.HASSH, r.HASSHServer)
+		}
+		if o.ja4t {
+			values = append(values, r.JA4T, r.JA4TS)
+		}
+		if o.ja4h {
+			values = append(values, r.JA4H)
+		}
+		if o.http2 {
+			values = append(values, r.HTTP2Digest)
+		}
+		if o.ech {
+			values = append(values, echStrings(r)...)
+		}
+		if o.transport {
+			values = append(values, transportString(r))
+		}
+		if o.db != nil {
+			values = append(values, r.Severity)
+		}
+
+		return write(out, []byte(csvLine(r, separator, values...)))
+	}, opts...)
+
+	decoder := NewPacketDecoder(link)
 	for {
 		// read packet data
 		data, ci, err := h.ReadPacketData()
 		if err == io.EOF {
+			a.flush()
 			if Debug {
-				fmt.Println(count, "fingerprints.")
+				fmt.Println(a.count, "fingerprints,", a.badPackets, "bad packets.")
+			}
+			return a.err
+		} else if err == pcap.NextErrorTimeoutExpired {
+			// emit the hellos that timed out on a quiet interface
+			a.evictIdle(time.Now())
+			if a.err != nil {
+				return a.err
 			}
-			return
+			continue
 		} else if err != nil {
-			panic(err)
+			return err
 		}
 
-		var (
-			// create gopacket
-			p        = gopacket.NewPacket(data, layers.LinkTypeEthernet, gopacket.Lazy)
-			bare     = BarePacket(p)
-			isServer bool
-		)
-
-		if ja3s && len(bare) == 0 {
-			bare = BarePacketJa3s(p)
-			isServer = true
+		found = false
+		a.processData(decoder, data, ci.Timestamp)
+		if a.err != nil {
+			return a.err
 		}
 
-		// check if we got a result
-		if len(bare) > 0 {
-			count++
-
-			if pcapWriter != nil {
-				pcapWriter.WritePacket(ci, data)
-			}
-
-			var (
-				b  strings.Builder
-				nl = p.NetworkLayer()
-				tl = p.TransportLayer()
-			)
-
-			// got a bare but no transport or network layer
-			if tl == nil || nl == nil {
-				if Debug {
-					fmt.Println("got a nil layer: ", nl, tl, p.Dump(), string(bare))
-				}
-				continue
-			}
-
-			r := &Record{
-				DestinationIP:   nl.NetworkFlow().Dst().String(),
-				DestinationPort: int(binary.BigEndian.Uint16(tl.TransportFlow().Dst().Raw())),
-				SourceIP:        nl.NetworkFlow().Src().String(),
-				SourcePort:      int(binary.BigEndian.Uint16(tl.TransportFlow().Src().Raw())),
-				Timestamp:       timeToFloat(ci.Timestamp),
-			}
-
-			digest := BareToDigestHex(bare)
-			if isServer {
-				r.JA3S = string(bare)
-				r.JA3SDigest = digest
-			} else {
-				r.JA3 = string(bare)
-				r.JA3Digest = digest
-			}
-
-			if asJSON {
-
-				// make it pretty please
-				b, err := json.MarshalIndent(r, "", "    ")
-				if err != nil {
-					panic(err)
-				}
-
-				if string(b) != "null" { // no matches will result in "null" json
-					// write to output io.Writer
-					_, err = out.Write(b)
-					if err != nil {
-						panic(err)
-					}
-
-					_, err = out.Write([]byte("\n"))
-					if err != nil {
-						panic(err)
-					}
-				}
-			} else { // CSV
-				b.WriteString(timeToString(ci.Timestamp))
-				b.WriteString(separator)
-				b.WriteString(nl.NetworkFlow().Src().String())
-				b.WriteString(separator)
-				b.WriteString(tl.TransportFlow().Src().String())
-				b.WriteString(separator)
-				b.WriteString(nl.NetworkFlow().Dst().String())
-				b.WriteString(separator)
-				b.WriteString(tl.TransportFlow().Dst().String())
-				b.WriteString(separator)
-				b.WriteString(digest)
-				b.WriteString("\n")
-
-				_, err := out.Write([]byte(b.String()))
-				if err != nil {
-					panic(err)
-				}
+		// dump the packet that completed a handshake message
+		if found && pcapWriter != nil {
+			err = pcapWriter.WritePacket(ci, data)
+			if err != nil {
+				return &WriteError{Err: err}
 			}
 		}
 	}
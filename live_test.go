@@ -0,0 +1,255 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// linkCapture writes a PCAP file with a client and server hello, framed for the given link type.
+func linkCapture(t *testing.T, link layers.LinkType, header func(ip []byte) []byte) *bytes.Buffer {
+
+	var (
+		buf bytes.Buffer
+		w   = pcapgo.NewWriter(&buf)
+		ts  = time.Unix(1506363172, 0)
+	)
+
+	err := writeFileHeader(&buf, 65535, linkTypeDLT(link))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, p := range []gopacket.Packet{
+		tcpPacket(t, false, 1001, false, clientHelloPayload()),
+		tcpPacket(t, true, 5001, false, serverHelloPayload(t)),
+	} {
+		// strip the ethernet header
+		data := p.Data()
+		if link != layers.LinkTypeEthernet {
+			data = header(data[14:])
+		}
+
+		err = w.WritePacket(gopacket.CaptureInfo{
+			Timestamp:     ts.Add(time.Duration(i) * time.Millisecond),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return &buf
+}
+
+// timeoutSource returns pcap.NextErrorTimeoutExpired once after the first packet of the source,
+// and stores the length of the output at the next read.
+type timeoutSource struct {
+	PacketSource
+	out      *bytes.Buffer
+	packets  int
+	timedOut bool
+	written  int
+}
+
+func (s *timeoutSource) ReadPacketData() ([]byte, gopacket.CaptureInfo, error) {
+	if s.packets == 1 {
+		if !s.timedOut {
+			s.timedOut = true
+			return nil, gopacket.CaptureInfo{}, pcap.NextErrorTimeoutExpired
+		}
+		s.written = s.out.Len()
+	}
+	s.packets++
+	return s.PacketSource.ReadPacketData()
+}
+
+/*
+ *	Tests
+ */
+
+func TestReadLiveLinkTypes(t *testing.T) {
+
+	tests := []struct {
+		link   layers.LinkType
+		header func(ip []byte) []byte
+	}{
+		{layers.LinkTypeEthernet, nil},
+		{layers.LinkTypeNull, func(ip []byte) []byte {
+			// address family in host byte order
+			return append([]byte{2, 0, 0, 0}, ip...)
+		}},
+		{layers.LinkTypeLoop, func(ip []byte) []byte {
+			return append([]byte{0, 0, 0, 2}, ip...)
+		}},
+		{layers.LinkTypeRaw, func(ip []byte) []byte {
+			return ip
+		}},
+		{layers.LinkTypeIPv4, func(ip []byte) []byte {
+			return ip
+		}},
+		{layers.LinkTypeIPv6, func(ip []byte) []byte {
+			// the same segment in an IPv6 packet with IPv4-mapped addresses
+			p := gopacket.NewPacket(ip, layers.LayerTypeIPv4, gopacket.Default)
+			ip4 := p.Layer(layers.LayerTypeIPv4).(*layers.IPv4)
+			tcp := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+			ip6 := &layers.IPv6{Version: 6, HopLimit: 64, NextHeader: layers.IPProtocolTCP, SrcIP: ip4.SrcIP.To16(), DstIP: ip4.DstIP.To16()}
+			return serializePacket(t, ip6, tcp, gopacket.Payload(tcp.Payload))
+		}},
+		{layers.LinkTypeLinuxSLL, func(ip []byte) []byte {
+			// packet type, ARPHRD_ETHER, address length, address and protocol
+			return append([]byte{
+				0x00, 0x00, 0x00, 0x01, 0x00, 0x06,
+				0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a, 0x00, 0x00,
+				0x08, 0x00,
+			}, ip...)
+		}},
+		{LinkTypeLinuxSLL2, func(ip []byte) []byte {
+			// protocol, reserved, interface index, ARPHRD_ETHER, packet type, address length and address
+			return append([]byte{
+				0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02,
+				0x00, 0x01, 0x00, 0x06,
+				0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a, 0x00, 0x00,
+			}, ip...)
+		}},
+	}
+
+	for _, test := range tests {
+
+		capture := linkCapture(t, test.link, test.header)
+
+		// the file readers decode the same link types
+		file := tempFile(t, capture.Bytes())
+		defer os.RemoveAll(filepath.Dir(file))
+		var b bytes.Buffer
+		if err := ReadFileNDJSONErr(file, &b, true); err != nil || bytes.Count(b.Bytes(), []byte("\n")) != 2 {
+			t.Fatal(test.link, "unexpected file output", err, b.String())
+		}
+
+		r, err := pcapgo.NewReader(capture)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			out, dump bytes.Buffer
+			w         = pcapgo.NewWriter(&dump)
+		)
+		err = w.WriteFileHeader(65535, r.LinkType())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// pcapgo.Reader returns the link type just like a pcap handle
+		err = readLive(r, r.LinkType(), w, &out, ",", true, true)
+		if err != nil {
+			t.Fatal(test.link, err)
+		}
+
+		var (
+			dec     = json.NewDecoder(&out)
+			records []*Record
+		)
+		for {
+			var r Record
+			if err := dec.Decode(&r); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatal(test.link, err)
+			}
+			records = append(records, &r)
+		}
+
+		if len(records) != 2 {
+			t.Fatal(test.link, "expected 2 records, got", len(records))
+		}
+		if records[0].JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" || records[0].SourceIP != "192.168.1.14" {
+			t.Fatal(test.link, "unexpected client record", records[0].JA3Digest, records[0].SourceIP)
+		}
+		if records[1].JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" || records[1].SourcePort != 443 {
+			t.Fatal(test.link, "unexpected server record", records[1].JA3SDigest, records[1].SourcePort)
+		}
+
+		// both packets completed a handshake message and must have been dumped
+		d, err := pcapgo.NewReader(&dump)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			if _, _, err := d.ReadPacketData(); err != nil {
+				t.Fatal(test.link, "missing dumped packet", i, err)
+			}
+		}
+		if d.LinkType() != test.link {
+			t.Fatal(test.link, "unexpected link type of dump file", d.LinkType())
+		}
+	}
+}
+
+func TestReadLiveCSV(t *testing.T) {
+
+	r, err := pcapgo.NewReader(linkCapture(t, layers.LinkTypeRaw, func(ip []byte) []byte {
+		return ip
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	err = readLive(r, r.LinkType(), nil, &out, ",", true, false, WithPairing(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "timestamp,source_ip,source_port,destination_ip,destination_port,ja3_digest,ja3s_digest,sni,handshake_rtt\n" +
+		"1506363172.000000,192.168.1.14,49391,23.23.97.184,443,4d7a28d6f2263ed61de88ca66eb011e3,5b94af9bf6efc9dea416841602004fbb,beacon.krxd.net,0.001000\n"
+	if out.String() != expected {
+		t.Fatal("unexpected output:\n" + out.String())
+	}
+}
+
+func TestReadLiveTimeout(t *testing.T) {
+
+	r, err := pcapgo.NewReader(linkCapture(t, layers.LinkTypeEthernet, nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		out bytes.Buffer
+		s   = &timeoutSource{PacketSource: r, out: &out}
+	)
+	err = readLive(s, r.LinkType(), nil, &out, ",", true, true, WithPairing(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the client hello has been waiting for longer than the pairing timeout when the read timed out
+	if !s.timedOut || s.written == 0 || !bytes.Contains(out.Bytes()[:s.written], []byte("4d7a28d6f2263ed61de88ca66eb011e3")) {
+		t.Fatal("client hello was not emitted on the read timeout:\n" + out.String())
+	}
+}
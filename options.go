@@ -0,0 +1,201 @@
+//go:build !ja3_disable_gopacket
+
+package ja3
+
+import "time"
+
+// Option configures the optional fingerprints and behavior of the file and live readers.
+type Option func(o *options)
+
+// options collects the settings applied by Option functions.
+type options struct {
+	ja4   bool
+	ja4x  bool
+	hassh bool
+	ja4t  bool
+	ja4h  bool
+	http2 bool
+	ech   bool
+
+	// CSV column with the transport of a record
+	transport bool
+
+	pair        bool
+	pairTimeout time.Duration
+
+	workers int
+
+	// batch processing of multiple files
+	source          bool
+	concurrentFiles int
+	merge           bool
+
+	db      *Database
+	p0f     *P0fDatabase
+	keyLog  *KeyLog
+	echKeys *ECHKeys
+}
+
+// DefaultPairTimeout is the time to wait for a server hello, if no pairing timeout is specified.
+const DefaultPairTimeout = 10 * time.Second
+
+// newOptions applies the supplied options to the defaults.
+func newOptions(opts []Option) options {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithJA4 enables the computation of JA4 client fingerprints,
+// and of JA4S fingerprints if server fingerprints are enabled.
+func WithJA4() Option {
+	return func(o *options) {
+		o.ja4 = true
+	}
+}
+
+// WithJA4X parses the certificate chain that follows the server hello of TLS 1.2 and earlier,
+// and adds the JA4X fingerprints and metadata of the certificates to the server hello record.
+// The server hello is emitted once the certificate message has been seen.
+func WithJA4X() Option {
+	return func(o *options) {
+		o.ja4x = true
+	}
+}
+
+// WithHASSH enables the computation of HASSH fingerprints for SSH clients,
+// and of HASSHServer fingerprints if server fingerprints are enabled.
+// The fingerprints are taken from the key exchange init messages, without the connection setup a stream is picked up
+// at the identification string.
+func WithHASSH() Option {
+	return func(o *options) {
+		o.hassh = true
+	}
+}
+
+// WithJA4T adds the JA4T fingerprint of the client's SYN to the records of a TCP connection,
+// and the JA4TS fingerprint of the server's SYN-ACK to the records of server fingerprints.
+// The connection setup must have been captured.
+func WithJA4T() Option {
+	return func(o *options) {
+		o.ja4t = true
+	}
+}
+
+// WithJA4H emits a record with the JA4H fingerprint, method, version, Accept-Language and User-Agent
+// for every HTTP/1.x request sent in cleartext. Without the connection setup, a stream is picked up at a request line
+// at the start of a segment.
+func WithJA4H() Option {
+	return func(o *options) {
+		o.ja4h = true
+	}
+}
+
+// WithHTTP2 emits a record with the HTTP/2 fingerprint of clients that start a connection with the cleartext
+// HTTP/2 preface, either with prior knowledge (h2c) or in captures of TLS connections that have already been decrypted.
+// Without the connection setup, a stream is picked up at a segment starting with the complete preface.
+// For TLS 1.3 connections whose client traffic secret is in the key log of WithKeyLog, the application data
+// of the client is decrypted and the HTTP/2 fingerprint is added to the record of its client hello instead.
+func WithHTTP2() Option {
+	return func(o *options) {
+		o.http2 = true
+	}
+}
+
+// WithECH adds the type, config ID and public name of the encrypted_client_hello extension to the records
+// of client hellos using Encrypted Client Hello. If the ECH keys of the server are supplied, the inner client hello
+// is decrypted and its SNI, JA3 and JA4 fingerprints are added as well. The keys may be nil.
+func WithECH(k *ECHKeys) Option {
+	return func(o *options) {
+		o.ech = true
+		o.echKeys = k
+	}
+}
+
+// WithTransport adds a transport column to CSV output, with quic, dtls, the protocol of STARTTLS upgrades,
+// or sslv2 for client hellos in the SSLv2 record format. It is empty for TLS over TCP.
+// JSON output carries these in the transport, starttls and sslv2 fields regardless of this option.
+func WithTransport() Option {
+	return func(o *options) {
+		o.transport = true
+	}
+}
+
+// WithKeyLog decrypts the handshake messages a TLS 1.3 server sends after its hello, using the secrets of the key log.
+// The encrypted extensions and the certificate chain are added to the server hello record, which is emitted
+// once the certificate message has been seen. The decryption secrets embedded in PCAPNG files are added to the key log
+// while the files are read, the data of a PacketSource passed to Processor.Process must be wrapped with
+// KeyLog.PcapngReader for that. With WithHTTP2, the client traffic secrets decrypt the HTTP/2 frames of clients.
+func WithKeyLog(k *KeyLog) Option {
+	return func(o *options) {
+		o.keyLog = k
+	}
+}
+
+// WithP0f adds the label of the p0f signature matching the SYN of the client, or the SYN-ACK of the server,
+// to the records of a TCP connection.
+func WithP0f(db *P0fDatabase) Option {
+	return func(o *options) {
+		o.p0f = db
+	}
+}
+
+// WithPairing combines the client and server hello of a connection into a single record,
+// that carries the JA3 and JA3S fingerprints, the SNI and the handshake round trip time.
+// Client hellos without a server hello are emitted on their own after the timeout,
+// server hellos without a client hello are emitted immediately.
+// Pairing requires server fingerprints to be enabled.
+func WithPairing(timeout time.Duration) Option {
+	return func(o *options) {
+		if timeout <= 0 {
+			timeout = DefaultPairTimeout
+		}
+		o.pair = true
+		o.pairTimeout = timeout
+	}
+}
+
+// WithDatabase annotates all records with the labels, severity and sources of matching database entries.
+func WithDatabase(db *Database) Option {
+	return func(o *options) {
+		o.db = db
+	}
+}
+
+// WithWorkers processes the packets of files and packet sources with n goroutines.
+// The packets are read once and distributed among the workers by a hash of their flow,
+// so that all packets of a connection are processed by the same worker.
+// The records are passed on in the order of the packets that produced them, like without workers.
+// Live captures are always processed by a single goroutine.
+func WithWorkers(n int) Option {
+	return func(o *options) {
+		o.workers = n
+	}
+}
+
+// WithConcurrentFiles processes up to n files at the same time when reading multiple files.
+// Without merging, the records of the files are passed on as they are found.
+func WithConcurrentFiles(n int) Option {
+	return func(o *options) {
+		o.concurrentFiles = n
+	}
+}
+
+// WithMerge passes the records of multiple files on in the order of their timestamps across all files.
+// The files are read at the same time as far as WithConcurrentFiles allows, and their records are merged as they are found,
+// only a limited number of records per file is held in memory. The records of one file keep the order they are found in,
+// records held back for pairing or a certificate chain are passed on with their own timestamps once complete.
+func WithMerge() Option {
+	return func(o *options) {
+		o.merge = true
+	}
+}
+
+// withSource adds the name of the file and the number of the packet that completed the handshake message to the records.
+func withSource() Option {
+	return func(o *options) {
+		o.source = true
+	}
+}
@@ -0,0 +1,494 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// p0fMaxDistance is the maximum number of hops between the initial TTL of a signature and the observed TTL.
+const p0fMaxDistance = 35
+
+// p0f quirks, see the documentation of p0f for their meaning.
+const (
+	quirkDF = 1 << iota
+	quirkIDPositive
+	quirkIDNegative
+	quirkECN
+	quirkZeroPositive
+	quirkFlow
+	quirkSeqNegative
+	quirkAckPositive
+	quirkAckNegative
+	quirkUptrPositive
+	quirkURGF
+	quirkPUSHF
+	quirkTS1Negative
+	quirkTS2Positive
+	quirkOptPositive
+	quirkExWS
+)
+
+var p0fQuirks = map[string]uint32{
+	"df":     quirkDF,
+	"id+":    quirkIDPositive,
+	"id-":    quirkIDNegative,
+	"ecn":    quirkECN,
+	"0+":     quirkZeroPositive,
+	"flow":   quirkFlow,
+	"seq-":   quirkSeqNegative,
+	"ack+":   quirkAckPositive,
+	"ack-":   quirkAckNegative,
+	"uptr+":  quirkUptrPositive,
+	"urgf+":  quirkURGF,
+	"pushf+": quirkPUSHF,
+	"ts1-":   quirkTS1Negative,
+	"ts2+":   quirkTS2Positive,
+	"opt+":   quirkOptPositive,
+	"exws":   quirkExWS,
+}
+
+// Types of the window size of a p0f signature.
+const (
+	windowAny = iota
+	windowValue
+	windowMSS
+	windowMTU
+	windowModulo
+)
+
+// p0fSignature is a TCP signature of a p0f database, -1 stands for a wildcard.
+type p0fSignature struct {
+	label   string
+	generic bool
+
+	version    int
+	ttl        int
+	badTTL     bool
+	olen       int
+	mss        int
+	windowType int
+	window     int
+	scale      int
+	layout     string
+	quirks     uint32
+	payload    int
+}
+
+// P0fDatabase holds the TCP signatures of a p0f fingerprint database, as distributed with p0f version 3 in p0f.fp.
+// SYN packets are matched against the signatures of the tcp:request section, SYN-ACK packets against tcp:response.
+type P0fDatabase struct {
+	request  []*p0fSignature
+	response []*p0fSignature
+}
+
+// LoadP0f loads the p0f database from a file.
+func LoadP0f(file string) (*P0fDatabase, error) {
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	db := &P0fDatabase{}
+	if err := db.Load(f); err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return db, nil
+}
+
+// Len returns the number of TCP signatures in the database.
+func (db *P0fDatabase) Len() int {
+	return len(db.request) + len(db.response)
+}
+
+// Load adds the TCP signatures of a p0f database, signatures of other sections are ignored.
+func (db *P0fDatabase) Load(r io.Reader) error {
+
+	var (
+		s       = bufio.NewScanner(r)
+		section *[]*p0fSignature
+		label   string
+		generic bool
+	)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			switch line {
+			case "[tcp:request]":
+				section = &db.request
+			case "[tcp:response]":
+				section = &db.response
+			default:
+				section = nil
+			}
+			label = ""
+			continue
+		}
+		if section == nil {
+			continue
+		}
+
+		i := strings.IndexByte(line, '=')
+		if i < 0 {
+			return fmt.Errorf("line %d: missing =", n)
+		}
+		key, value := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+
+		switch key {
+		case "label":
+			// type:class:name:flavor
+			fields := strings.SplitN(value, ":", 4)
+			if len(fields) != 4 {
+				return fmt.Errorf("line %d: malformed label %q", n, value)
+			}
+			label = strings.TrimSpace(fields[2] + " " + fields[3])
+			generic = fields[0] == "g"
+		case "sig":
+			if label == "" {
+				return fmt.Errorf("line %d: signature without label", n)
+			}
+			sig, err := parseP0fSignature(value)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", n, err)
+			}
+			sig.label = label
+			sig.generic = generic
+			*section = append(*section, sig)
+		}
+	}
+	return s.Err()
+}
+
+// parseP0fSignature parses a TCP signature in the format ver:ittl:olen:mss:wsize,scale:olayout:quirks:pclass.
+func parseP0fSignature(value string) (*p0fSignature, error) {
+
+	fields := strings.Split(value, ":")
+	if len(fields) != 8 {
+		return nil, fmt.Errorf("malformed signature %q", value)
+	}
+
+	var (
+		sig = &p0fSignature{layout: fields[5]}
+		err error
+	)
+
+	if sig.version, err = p0fInt(fields[0]); err != nil {
+		return nil, err
+	}
+
+	// the initial TTL may be followed by a distance that was added by p0f, or by a - for unreliable values
+	ttl := fields[1]
+	if strings.HasSuffix(ttl, "-") {
+		sig.badTTL = true
+		ttl = ttl[:len(ttl)-1]
+	}
+	var distance int
+	if i := strings.IndexByte(ttl, '+'); i >= 0 {
+		if distance, err = strconv.Atoi(ttl[i+1:]); err != nil {
+			return nil, err
+		}
+		ttl = ttl[:i]
+	}
+	if sig.ttl, err = strconv.Atoi(ttl); err != nil {
+		return nil, err
+	}
+	sig.ttl += distance
+
+	if sig.olen, err = strconv.Atoi(fields[2]); err != nil {
+		return nil, err
+	}
+	if sig.mss, err = p0fInt(fields[3]); err != nil {
+		return nil, err
+	}
+
+	window := strings.SplitN(fields[4], ",", 2)
+	if len(window) != 2 {
+		return nil, fmt.Errorf("malformed window size %q", fields[4])
+	}
+	if sig.scale, err = p0fInt(window[1]); err != nil {
+		return nil, err
+	}
+	switch w := window[0]; {
+	case w == "*":
+		sig.windowType = windowAny
+	case strings.HasPrefix(w, "mss*"):
+		sig.windowType = windowMSS
+		sig.window, err = strconv.Atoi(w[4:])
+	case strings.HasPrefix(w, "mtu*"):
+		sig.windowType = windowMTU
+		sig.window, err = strconv.Atoi(w[4:])
+	case strings.HasPrefix(w, "%"):
+		sig.windowType = windowModulo
+		sig.window, err = strconv.Atoi(w[1:])
+	default:
+		sig.windowType = windowValue
+		sig.window, err = strconv.Atoi(w)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if fields[6] != "" {
+		for _, q := range strings.Split(fields[6], ",") {
+			bit, ok := p0fQuirks[q]
+			if !ok {
+				return nil, fmt.Errorf("unknown quirk %q", q)
+			}
+			sig.quirks |= bit
+		}
+	}
+
+	switch fields[7] {
+	case "*":
+		sig.payload = -1
+	case "0":
+		sig.payload = 0
+	case "+":
+		sig.payload = 1
+	default:
+		return nil, fmt.Errorf("malformed payload class %q", fields[7])
+	}
+	return sig, nil
+}
+
+// p0fInt parses a decimal value, or a * wildcard as -1.
+func p0fInt(s string) (int, error) {
+	if s == "*" {
+		return -1, nil
+	}
+	return strconv.Atoi(s)
+}
+
+// p0fPacket contains the values of a SYN or SYN-ACK that are compared with the signatures.
+type p0fPacket struct {
+	version int
+	ttl     int
+	olen    int
+	mss     int
+	window  int
+	scale   int
+	layout  string
+	quirks  uint32
+	payload int
+}
+
+// newP0fPacket collects the values of the IP and TCP headers of a packet.
+func newP0fPacket(nl gopacket.NetworkLayer, tcp *layers.TCP) (*p0fPacket, error) {
+
+	p := &p0fPacket{window: int(tcp.Window)}
+
+	switch ip := nl.(type) {
+	case *layers.IPv4:
+		p.version = 4
+		p.ttl = int(ip.TTL)
+		p.olen = int(ip.IHL)*4 - 20
+		if ip.Flags&layers.IPv4DontFragment != 0 {
+			p.quirks |= quirkDF
+			if ip.Id != 0 {
+				p.quirks |= quirkIDPositive
+			}
+		} else if ip.Id == 0 {
+			p.quirks |= quirkIDNegative
+		}
+		if ip.Flags&layers.IPv4EvilBit != 0 {
+			p.quirks |= quirkZeroPositive
+		}
+		if ip.TOS&0x03 != 0 {
+			p.quirks |= quirkECN
+		}
+	case *layers.IPv6:
+		p.version = 6
+		p.ttl = int(ip.HopLimit)
+		if ip.FlowLabel != 0 {
+			p.quirks |= quirkFlow
+		}
+		if ip.TrafficClass&0x03 != 0 {
+			p.quirks |= quirkECN
+		}
+	default:
+		return nil, errors.New("unsupported network layer")
+	}
+
+	if tcp.ECE || tcp.CWR || tcp.NS {
+		p.quirks |= quirkECN
+	}
+	if tcp.Seq == 0 {
+		p.quirks |= quirkSeqNegative
+	}
+	if tcp.ACK && tcp.Ack == 0 {
+		p.quirks |= quirkAckNegative
+	} else if !tcp.ACK && tcp.Ack != 0 {
+		p.quirks |= quirkAckPositive
+	}
+	if tcp.URG {
+		p.quirks |= quirkURGF
+	} else if tcp.Urgent != 0 {
+		p.quirks |= quirkUptrPositive
+	}
+	if tcp.PSH {
+		p.quirks |= quirkPUSHF
+	}
+	if len(tcp.LayerPayload()) > 0 {
+		p.payload = 1
+	}
+
+	layout := make([]string, 0, len(tcp.Options))
+	for _, o := range tcp.Options {
+		switch o.OptionType {
+		case layers.TCPOptionKindEndList:
+			layout = append(layout, "eol+"+strconv.Itoa(len(tcp.Padding)))
+			for _, b := range tcp.Padding {
+				if b != 0 {
+					p.quirks |= quirkOptPositive
+					break
+				}
+			}
+		case layers.TCPOptionKindNop:
+			layout = append(layout, "nop")
+		case layers.TCPOptionKindMSS:
+			layout = append(layout, "mss")
+			if len(o.OptionData) == 2 {
+				p.mss = int(binary.BigEndian.Uint16(o.OptionData))
+			}
+		case layers.TCPOptionKindWindowScale:
+			layout = append(layout, "ws")
+			if len(o.OptionData) == 1 {
+				p.scale = int(o.OptionData[0])
+				if p.scale > 14 {
+					p.quirks |= quirkExWS
+				}
+			}
+		case layers.TCPOptionKindSACKPermitted:
+			layout = append(layout, "sok")
+		case layers.TCPOptionKindSACK:
+			layout = append(layout, "sack")
+		case layers.TCPOptionKindTimestamps:
+			layout = append(layout, "ts")
+			if len(o.OptionData) == 8 {
+				if binary.BigEndian.Uint32(o.OptionData[:4]) == 0 {
+					p.quirks |= quirkTS1Negative
+				}
+				if !tcp.ACK && binary.BigEndian.Uint32(o.OptionData[4:]) != 0 {
+					p.quirks |= quirkTS2Positive
+				}
+			}
+		default:
+			layout = append(layout, "?"+strconv.Itoa(int(o.OptionType)))
+		}
+	}
+	p.layout = strings.Join(layout, ",")
+
+	return p, nil
+}
+
+// matches reports whether the packet matches the signature.
+func (sig *p0fSignature) matches(p *p0fPacket) bool {
+
+	if sig.version != -1 && sig.version != p.version {
+		return false
+	}
+	if p.ttl > sig.ttl || (!sig.badTTL && sig.ttl-p.ttl > p0fMaxDistance) {
+		return false
+	}
+	if sig.olen != p.olen || sig.layout != p.layout || sig.quirks != p.quirks {
+		return false
+	}
+	if sig.mss != -1 && sig.mss != p.mss {
+		return false
+	}
+	if sig.scale != -1 && sig.scale != p.scale {
+		return false
+	}
+	if sig.payload != -1 && sig.payload != p.payload {
+		return false
+	}
+
+	switch sig.windowType {
+	case windowValue:
+		return p.window == sig.window
+	case windowMSS:
+		return p.window == p.mss*sig.window
+	case windowMTU:
+		header := 40
+		if p.version == 6 {
+			header = 60
+		}
+		return p.window == (p.mss+header)*sig.window
+	case windowModulo:
+		return sig.window != 0 && p.window%sig.window == 0
+	}
+	return true
+}
+
+// match returns the label of the first matching signature for a SYN or SYN-ACK,
+// preferring specific signatures over generic ones, or an empty string.
+func (db *P0fDatabase) match(nl gopacket.NetworkLayer, tcp *layers.TCP) string {
+
+	if !tcp.SYN {
+		return ""
+	}
+	p, err := newP0fPacket(nl, tcp)
+	if err != nil {
+		return ""
+	}
+
+	signatures := db.request
+	if tcp.ACK {
+		signatures = db.response
+	}
+
+	var generic string
+	for _, sig := range signatures {
+		if !sig.matches(p) {
+			continue
+		}
+		if !sig.generic {
+			return sig.label
+		}
+		if generic == "" {
+			generic = sig.label
+		}
+	}
+	return generic
+}
+
+// Match returns the label of the p0f signature matching a TCP SYN or SYN-ACK packet, e.g. "Linux 3.11 and newer",
+// or an empty string.
+func (db *P0fDatabase) Match(p gopacket.Packet) string {
+	nl := p.NetworkLayer()
+	tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if nl == nil || !ok {
+		return ""
+	}
+	return db.match(nl, tcp)
+}
@@ -0,0 +1,254 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// shardChunkSize is the number of packets that are read before they are handed to the workers.
+// The workers process a chunk while the next one is read.
+const shardChunkSize = 4096
+
+// shardPacket is a packet handed to a worker, along with its index in the source.
+type shardPacket struct {
+	data  []byte
+	ts    time.Time
+	index int
+
+	// set if idle flows are evicted before the packet is processed,
+	// packets without data only evict
+	evict bool
+}
+
+// shardRecord is a record found by a worker, along with the position
+// at which a single assembler would have emitted it.
+type shardRecord struct {
+	r     *Record
+	index int
+
+	// set for records emitted by an eviction or the final flush, which are ordered by their timestamps
+	expired bool
+}
+
+// shard is a worker that processes the packets of a subset of the flows with its own assembler.
+type shard struct {
+	a       *assembler
+	decoder *PacketDecoder
+	packets chan []shardPacket
+	records []shardRecord
+
+	// position of the records that are currently emitted
+	index   int
+	expired bool
+}
+
+// newShard returns a worker with the settings of the assembler a.
+func newShard(a *assembler, link layers.LinkType) *shard {
+	s := &shard{
+		decoder: NewPacketDecoder(link),
+		packets: make(chan []shardPacket),
+	}
+	s.a = &assembler{
+		doJA3s:  a.doJA3s,
+		opts:    a.opts,
+		flows:   make(map[flowKey]*flow),
+		emit:    s.collect,
+		name:    a.name,
+		sharded: true,
+	}
+	return s
+}
+
+// collect keeps a record found by the worker until the reader emits it.
+func (s *shard) collect(r *Record) error {
+	s.records = append(s.records, shardRecord{r: r, index: s.index, expired: s.expired})
+	return nil
+}
+
+// run processes chunks of packets until the channel is closed.
+func (s *shard) run(wg *sync.WaitGroup) {
+	for packets := range s.packets {
+		for _, p := range packets {
+			s.index, s.a.packet = p.index, p.index+1
+			if p.evict {
+				s.expired = true
+				s.a.evictIdle(p.ts)
+			}
+			if p.data != nil {
+				s.expired = false
+				s.a.processData(s.decoder, p.data, p.ts)
+			}
+		}
+		wg.Done()
+	}
+}
+
+// flush emits the pending records of the worker as if they were flushed after the packet with the given index.
+func (s *shard) flush(index int) {
+	s.index, s.expired = index, true
+	s.a.flush()
+}
+
+// readPacketsParallel is like readPackets, but processes the packets with the configured number of workers.
+// The packets are decoded once more to distribute them among the workers by a symmetric hash of their flow,
+// and the records of the workers are emitted in the order a single assembler would have emitted them.
+func (a *assembler) readPacketsParallel(ctx context.Context, name string, r PacketSource, link layers.LinkType) error {
+
+	var (
+		decoder = NewPacketDecoder(link)
+		shards  = make([]*shard, a.opts.workers)
+		wg      sync.WaitGroup
+		packets int
+	)
+	for i := range shards {
+		shards[i] = newShard(a, link)
+		go shards[i].run(&wg)
+	}
+	defer func() {
+		for _, s := range shards {
+			close(s.packets)
+		}
+	}()
+
+	for {
+		chunks, n, err := a.readChunk(ctx, r, decoder, len(shards), packets)
+		packets += n
+
+		// emit the records of the previous chunk before handing out the next one
+		wg.Wait()
+		a.emitShards(shards)
+		if a.err != nil {
+			return a.err
+		}
+		wg.Add(len(shards))
+		for i, s := range shards {
+			s.packets <- chunks[i]
+		}
+		if err == nil {
+			continue
+		}
+
+		wg.Wait()
+		if err != io.EOF && err != io.ErrUnexpectedEOF {
+			a.emitShards(shards)
+			if a.err != nil {
+				return a.err
+			}
+			return err
+		}
+
+		for _, s := range shards {
+			s.flush(packets)
+			a.badPackets += s.a.badPackets
+		}
+		a.emitShards(shards)
+		if Debug {
+			fmt.Println(a.count, "fingerprints,", a.badPackets, "bad packets.")
+		}
+		if a.err == nil && err == io.ErrUnexpectedEOF {
+			return &TruncatedFileError{File: name, Packets: packets, Err: err}
+		}
+		return a.err
+	}
+}
+
+// readChunk reads up to shardChunkSize packets and distributes them among n workers,
+// the first packet has the given index. It returns the packets of each worker,
+// the number of packets read and the error that stopped reading, if any.
+func (a *assembler) readChunk(ctx context.Context, r PacketSource, d *PacketDecoder, n, index int) ([][]shardPacket, int, error) {
+
+	var (
+		done   = ctx.Done()
+		chunks = make([][]shardPacket, n)
+	)
+	for i := 0; i < shardChunkSize; i++ {
+		if done != nil {
+			select {
+			case <-done:
+				return chunks, i, ctx.Err()
+			default:
+			}
+		}
+
+		data, ci, err := r.ReadPacketData()
+		if err != nil {
+			return chunks, i, err
+		}
+		a.distribute(chunks, d, shardPacket{data: data, ts: ci.Timestamp, index: index + i})
+	}
+	return chunks, shardChunkSize, nil
+}
+
+// distribute appends a packet to the chunk of the worker that processes its flow.
+// Whenever a single assembler would evict idle flows before the packet, all workers evict their idle flows.
+// Packets without a TCP or UDP layer are dropped.
+func (a *assembler) distribute(chunks [][]shardPacket, d *PacketDecoder, p shardPacket) {
+	defer a.recoverBadPacket()
+
+	nl, tl := d.Decode(p.data)
+	if nl == nil || tl == nil {
+		return
+	}
+	p.evict = evicts(tl) && a.evictDue(p.ts)
+
+	// both flows hash to the same value for either direction
+	n := int((nl.NetworkFlow().FastHash() ^ tl.TransportFlow().FastHash()) % uint64(len(chunks)))
+	for i := range chunks {
+		if i == n {
+			chunks[i] = append(chunks[i], p)
+		} else if p.evict {
+			chunks[i] = append(chunks[i], shardPacket{ts: p.ts, index: p.index, evict: true})
+		}
+	}
+}
+
+// emitShards emits the records collected by the workers in the order a single assembler would have emitted them:
+// by the index of the packet that was processed, with expired records first and in the order of their timestamps.
+func (a *assembler) emitShards(shards []*shard) {
+
+	var records []shardRecord
+	for _, s := range shards {
+		records = append(records, s.records...)
+		s.records = s.records[:0]
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		ri, rj := records[i], records[j]
+		if ri.index != rj.index {
+			return ri.index < rj.index
+		}
+		if ri.expired != rj.expired {
+			return ri.expired
+		}
+		return ri.expired && ri.r.ts.Before(rj.r.ts)
+	})
+
+	for _, r := range records {
+		if a.err != nil {
+			return
+		}
+		a.count++
+		a.err = a.emit(r.r)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// manyFlowsCapture returns a capture of TLS handshakes of the given number of connections, one millisecond apart.
+// The server hello of a connection follows after the client hellos of the next two connections,
+// every third connection does not receive a server hello.
+func manyFlowsCapture(t *testing.T, flows int) *bytes.Buffer {
+
+	var (
+		buf     bytes.Buffer
+		w       = pcapgo.NewWriter(&buf)
+		ts      = time.Unix(1506363172, 0)
+		packets [][]byte
+	)
+
+	packet := func(i int, reply bool, payload []byte) []byte {
+		var (
+			eth = &layers.Ethernet{
+				SrcMAC:       net.HardwareAddr{0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a},
+				DstMAC:       net.HardwareAddr{0x68, 0x7f, 0x74, 0xd6, 0x95, 0xc1},
+				EthernetType: layers.EthernetTypeIPv4,
+			}
+			ip  = &layers.IPv4{Version: 4, TTL: 64, Protocol: layers.IPProtocolTCP, SrcIP: net.IP{192, 168, byte(i >> 8), byte(i)}, DstIP: net.IP{23, 23, 97, 184}}
+			tcp = &layers.TCP{SrcPort: layers.TCPPort(40000 + i), DstPort: 443, Seq: 1001, ACK: true, PSH: true, Window: 256}
+		)
+		if reply {
+			ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+			tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+			tcp.Seq = 5001
+		}
+		return serializePacket(t, eth, ip, tcp, gopacket.Payload(payload))
+	}
+
+	for i := 0; i < flows+2; i++ {
+		if i < flows {
+			packets = append(packets, packet(i, false, clientHelloPayload()))
+		}
+		if j := i - 2; j >= 0 && j%3 != 0 {
+			packets = append(packets, packet(j, true, serverHelloPayload(t)))
+		}
+	}
+
+	err := w.WriteFileHeader(65535, layers.LinkTypeEthernet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, data := range packets {
+		err = w.WritePacket(gopacket.CaptureInfo{
+			Timestamp:     ts.Add(time.Duration(i) * time.Millisecond),
+			CaptureLength: len(data),
+			Length:        len(data),
+		}, data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &buf
+}
+
+// processCapture returns the records of a capture as JSON, processed with the given options.
+func processCapture(t *testing.T, capture []byte, opts ...Option) []byte {
+
+	r, err := pcapgo.NewReader(bytes.NewReader(capture))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var records []*Record
+	err = NewProcessor(true, opts...).Process(context.Background(), r, r.LinkType(), func(r *Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := json.Marshal(records)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+/*
+ *	Tests
+ */
+
+func TestWorkers(t *testing.T) {
+
+	// spans multiple chunks, and expires client hellos while reading
+	capture := manyFlowsCapture(t, shardChunkSize).Bytes()
+
+	for _, opts := range [][]Option{
+		nil,
+		{WithPairing(time.Second)},
+		{WithPairing(time.Second), WithJA4()},
+	} {
+		var (
+			expected = processCapture(t, capture, opts...)
+			records  []*Record
+		)
+		if err := json.Unmarshal(expected, &records); err != nil {
+			t.Fatal(err)
+		}
+		if len(records) < shardChunkSize {
+			t.Fatal("expected a record for every client hello, got", len(records))
+		}
+
+		for _, workers := range []int{1, 2, 7} {
+			if b := processCapture(t, capture, append(opts, WithWorkers(workers))...); !bytes.Equal(b, expected) {
+				t.Fatal(len(opts), "options, records of", workers, "workers do not match")
+			}
+		}
+	}
+
+	var single, parallel bytes.Buffer
+	ReadFileNDJSON("test2.pcap", &single, true)
+	ReadFileNDJSON("test2.pcap", &parallel, true, WithWorkers(4))
+	if single.Len() == 0 || !bytes.Equal(single.Bytes(), parallel.Bytes()) {
+		t.Fatal("records of test2.pcap do not match")
+	}
+}
+
+func TestWorkersHandlerError(t *testing.T) {
+
+	var (
+		capture = manyFlowsCapture(t, 100)
+		errStop = errors.New("stop")
+		count   int
+	)
+
+	r, err := pcapgo.NewReader(capture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = NewProcessor(true, WithWorkers(4)).Process(context.Background(), r, r.LinkType(), func(r *Record) error {
+		count++
+		if count == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop || count != 2 {
+		t.Fatal("expected handler error after 2 records, got", err, count)
+	}
+}
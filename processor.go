@@ -0,0 +1,98 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"context"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Processor extracts fingerprints from packet sources
+// and passes them as records to the caller, without serializing them first.
+// A Processor can be used for multiple sources, also concurrently.
+type Processor struct {
+	doJA3s bool
+	opts   []Option
+}
+
+// NewProcessor returns a Processor that fingerprints client hellos,
+// and server hellos if doJA3s is set, configured by the supplied options.
+func NewProcessor(doJA3s bool, opts ...Option) *Processor {
+	return &Processor{
+		doJA3s: doJA3s,
+		opts:   opts,
+	}
+}
+
+// Process reads all packets from the source and invokes handler for every record found.
+// Processing stops when the source is exhausted, the context is cancelled or the handler returns an error,
+// which is then returned. A blocking read of the source is not interrupted by the cancellation.
+func (p *Processor) Process(ctx context.Context, source PacketSource, link layers.LinkType, handler func(r *Record) error) error {
+	if err := checkLinkType(linkTypeDLT(link)); err != nil {
+		return err
+	}
+	return newAssembler(p.doJA3s, handler, p.opts...).readPackets(ctx, "", source, link)
+}
+
+// ProcessFile is like Process, but reads the packets from the PCAP or PCAPNG file at the given path.
+func (p *Processor) ProcessFile(ctx context.Context, file string, handler func(r *Record) error) error {
+	return readFile(ctx, file, p.doJA3s, p.opts, handler)
+}
+
+// ProcessFiles is like ProcessFile, but reads all files named by the paths, see ExpandPaths,
+// and adds the source file and the number of the packet that completed the handshake to the records.
+// The handler is never invoked concurrently, also if multiple files are processed at the same time.
+// Files that are not in the PCAP or PCAPNG format are skipped. Truncated files do not stop the processing,
+// the first *TruncatedFileError is returned once all other files have been processed.
+func (p *Processor) ProcessFiles(ctx context.Context, paths []string, handler func(r *Record) error) error {
+
+	files, err := ExpandPaths(paths...)
+	if err != nil {
+		return err
+	}
+	return readFiles(ctx, files, p.doJA3s, p.opts, handler)
+}
+
+// Records processes the source in a new goroutine and yields the records on the returned channel,
+// which is closed once processing stopped. Afterwards the error channel delivers the error that stopped processing, if any.
+// Cancel the context to stop processing early.
+func (p *Processor) Records(ctx context.Context, source PacketSource, link layers.LinkType) (<-chan *Record, <-chan error) {
+
+	var (
+		records = make(chan *Record)
+		errs    = make(chan error, 1)
+	)
+
+	go func() {
+		err := p.Process(ctx, source, link, func(r *Record) error {
+			select {
+			case records <- r:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+		close(records)
+		if err != nil {
+			errs <- err
+		}
+		close(errs)
+	}()
+
+	return records, errs
+}
@@ -0,0 +1,164 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/google/gopacket/pcapgo"
+)
+
+// readTestRecords returns the records of test2.pcap as written by ReadFileJSON.
+func readTestRecords(t *testing.T) []*Record {
+
+	var (
+		b       bytes.Buffer
+		records []*Record
+	)
+
+	ReadFileJSON("test2.pcap", &b, true)
+	if err := json.Unmarshal(b.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+/*
+ *	Tests
+ */
+
+func TestProcessorProcessFile(t *testing.T) {
+
+	var (
+		expected = readTestRecords(t)
+		records  []*Record
+	)
+
+	err := NewProcessor(true).ProcessFile(context.Background(), "test2.pcap", func(r *Record) error {
+		records = append(records, r)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != len(expected) {
+		t.Fatal("expected", len(expected), "records, got", len(records))
+	}
+	for i, r := range records {
+		if r.JA3Digest != expected[i].JA3Digest || r.JA3SDigest != expected[i].JA3SDigest || r.SourcePort != expected[i].SourcePort {
+			t.Fatal("record", i, "does not match")
+		}
+	}
+}
+
+func TestProcessorHandlerError(t *testing.T) {
+
+	var (
+		errStop = errors.New("stop")
+		count   int
+	)
+
+	err := NewProcessor(true).ProcessFile(context.Background(), "test2.pcap", func(r *Record) error {
+		count++
+		if count == 2 {
+			return errStop
+		}
+		return nil
+	})
+	if err != errStop {
+		t.Fatal("expected handler error, got", err)
+	}
+	if count != 2 {
+		t.Fatal("handler invoked after error", count)
+	}
+}
+
+func TestProcessorCancel(t *testing.T) {
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := NewProcessor(true).ProcessFile(ctx, "test2.pcap", func(r *Record) error {
+		t.Fatal("unexpected record")
+		return nil
+	})
+	if err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
+
+func TestProcessorRecords(t *testing.T) {
+
+	f, err := os.Open("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		expected      = readTestRecords(t)
+		records, errs = NewProcessor(true).Records(context.Background(), r, r.LinkType())
+		count         int
+	)
+	for range records {
+		count++
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if count != len(expected) {
+		t.Fatal("expected", len(expected), "records, got", count)
+	}
+}
+
+func TestProcessorRecordsCancel(t *testing.T) {
+
+	f, err := os.Open("test2.pcap")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r, err := pcapgo.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	records, errs := NewProcessor(true).Records(ctx, r, r.LinkType())
+
+	// stop after the first record
+	<-records
+	cancel()
+
+	for range records {
+	}
+	if err := <-errs; err != context.Canceled {
+		t.Fatal("expected context.Canceled, got", err)
+	}
+}
@@ -0,0 +1,394 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"hash"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"golang.org/x/crypto/hkdf"
+)
+
+// QUIC versions whose Initial packets can be decrypted.
+const (
+	quicVersion1 = 0x00000001
+	quicVersion2 = 0x6b3343cf
+)
+
+const (
+	// maxConnectionIDLength is the maximum length of a QUIC connection ID.
+	maxConnectionIDLength = 20
+
+	// quicSampleLength is the size of the ciphertext sample used for header protection.
+	quicSampleLength = 16
+)
+
+var (
+	// initial salts, RFC 9001 section 5.2 and RFC 9369 section 3.3.1
+	quicSaltV1 = []byte{0x38, 0x76, 0x2c, 0xf7, 0xf5, 0x59, 0x34, 0xb3, 0x4d, 0x17, 0x9a, 0xe6, 0xa4, 0xc8, 0x0c, 0xad, 0xcc, 0xbb, 0x7f, 0x0a}
+	quicSaltV2 = []byte{0x0d, 0xed, 0xe3, 0xde, 0xf7, 0x00, 0xa6, 0xdb, 0x81, 0x93, 0x81, 0xbe, 0x6e, 0x26, 0x9d, 0xcb, 0xf9, 0xbd, 0x2e, 0xd9}
+
+	errQUICPacket = errors.New("malformed or unsupported quic packet")
+)
+
+// quicHeader is the decoded header of a QUIC long header packet.
+type quicHeader struct {
+	version uint32
+	initial bool
+	dcid    []byte
+
+	// offset of the protected packet number
+	pnOffset int
+
+	// end of the packet, datagrams can carry multiple packets
+	end int
+}
+
+// parseQUICHeader decodes the long header of the packet at the start of the datagram.
+// Short header packets, version negotiation and retry packets as well as unknown versions are rejected.
+func parseQUICHeader(datagram []byte) (*quicHeader, error) {
+
+	s := cursor(datagram)
+
+	first, ok := s.uint8()
+	if !ok || first&0x80 == 0 {
+		return nil, errQUICPacket
+	}
+	version, ok := s.uint32()
+	if !ok {
+		return nil, errQUICPacket
+	}
+	dcid, ok := s.vector(1)
+	if !ok || len(dcid) > maxConnectionIDLength || !s.skipVector(1) {
+		return nil, errQUICPacket
+	}
+
+	var (
+		h   = &quicHeader{version: version, dcid: dcid}
+		typ = first >> 4 & 0x03
+	)
+	switch version {
+	case quicVersion1:
+		h.initial = typ == 0
+		if typ == 3 {
+			return nil, errQUICPacket // retry
+		}
+	case quicVersion2:
+		h.initial = typ == 1
+		if typ == 0 {
+			return nil, errQUICPacket // retry
+		}
+	default:
+		return nil, errQUICPacket
+	}
+
+	if h.initial {
+		// token
+		if !s.skipVarintVector() {
+			return nil, errQUICPacket
+		}
+	}
+
+	length, ok := s.varint()
+	if !ok || length > uint64(len(s)) {
+		return nil, errQUICPacket
+	}
+	h.pnOffset = len(datagram) - len(s)
+	h.end = h.pnOffset + int(length)
+
+	return h, nil
+}
+
+// walkQUICPackets invokes fn for each long header packet coalesced into the datagram.
+func walkQUICPackets(datagram []byte, fn func(packet []byte, h *quicHeader)) {
+	for len(datagram) > 0 {
+		h, err := parseQUICHeader(datagram)
+		if err != nil {
+			return
+		}
+		fn(datagram[:h.end], h)
+		datagram = datagram[h.end:]
+	}
+}
+
+// quicKeys protect the Initial packets of one direction.
+type quicKeys struct {
+	aead cipher.AEAD
+	iv   []byte
+	hp   cipher.Block
+}
+
+// newQUICKeys returns the Initial keys of the client or server.
+func newQUICKeys(version uint32, dcid []byte, server bool) *quicKeys {
+
+	key, iv, hp := quicInitialSecrets(version, dcid, server)
+
+	// AES-128 keys have a valid size
+	block, _ := aes.NewCipher(key)
+	aead, _ := cipher.NewGCM(block)
+	hpBlock, _ := aes.NewCipher(hp)
+
+	return &quicKeys{
+		aead: aead,
+		iv:   iv,
+		hp:   hpBlock,
+	}
+}
+
+// quicInitialSecrets derives the key, IV and header protection key of the client or server
+// from the destination connection ID of the first Initial packet sent by the client.
+func quicInitialSecrets(version uint32, dcid []byte, server bool) (key, iv, hp []byte) {
+
+	salt, prefix := quicSaltV1, "quic "
+	if version == quicVersion2 {
+		salt, prefix = quicSaltV2, "quicv2 "
+	}
+
+	label := "client in"
+	if server {
+		label = "server in"
+	}
+
+	secret := hkdfExpandLabel(sha256.New, hkdf.Extract(sha256.New, dcid, salt), label, sha256.Size)
+	return hkdfExpandLabel(sha256.New, secret, prefix+"key", 16),
+		hkdfExpandLabel(sha256.New, secret, prefix+"iv", 12),
+		hkdfExpandLabel(sha256.New, secret, prefix+"hp", 16)
+}
+
+// hkdfExpandLabel implements HKDF-Expand-Label of TLS 1.3 with an empty context.
+func hkdfExpandLabel(hash func() hash.Hash, secret []byte, label string, length int) []byte {
+
+	info := make([]byte, 0, 4+len("tls13 ")+len(label))
+	info = append(info, byte(length>>8), byte(length), byte(len("tls13 ")+len(label)))
+	info = append(info, "tls13 "...)
+	info = append(info, label...)
+	info = append(info, 0)
+
+	out := make([]byte, length)
+	// cannot fail for the small lengths used here
+	hkdf.Expand(hash, secret, info).Read(out)
+	return out
+}
+
+// open removes the header protection of the packet and decrypts its payload.
+// The packet itself is not modified.
+func (k *quicKeys) open(packet []byte, h *quicHeader) ([]byte, error) {
+
+	if h.pnOffset+4+quicSampleLength > h.end {
+		return nil, errQUICPacket
+	}
+
+	var mask [aes.BlockSize]byte
+	k.hp.Encrypt(mask[:], packet[h.pnOffset+4:h.pnOffset+4+quicSampleLength])
+
+	header := append([]byte(nil), packet[:h.pnOffset+4]...)
+	header[0] ^= mask[0] & 0x0f
+
+	var (
+		pnLength = int(header[0]&0x03) + 1
+		pn       uint64
+	)
+	for i := 0; i < pnLength; i++ {
+		header[h.pnOffset+i] ^= mask[1+i]
+		pn = pn<<8 | uint64(header[h.pnOffset+i])
+	}
+
+	// Initial packet numbers are small, the truncated value is used as is
+	nonce := append([]byte(nil), k.iv...)
+	var pnBytes [8]byte
+	binary.BigEndian.PutUint64(pnBytes[:], pn)
+	for i := range pnBytes {
+		nonce[len(nonce)-8+i] ^= pnBytes[i]
+	}
+
+	return k.aead.Open(nil, nonce, packet[h.pnOffset+pnLength:h.end], header[:h.pnOffset+pnLength])
+}
+
+// walkCryptoFrames invokes fn for each CRYPTO frame in the decrypted payload of an Initial packet.
+func walkCryptoFrames(payload []byte, fn func(offset uint64, data []byte)) error {
+
+	s := cursor(payload)
+	for len(s) > 0 {
+		typ, ok := s.varint()
+		if !ok {
+			return errQUICPacket
+		}
+
+		switch typ {
+		case 0x00, 0x01:
+			// PADDING, PING
+		case 0x02, 0x03:
+			// ACK: largest acknowledged, delay, range count, first range
+			var count uint64
+			if !s.skipVarints(2) {
+				return errQUICPacket
+			}
+			if count, ok = s.varint(); !ok || count > uint64(len(s)) || !s.skipVarints(1+2*int(count)) {
+				return errQUICPacket
+			}
+			if typ == 0x03 && !s.skipVarints(3) {
+				// ECN counts
+				return errQUICPacket
+			}
+		case 0x06:
+			// CRYPTO
+			offset, ok := s.varint()
+			if !ok {
+				return errQUICPacket
+			}
+			length, ok := s.varint()
+			if !ok || length > uint64(len(s)) {
+				return errQUICPacket
+			}
+			data, _ := s.bytes(int(length))
+			fn(offset, data)
+		case 0x1c, 0x1d:
+			// CONNECTION_CLOSE: error code, frame type (0x1c only), reason phrase
+			n := 1
+			if typ == 0x1c {
+				n = 2
+			}
+			if !s.skipVarints(n) || !s.skipVarintVector() {
+				return errQUICPacket
+			}
+		default:
+			// not allowed in Initial packets
+			return errQUICPacket
+		}
+	}
+	return nil
+}
+
+// quicClientHello returns the client hello carried in the Initial packets of a single datagram
+// wrapped into a TLS record, if their CRYPTO frames contain the complete message.
+// Server hellos cannot be decrypted without the connection ID chosen by the client.
+func quicClientHello(datagram []byte) []byte {
+
+	crypto := &halfStream{seqKnown: true}
+
+	walkQUICPackets(datagram, func(packet []byte, h *quicHeader) {
+		if !h.initial {
+			return
+		}
+		payload, err := newQUICKeys(h.version, h.dcid, false).open(packet, h)
+		if err != nil {
+			return
+		}
+		walkCryptoFrames(payload, func(offset uint64, data []byte) {
+			if offset+uint64(len(data)) <= maxStreamBuffer {
+				crypto.reassemble(uint32(offset), data)
+			}
+		})
+	})
+
+	crypto.handshake = crypto.buf
+	msg, ok := crypto.nextHandshake()
+	if !ok || msg[0] != handshakeTypeClientHello {
+		return nil
+	}
+	return handshakeRecord(tlsVersion12, msg)
+}
+
+// quicConnection holds the Initial keys of both directions of a QUIC connection.
+type quicConnection struct {
+	version uint32
+	client  *quicKeys
+	server  *quicKeys
+}
+
+func newQUICConnection(version uint32, dcid []byte) *quicConnection {
+	return &quicConnection{
+		version: version,
+		client:  newQUICKeys(version, dcid, false),
+		server:  newQUICKeys(version, dcid, true),
+	}
+}
+
+// assembleQUIC decrypts the Initial packets in a UDP datagram
+// and reassembles the handshake messages from their CRYPTO frames.
+func (a *assembler) assembleQUIC(network gopacket.Flow, udp *layers.UDP, ts time.Time) {
+
+	payload := udp.LayerPayload()
+	if len(payload) == 0 || payload[0]&0x80 == 0 {
+		// no long header packet
+		return
+	}
+
+	var (
+		transport = udp.TransportFlow()
+		key       = newFlowKey(network, transport)
+		f         = a.flows[key]
+	)
+
+	walkQUICPackets(payload, func(packet []byte, hdr *quicHeader) {
+		if !hdr.initial {
+			return
+		}
+
+		var (
+			plaintext []byte
+			err       = errQUICPacket
+		)
+		if f != nil && f.quic != nil && f.quic.version == hdr.version {
+			// both directions use the keys derived from the first destination connection ID of the client
+			plaintext, err = f.quic.client.open(packet, hdr)
+			if err != nil {
+				plaintext, err = f.quic.server.open(packet, hdr)
+			}
+		}
+		if err != nil {
+			// first client Initial of a connection, or the first one after a retry
+			c := newQUICConnection(hdr.version, hdr.dcid)
+			plaintext, err = c.client.open(packet, hdr)
+			if err != nil {
+				return
+			}
+			if f == nil {
+				f = &flow{protocol: JA4ProtocolQUIC}
+				a.flows[key] = f
+			}
+			f.quic = c
+		}
+		f.lastSeen, f.packet = ts, a.packet
+
+		h := f.half(network, transport)
+		if !h.seqKnown {
+			// CRYPTO frame offsets start at zero
+			h.seqKnown = true
+			h.recordVersion = tlsVersion12
+		}
+
+		walkCryptoFrames(plaintext, func(offset uint64, data []byte) {
+			if h.done || offset+uint64(len(data)) > maxStreamBuffer {
+				return
+			}
+			h.reassemble(uint32(offset), data)
+
+			// CRYPTO frames carry handshake messages without record layer
+			h.handshake = append(h.handshake, h.buf...)
+			h.buf = h.buf[:0]
+			a.consume(f, h, ts)
+		})
+	})
+}
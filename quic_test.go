@@ -0,0 +1,246 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/aes"
+	"encoding/binary"
+	"encoding/hex"
+	"net"
+	"testing"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+var (
+	// destination connection ID of the client, RFC 9001 appendix A
+	testDCID = []byte{0x83, 0x94, 0xc8, 0xf0, 0x3e, 0x51, 0x57, 0x08}
+	testSCID = []byte{0xf0, 0x67, 0xa5, 0x50, 0x2a, 0x42, 0x62, 0xb5}
+)
+
+// cryptoFrame encodes a CRYPTO frame with four byte variable length integers.
+func cryptoFrame(offset int, data []byte) []byte {
+	frame := []byte{0x06}
+	frame = append(frame, quicVarint(offset)...)
+	frame = append(frame, quicVarint(len(data))...)
+	return append(frame, data...)
+}
+
+func quicVarint(v int) []byte {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(v)|0x80<<24)
+	return b
+}
+
+// sealInitial builds a protected Initial packet carrying the frames, with keys derived from keyID.
+func sealInitial(version uint32, dcid, scid, keyID []byte, server bool, pn uint16, frames []byte) []byte {
+
+	var (
+		k   = newQUICKeys(version, keyID, server)
+		typ = byte(0)
+	)
+	if version == quicVersion2 {
+		typ = 1
+	}
+
+	// two byte packet number
+	packet := []byte{0xc0 | typ<<4 | 0x01}
+	packet = append(packet, byte(version>>24), byte(version>>16), byte(version>>8), byte(version))
+	packet = append(packet, byte(len(dcid)))
+	packet = append(packet, dcid...)
+	packet = append(packet, byte(len(scid)))
+	packet = append(packet, scid...)
+
+	// empty token, length
+	packet = append(packet, 0x00)
+	packet = append(packet, quicVarint(2+len(frames)+k.aead.Overhead())...)
+
+	pnOffset := len(packet)
+	packet = append(packet, byte(pn>>8), byte(pn))
+
+	nonce := append([]byte(nil), k.iv...)
+	nonce[len(nonce)-2] ^= byte(pn >> 8)
+	nonce[len(nonce)-1] ^= byte(pn)
+	packet = k.aead.Seal(packet, nonce, frames, packet)
+
+	var mask [aes.BlockSize]byte
+	k.hp.Encrypt(mask[:], packet[pnOffset+4:pnOffset+4+quicSampleLength])
+	packet[0] ^= mask[0] & 0x0f
+	packet[pnOffset] ^= mask[1]
+	packet[pnOffset+1] ^= mask[2]
+
+	return packet
+}
+
+// udpPacket serializes an ethernet frame carrying a UDP datagram between the endpoints used by tcpPacket.
+func udpPacket(t testing.TB, reply bool, payload []byte) gopacket.Packet {
+
+	var (
+		eth = &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a},
+			DstMAC:       net.HardwareAddr{0x68, 0x7f, 0x74, 0xd6, 0x95, 0xc1},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip = &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolUDP,
+			SrcIP:    net.IP{192, 168, 1, 14},
+			DstIP:    net.IP{23, 23, 97, 184},
+		}
+		udp = &layers.UDP{
+			SrcPort: 49391,
+			DstPort: 443,
+		}
+		buf = gopacket.NewSerializeBuffer()
+	)
+
+	if reply {
+		eth.SrcMAC, eth.DstMAC = eth.DstMAC, eth.SrcMAC
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		udp.SrcPort, udp.DstPort = udp.DstPort, udp.SrcPort
+	}
+
+	err := udp.SetNetworkLayerForChecksum(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, udp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+}
+
+// clientHelloMessage returns the handshake message of clientHelloPayload.
+func clientHelloMessage() []byte {
+	return clientHelloPayload()[5:]
+}
+
+// serverHelloMessage returns the first handshake message of serverHelloPayload.
+func serverHelloMessage(t testing.TB) []byte {
+	msg := serverHelloPayload(t)[5:]
+	return msg[:4+int(msg[1])<<16|int(msg[2])<<8|int(msg[3])]
+}
+
+/*
+ *	Tests
+ */
+
+func TestQUICInitialSecrets(t *testing.T) {
+
+	tests := []struct {
+		version uint32
+		server  bool
+		key     string
+		iv      string
+		hp      string
+	}{
+		// RFC 9001 appendix A.1
+		{quicVersion1, false, "1f369613dd76d5467730efcbe3b1a22d", "fa044b2f42a3fd3b46fb255c", "9f50449e04a0e810283a1e9933adedd2"},
+		{quicVersion1, true, "cf3a5331653c364c88f0f379b6067e37", "0ac1493ca1905853b0bba03e", "c206b8d9b9f0f37644430b490eeaa314"},
+		// RFC 9369 appendix A.1
+		{quicVersion2, false, "8b1a0bc121284290a29e0971b5cd045d", "91f73e2351d8fa91660e909f", "45b95e15235d6f45a6b19cbcb0294ba9"},
+	}
+
+	for _, test := range tests {
+		key, iv, hp := quicInitialSecrets(test.version, testDCID, test.server)
+		if hex.EncodeToString(key) != test.key || hex.EncodeToString(iv) != test.iv || hex.EncodeToString(hp) != test.hp {
+			t.Fatalf("%x %v: unexpected secrets %x %x %x", test.version, test.server, key, iv, hp)
+		}
+	}
+}
+
+func TestQUICHandshake(t *testing.T) {
+
+	for _, version := range []uint32{quicVersion1, quicVersion2} {
+
+		var (
+			msg    = clientHelloMessage()
+			server = serverHelloMessage(t)
+
+			// client hello split across two Initial packets, the second one arrives first
+			first  = sealInitial(version, testDCID, testSCID, testDCID, false, 0, cryptoFrame(0, msg[:100]))
+			second = sealInitial(version, testDCID, testSCID, testDCID, false, 1, append([]byte{0x01, 0x00, 0x00}, cryptoFrame(100, msg[100:])...))
+
+			// server Initial coalesced with a packet of another type, keys are derived from the client DCID
+			reply = append(
+				sealInitial(version, testSCID, []byte{0x01}, testDCID, true, 0, append([]byte{0x02, 0x00, 0x00, 0x00, 0x00}, cryptoFrame(0, server)...)),
+				0xe0, 0x00, 0x00, 0x00, 0x01,
+			)
+		)
+
+		records := collectRecordsWith(t, []Option{WithJA4()},
+			udpPacket(t, false, second),
+			udpPacket(t, false, first),
+			udpPacket(t, true, reply),
+		)
+		if len(records) != 2 {
+			t.Fatalf("%x: expected 2 records, got %d", version, len(records))
+		}
+
+		c, s := records[0], records[1]
+		if c.JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" || c.SourcePort != 49391 || c.Transport != TransportQUIC {
+			t.Fatalf("%x: unexpected client record %s %d %q", version, c.JA3Digest, c.SourcePort, c.Transport)
+		}
+		if c.JA4[0] != JA4ProtocolQUIC || c.SNI != "beacon.krxd.net" {
+			t.Fatalf("%x: unexpected ja4 %s %s", version, c.JA4, c.SNI)
+		}
+		if s.JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" || s.SourcePort != 443 || s.JA4S[0] != JA4ProtocolQUIC {
+			t.Fatalf("%x: unexpected server record %s %s %d", version, s.JA3SDigest, s.JA4S, s.SourcePort)
+		}
+	}
+}
+
+func TestQUICRetransmission(t *testing.T) {
+
+	packet := sealInitial(quicVersion1, testDCID, testSCID, testDCID, false, 0, cryptoFrame(0, clientHelloMessage()))
+
+	records := collectRecords(t, udpPacket(t, false, packet), udpPacket(t, false, packet))
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+}
+
+func TestBarePacketQUIC(t *testing.T) {
+
+	var (
+		packet = sealInitial(quicVersion1, testDCID, testSCID, testDCID, false, 0, cryptoFrame(0, clientHelloMessage()))
+		p      = udpPacket(t, false, packet)
+	)
+
+	if hash := DigestHexPacket(p); hash != "4d7a28d6f2263ed61de88ca66eb011e3" {
+		t.Fatal("unexpected digest", hash)
+	}
+	if ja4 := JA4Packet(p); ja4 != "q12d210500_b973bfd88a0e_677eed04e9fb" {
+		t.Fatal("unexpected ja4", ja4)
+	}
+
+	// incomplete client hello
+	packet = sealInitial(quicVersion1, testDCID, testSCID, testDCID, false, 0, cryptoFrame(0, clientHelloMessage()[:100]))
+	if bare := BarePacket(udpPacket(t, false, packet)); len(bare) != 0 {
+		t.Fatal("unexpected fingerprint", string(bare))
+	}
+
+	// tampered packet
+	packet = sealInitial(quicVersion1, testDCID, testSCID, testDCID, false, 0, cryptoFrame(0, clientHelloMessage()))
+	packet[len(packet)-1] ^= 0xff
+	if bare := BarePacket(udpPacket(t, false, packet)); len(bare) != 0 {
+		t.Fatal("unexpected fingerprint", string(bare))
+	}
+}
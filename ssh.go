@@ -0,0 +1,120 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// maxSSHIdentification is the maximum length of the SSH identification string, including the line ending.
+const maxSSHIdentification = 255
+
+var sshIdentification = []byte("SSH-")
+
+// isSSHIdentification checks whether data starts with an SSH identification string.
+func isSSHIdentification(data []byte) bool {
+	return bytes.HasPrefix(data, sshIdentification)
+}
+
+// consumeSSH skips the identification string of an SSH stream and fingerprints the key exchange init message,
+// which is the payload of the first binary packet. Both are sent in the clear.
+func (a *assembler) consumeSSH(f *flow, h *halfStream, ts time.Time) {
+
+	h.ssh = true
+
+	if isSSHIdentification(h.buf) {
+		i := bytes.IndexByte(h.buf, '\n')
+		if i < 0 {
+			if len(h.buf) > maxSSHIdentification {
+				h.release()
+			}
+			return
+		}
+		h.buf = h.buf[i+1:]
+	}
+
+	// packet length (4), padding length (1), payload, padding
+	if len(h.buf) < 5 {
+		return
+	}
+	length := int(binary.BigEndian.Uint32(h.buf))
+	if length > maxStreamBuffer || int(h.buf[4])+1 > length {
+		h.release()
+		return
+	}
+	if len(h.buf) < 4+length {
+		return
+	}
+	payload := h.buf[5 : 4+length-int(h.buf[4])]
+
+	// no more data is needed from this direction
+	defer h.release()
+
+	var k KexInit
+	if err := k.Unmarshal(payload); err != nil {
+		if Debug {
+			fmt.Println(err, h.network, h.transport)
+		}
+		return
+	}
+
+	client := f.isClient(h)
+	if !client && !a.doJA3s {
+		return
+	}
+
+	r := f.newRecord(h, ts)
+	if client {
+		bare := BareHASSH(&k)
+		r.HASSH = BareToDigestHex(bare)
+		r.HASSHAlgorithms = string(bare)
+	} else {
+		bare := BareHASSHServer(&k)
+		r.HASSHServer = BareToDigestHex(bare)
+		r.HASSHServerAlgorithms = string(bare)
+	}
+
+	if !a.opts.pair || !a.doJA3s {
+		a.output(r)
+		return
+	}
+
+	// both sides send their key exchange init without waiting for the other one,
+	// the record of the first is kept until the second arrives and is reported from the client's point of view
+	p := f.client
+	if p == nil {
+		f.client = r
+		return
+	}
+	f.client = nil
+	if client {
+		r.HASSHServer = p.HASSHServer
+		r.HASSHServerAlgorithms = p.HASSHServerAlgorithms
+		r.JA4TS = p.JA4TS
+		r.P0fServer = p.P0fServer
+	} else {
+		p.HASSHServer = r.HASSHServer
+		p.HASSHServerAlgorithms = r.HASSHServerAlgorithms
+		p.JA4TS = r.JA4TS
+		p.P0fServer = r.P0fServer
+		r = p
+	}
+	a.output(r)
+}
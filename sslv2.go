@@ -0,0 +1,101 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"errors"
+	"strconv"
+)
+
+// sslv2ClientHello is the message type of an SSLv2 CLIENT-HELLO.
+const sslv2ClientHello = 1
+
+// ErrNoSSLv2Hello is returned if a payload does not start with an SSLv2 client hello record.
+var ErrNoSSLv2Hello = errors.New("payload is not an SSLv2 client hello")
+
+// SSLv2ClientHello is a client hello in the SSLv2 record format, which is still sent by legacy clients
+// and scanners that support SSLv2 servers, and which may announce versions up to TLS 1.2.
+type SSLv2ClientHello struct {
+	Version     uint16
+	CipherSpecs []uint32
+	SessionID   []byte
+	Challenge   []byte
+}
+
+// Unmarshal decodes an SSLv2 client hello record with a 2 byte header.
+func (h *SSLv2ClientHello) Unmarshal(payload []byte) error {
+
+	if !isSSLv2ClientHello(payload) {
+		return ErrNoSSLv2Hello
+	}
+	// message type (1), version (2), cipher specs length (2), session ID length (2), challenge length (2)
+	length := int(payload[0]&0x7f)<<8 | int(payload[1])
+	if length < 9 || len(payload) < 2+length {
+		return ErrBadLength
+	}
+
+	s := cursor(payload[3 : 2+length])
+	h.Version, _ = s.uint16()
+	specsLength, _ := s.uint16()
+	sessionIDLength, _ := s.uint16()
+	challengeLength, ok := s.uint16()
+	if !ok || specsLength%3 != 0 {
+		return ErrBadLength
+	}
+
+	specs, ok := s.bytes(int(specsLength))
+	if !ok {
+		return ErrBadLength
+	}
+	h.CipherSpecs = make([]uint32, 0, len(specs)/3)
+	for len(specs) > 0 {
+		spec, _ := specs.uint24()
+		h.CipherSpecs = append(h.CipherSpecs, uint32(spec))
+	}
+	if h.SessionID, ok = s.bytes(int(sessionIDLength)); !ok {
+		return ErrBadLength
+	}
+	if h.Challenge, ok = s.bytes(int(challengeLength)); !ok {
+		return ErrBadLength
+	}
+	return nil
+}
+
+// BareSSLv2 returns the JA3 bare string of an SSLv2 client hello.
+// The 3 byte cipher specs are used as their decimal value, so that TLS cipher suites
+// announced as 0x00XXYY match their TLS value. As there are no extensions, the remaining fields are empty.
+// Example:
+// 769,458944-196736-57-56-53,,,
+func BareSSLv2(hello *SSLv2ClientHello) []byte {
+
+	buffer := make([]byte, 0, 5+1+(8+1)*len(hello.CipherSpecs)+3)
+	buffer = strconv.AppendInt(buffer, int64(hello.Version), 10)
+	buffer = append(buffer, sepFieldByte)
+
+	for i, spec := range hello.CipherSpecs {
+		if i > 0 {
+			buffer = append(buffer, sepValueByte)
+		}
+		buffer = strconv.AppendUint(buffer, uint64(spec), 10)
+	}
+	return append(buffer, sepFieldByte, sepFieldByte, sepFieldByte)
+}
+
+// isSSLv2ClientHello checks whether data starts with the 2 byte header of an SSLv2 record carrying a client hello
+// for SSL 2.0 or a later version.
+func isSSLv2ClientHello(data []byte) bool {
+	return len(data) >= 5 && data[0]&0x80 != 0 && data[2] == sslv2ClientHello &&
+		(data[3] == 0 && data[4] == 2 || data[3] == 3 && data[4] <= 3)
+}
@@ -0,0 +1,120 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const sslv2Bare = "769,65664-458944-196736-57-53,,,"
+
+// sslv2ClientHelloPayload returns an SSLv2 client hello record for TLS 1.0,
+// offering SSLv2 and TLS cipher specs as sent by legacy scanners.
+func sslv2ClientHelloPayload() []byte {
+
+	specs := []byte{
+		0x01, 0x00, 0x80, // SSL_CK_RC4_128_WITH_MD5
+		0x07, 0x00, 0xc0, // SSL_CK_DES_192_EDE3_CBC_WITH_MD5
+		0x03, 0x00, 0x80, // SSL_CK_RC2_128_CBC_WITH_MD5
+		0x00, 0x00, 0x39, // TLS_DHE_RSA_WITH_AES_256_CBC_SHA
+		0x00, 0x00, 0x35, // TLS_RSA_WITH_AES_256_CBC_SHA
+	}
+	challenge := bytes.Repeat([]byte{0x5a}, 16)
+
+	msg := []byte{sslv2ClientHello, 0x03, 0x01, 0, byte(len(specs)), 0, 0, 0, byte(len(challenge))}
+	msg = append(msg, specs...)
+	msg = append(msg, challenge...)
+	return append([]byte{0x80 | byte(len(msg)>>8), byte(len(msg))}, msg...)
+}
+
+/*
+ *	Tests
+ */
+
+func TestSSLv2(t *testing.T) {
+
+	data := sslv2ClientHelloPayload()
+
+	var hello SSLv2ClientHello
+	if err := hello.Unmarshal(data); err != nil {
+		t.Fatal(err)
+	}
+	if hello.Version != 0x0301 || len(hello.CipherSpecs) != 5 || len(hello.SessionID) != 0 || len(hello.Challenge) != 16 {
+		t.Fatal("unexpected client hello", hello)
+	}
+	if bare := string(BareSSLv2(&hello)); bare != sslv2Bare {
+		t.Fatal("unexpected bare", bare)
+	}
+
+	for _, test := range []struct {
+		name    string
+		payload []byte
+		err     error
+	}{
+		{"truncated record", data[:len(data)-1], ErrBadLength},
+		{"zero length", []byte{0x80, 0x00, 0x01, 0x03, 0x01}, ErrBadLength},
+		{"length below header", []byte{0x80, 0x01, 0x01, 0x03, 0x01}, ErrBadLength},
+		{"truncated header", []byte{0x80, 0x08, 0x01, 0x03, 0x01, 0, 0, 0, 0, 0}, ErrBadLength},
+		{"truncated cipher specs", []byte{0x80, 0x09, 0x01, 0x03, 0x01, 0, 3, 0, 0, 0, 0}, ErrBadLength},
+		{"short header", []byte{0x80, 0x00, 0x01, 0x03}, ErrNoSSLv2Hello},
+		{"TLS record", clientHelloPayload(), ErrNoSSLv2Hello},
+	} {
+		if err := hello.Unmarshal(test.payload); err != test.err {
+			t.Fatal(test.name, "expected", test.err, "got", err)
+		}
+
+		// the packet helpers do not panic on malformed records either
+		packet := tcpPacket(t, false, 1, false, test.payload)
+		if bare := BarePacket(packet); len(bare) != 0 && test.err == ErrBadLength {
+			t.Fatal(test.name, "unexpected bare", string(bare))
+		}
+	}
+}
+
+func TestSSLv2Stream(t *testing.T) {
+
+	data := sslv2ClientHelloPayload()
+	packets := conversation(t, data[:10], data[10:])
+
+	records := collectRecordsWith(t, []Option{WithPairing(DefaultPairTimeout)}, packets...)
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if r := records[0]; r.JA3 != sslv2Bare || r.JA3Digest != BareToDigestHex([]byte(sslv2Bare)) || !r.SSLv2 {
+		t.Fatal("unexpected record", r.JA3, r.SSLv2)
+	}
+
+	// CSV output marks the record in the transport column, if enabled
+	var b bytes.Buffer
+	if err := writeCSVHeader(&b, ",", newOptions(nil)); err != nil || strings.Contains(b.String(), "transport") {
+		t.Fatal("unexpected header", err, b.String())
+	}
+	b.Reset()
+	o := newOptions([]Option{WithTransport()})
+	if err := writeCSVHeader(&b, ",", o); err != nil || !strings.HasSuffix(b.String(), ",transport\n") {
+		t.Fatal("unexpected header", err, b.String())
+	}
+	b.Reset()
+	if err := csvWriter(&b, ",", o)(records[0]); err != nil || !strings.HasSuffix(b.String(), ",sslv2\n") {
+		t.Fatal("unexpected output", err, b.String())
+	}
+
+	packets = conversation(t, data)
+	if bare := string(BarePacket(packets[2])); bare != sslv2Bare {
+		t.Fatal("unexpected bare", bare)
+	}
+}
@@ -0,0 +1,299 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/binary"
+	"strings"
+)
+
+// Plaintext protocols whose connections can be upgraded to TLS.
+const (
+	StartTLSSMTP       = "smtp"
+	StartTLSIMAP       = "imap"
+	StartTLSPOP3       = "pop3"
+	StartTLSFTP        = "ftp"
+	StartTLSXMPP       = "xmpp"
+	StartTLSLDAP       = "ldap"
+	StartTLSPostgreSQL = "postgresql"
+)
+
+const (
+	// maxPlaintext limits the number of plaintext bytes per direction
+	// that are inspected for an upgrade to TLS before giving up on the connection.
+	maxPlaintext = 1 << 14
+
+	// maxPartialLine limits the number of bytes kept from an incomplete line.
+	maxPartialLine = 1024
+)
+
+var (
+	// PostgreSQL SSLRequest: length 8 and request code 80877103
+	postgresSSLRequest = []byte{0x00, 0x00, 0x00, 0x08, 0x04, 0xd2, 0x16, 0x2f}
+
+	// LDAP StartTLS extended operation
+	ldapStartTLSOID = []byte("1.3.6.1.4.1.1466.20037")
+)
+
+// upgradeResult is the answer of a server to a request for an upgrade to TLS.
+type upgradeResult int
+
+const (
+	upgradePending upgradeResult = iota
+	upgradeAccepted
+	upgradeRefused
+)
+
+// upgrade tracks the plaintext phase of a connection that may be upgraded to TLS.
+type upgrade struct {
+	// protocol of the pending request, empty until the client asked for the upgrade
+	protocol string
+
+	// IMAP command tag of the request
+	tag string
+
+	// protocol of the accepted upgrade
+	upgraded string
+}
+
+// upgradeRequest detects a request of the client to upgrade the connection to TLS.
+func upgradeRequest(data []byte) (protocol, tag string) {
+
+	switch {
+	case bytes.HasPrefix(data, postgresSSLRequest):
+		return StartTLSPostgreSQL, ""
+	case len(data) > 0 && data[0] == 0x30 && bytes.Contains(data, ldapStartTLSOID):
+		return StartTLSLDAP, ""
+	case bytes.Contains(data, []byte("<starttls")) && bytes.Contains(data, []byte("urn:ietf:params:xml:ns:xmpp-tls")):
+		return StartTLSXMPP, ""
+	}
+
+	for _, line := range lines(data) {
+		line = strings.ToUpper(line)
+		switch {
+		case line == "STARTTLS":
+			return StartTLSSMTP, ""
+		case line == "STLS":
+			return StartTLSPOP3, ""
+		case strings.HasPrefix(line, "AUTH TLS"), strings.HasPrefix(line, "AUTH SSL"):
+			return StartTLSFTP, ""
+		}
+		if fields := strings.Fields(line); len(fields) == 2 && fields[1] == "STARTTLS" {
+			return StartTLSIMAP, fields[0]
+		}
+	}
+	return "", ""
+}
+
+// upgradeResponse detects the answer of the server to a request for an upgrade to TLS.
+func upgradeResponse(protocol, tag string, data []byte) upgradeResult {
+
+	switch protocol {
+	case StartTLSPostgreSQL:
+		if len(data) == 0 {
+			return upgradePending
+		}
+		if data[0] == 'S' {
+			return upgradeAccepted
+		}
+		return upgradeRefused
+	case StartTLSLDAP:
+		code, ok := ldapResultCode(data)
+		if !ok {
+			return upgradePending
+		}
+		if code == 0 {
+			return upgradeAccepted
+		}
+		return upgradeRefused
+	case StartTLSXMPP:
+		if bytes.Contains(data, []byte("<proceed")) {
+			return upgradeAccepted
+		}
+		if bytes.Contains(data, []byte("<failure")) {
+			return upgradeRefused
+		}
+		return upgradePending
+	}
+
+	for _, line := range lines(data) {
+		line = strings.ToUpper(line)
+		switch protocol {
+		case StartTLSSMTP, StartTLSFTP:
+			// 220 ready to start TLS (SMTP), 234 security data exchange complete (FTP)
+			if len(line) < 3 {
+				continue
+			}
+			if line[:3] == "220" && protocol == StartTLSSMTP || line[:3] == "234" && protocol == StartTLSFTP {
+				return upgradeAccepted
+			}
+			if line[0] == '4' || line[0] == '5' {
+				return upgradeRefused
+			}
+		case StartTLSPOP3:
+			if strings.HasPrefix(line, "+OK") {
+				return upgradeAccepted
+			}
+			if strings.HasPrefix(line, "-ERR") {
+				return upgradeRefused
+			}
+		case StartTLSIMAP:
+			fields := strings.Fields(line)
+			if len(fields) < 2 || fields[0] != tag {
+				continue
+			}
+			if fields[1] == "OK" {
+				return upgradeAccepted
+			}
+			return upgradeRefused
+		}
+	}
+	return upgradePending
+}
+
+// lines returns the complete lines of data without line endings.
+func lines(data []byte) []string {
+	var out []string
+	for {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			return out
+		}
+		out = append(out, string(bytes.TrimRight(data[:i], "\r")))
+		data = data[i+1:]
+	}
+}
+
+// ldapResultCode decodes the result code of an LDAP extended response.
+func ldapResultCode(data []byte) (int, bool) {
+
+	s := cursor(data)
+
+	// LDAPMessage: SEQUENCE of message ID and protocol operation
+	msg, ok := berElement(&s, 0x30)
+	if !ok {
+		return 0, false
+	}
+	if _, ok = berElement(&msg, 0x02); !ok {
+		return 0, false
+	}
+	// ExtendedResponse: [APPLICATION 24], starting with the result code
+	resp, ok := berElement(&msg, 0x78)
+	if !ok {
+		return 0, false
+	}
+	code, ok := berElement(&resp, 0x0a)
+	if !ok || len(code) != 1 {
+		return 0, false
+	}
+	return int(code[0]), true
+}
+
+// berElement consumes a BER encoded element with the given tag and returns its content.
+func berElement(s *cursor, tag byte) (cursor, bool) {
+
+	t, ok := s.uint8()
+	if !ok || t != tag {
+		return nil, false
+	}
+	n, ok := s.uint8()
+	if !ok {
+		return nil, false
+	}
+
+	length := int(n)
+	if n&0x80 != 0 {
+		// long form
+		size := int(n & 0x7f)
+		if size == 0 || size > 4 || len(*s) < size {
+			return nil, false
+		}
+		var v [4]byte
+		copy(v[4-size:], (*s)[:size])
+		length = int(binary.BigEndian.Uint32(v[:]))
+		s.skip(size)
+	}
+	return s.bytes(length)
+}
+
+// isClient reports whether h carries the data sent by the client of a TCP connection,
+// based on the TCP handshake if it was captured, or on the port numbers otherwise.
+func (f *flow) isClient(h *halfStream) bool {
+	if h.role != roleUnknown {
+		return h.role == roleClient
+	}
+	for _, o := range f.halves {
+		if o != nil && o != h && o.role != roleUnknown {
+			return o.role == roleServer
+		}
+	}
+	return binary.BigEndian.Uint16(h.transport.Src().Raw()) > binary.BigEndian.Uint16(h.transport.Dst().Raw())
+}
+
+// negotiate inspects the plaintext of a TCP connection for an upgrade to TLS.
+// It reports whether the stream of h continues with TLS records.
+func (a *assembler) negotiate(f *flow, h *halfStream) bool {
+
+	if f.upgrade == nil {
+		f.upgrade = &upgrade{}
+	}
+	u := f.upgrade
+
+	var (
+		data   = h.buf
+		result = upgradePending
+	)
+	if f.isClient(h) {
+		if u.protocol == "" {
+			u.protocol, u.tag = upgradeRequest(data)
+		}
+	} else if u.protocol != "" {
+		result = upgradeResponse(u.protocol, u.tag, data)
+	}
+
+	switch result {
+	case upgradeAccepted:
+		// both directions continue with TLS
+		u.upgraded = u.protocol
+		u.protocol = ""
+		for _, o := range f.halves {
+			if o != nil && o.plain {
+				o.plain = false
+				o.plaintext = 0
+				o.buf = o.buf[:0]
+			}
+		}
+		return true
+	case upgradeRefused:
+		u.protocol = ""
+	}
+
+	// keep an incomplete line for the next segments
+	h.plaintext += len(data)
+	rest := data[bytes.LastIndexByte(data, '\n')+1:]
+	if u.protocol != "" || len(rest) > maxPartialLine {
+		rest = nil
+	}
+	h.plaintext -= len(rest)
+	h.buf = append(h.buf[:0], rest...)
+
+	if h.plaintext > maxPlaintext {
+		h.release()
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"testing"
+
+	"github.com/google/gopacket"
+)
+
+// conversation returns the TCP segments for the payloads, which are sent by the server if prefixed with "S:" and by the client otherwise.
+func conversation(t *testing.T, payloads ...[]byte) []gopacket.Packet {
+
+	var (
+		clientSeq uint32 = 1001
+		serverSeq uint32 = 5001
+		packets          = []gopacket.Packet{
+			tcpPacket(t, false, clientSeq-1, true, nil),
+			tcpPacket(t, true, serverSeq-1, true, nil),
+		}
+	)
+
+	for _, p := range payloads {
+		if len(p) > 2 && p[0] == 'S' && p[1] == ':' {
+			packets = append(packets, tcpPacket(t, true, serverSeq, false, p[2:]))
+			serverSeq += uint32(len(p) - 2)
+			continue
+		}
+		packets = append(packets, tcpPacket(t, false, clientSeq, false, p))
+		clientSeq += uint32(len(p))
+	}
+	return packets
+}
+
+/*
+ *	Tests
+ */
+
+func TestStartTLS(t *testing.T) {
+
+	tests := []struct {
+		protocol string
+		payloads []string
+	}{
+		{StartTLSSMTP, []string{
+			"S:220 mail.example.com ESMTP\r\n",
+			"EHLO client.example.com\r\n",
+			"S:250-mail.example.com\r\n250-STARTTLS\r\n250 OK\r\n",
+			"STARTTLS\r\n",
+			"S:220 2.0.0 Ready to start TLS\r\n",
+		}},
+		{StartTLSIMAP, []string{
+			"S:* OK IMAP4rev1 ready\r\n",
+			"a1 CAPABILITY\r\n",
+			"S:* CAPABILITY IMAP4rev1 STARTTLS\r\na1 OK done\r\n",
+			"a2 STARTTLS\r\n",
+			"S:a2 OK Begin TLS negotiation now\r\n",
+		}},
+		{StartTLSPOP3, []string{
+			"S:+OK POP3 ready\r\n",
+			"CAPA\r\n",
+			"S:+OK\r\nSTLS\r\n.\r\n",
+			"STLS\r\n",
+			"S:+OK Begin TLS\r\n",
+		}},
+		{StartTLSFTP, []string{
+			"S:220 FTP server ready\r\n",
+			"AUTH TLS\r\n",
+			"S:234 AUTH TLS successful\r\n",
+		}},
+		{StartTLSXMPP, []string{
+			"<?xml version='1.0'?><stream:stream to='example.com' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>",
+			"S:<?xml version='1.0'?><stream:stream from='example.com' id='1' xmlns='jabber:client' xmlns:stream='http://etherx.jabber.org/streams' version='1.0'>" +
+				"<stream:features><starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'><required/></starttls></stream:features>",
+			"<starttls xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>",
+			"S:<proceed xmlns='urn:ietf:params:xml:ns:xmpp-tls'/>",
+		}},
+		{StartTLSLDAP, []string{
+			"\x30\x1d\x02\x01\x01\x77\x18\x80\x161.3.6.1.4.1.1466.20037",
+			"S:\x30\x0c\x02\x01\x01\x78\x07\x0a\x01\x00\x04\x00\x04\x00",
+		}},
+		{StartTLSPostgreSQL, []string{
+			"\x00\x00\x00\x08\x04\xd2\x16\x2f",
+			"S:S",
+		}},
+	}
+
+	for _, test := range tests {
+
+		var payloads [][]byte
+		for _, p := range test.payloads {
+			payloads = append(payloads, []byte(p))
+		}
+		payloads = append(payloads, clientHelloPayload(), append([]byte("S:"), serverHelloPayload(t)...))
+
+		records := collectRecords(t, conversation(t, payloads...)...)
+		if len(records) != 2 {
+			t.Fatal(test.protocol, "expected 2 records, got", len(records))
+		}
+		if records[0].JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" || records[1].JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" {
+			t.Fatal(test.protocol, "unexpected fingerprints", records[0].JA3Digest, records[1].JA3SDigest)
+		}
+		for _, r := range records {
+			if r.StartTLS != test.protocol {
+				t.Fatal(test.protocol, "unexpected protocol", r.StartTLS)
+			}
+		}
+	}
+}
+
+func TestStartTLSRefused(t *testing.T) {
+
+	packets := conversation(t,
+		[]byte("S:220 mail.example.com ESMTP\r\n"),
+		[]byte("STARTTLS\r\n"),
+		[]byte("S:454 4.7.0 TLS not available due to temporary reason\r\n"),
+		[]byte("NOOP\r\n"),
+		[]byte("S:220 2.0.0 OK\r\n"),
+	)
+
+	a := newAssembler(true, func(r *Record) error {
+		t.Fatal("unexpected record")
+		return nil
+	})
+	for _, p := range packets {
+		a.processPacket(p, p.Metadata().Timestamp)
+	}
+
+	for _, f := range a.flows {
+		if f.upgrade == nil || f.upgrade.upgraded != "" || f.upgrade.protocol != "" {
+			t.Fatal("unexpected upgrade state", f.upgrade)
+		}
+		for _, h := range f.halves {
+			if !h.plain {
+				t.Fatal("stream is not in plaintext state")
+			}
+		}
+	}
+}
+
+func TestStartTLSPlaintextLimit(t *testing.T) {
+
+	var (
+		line    = []byte("GET / HTTP/1.1\r\n")
+		request []byte
+	)
+	for len(request) <= maxPlaintext {
+		request = append(request, line...)
+	}
+
+	a := newAssembler(true, func(r *Record) error {
+		t.Fatal("unexpected record")
+		return nil
+	})
+	for _, p := range conversation(t, request) {
+		a.processPacket(p, p.Metadata().Timestamp)
+	}
+
+	for _, f := range a.flows {
+		for _, h := range f.halves {
+			if h != nil && h.role == roleClient && !h.done {
+				t.Fatal("plaintext stream has not been released")
+			}
+		}
+	}
+}
@@ -0,0 +1,899 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/dreadl0ck/tlsx"
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+const (
+	// maxStreamBuffer limits the number of bytes buffered per direction
+	// while waiting for a complete handshake message.
+	maxStreamBuffer = 1 << 18
+
+	// maxPendingSegments limits the number of out-of-order segments kept per direction.
+	maxPendingSegments = 64
+
+	// flowTimeout is the time after which idle flows are evicted, based on packet timestamps.
+	flowTimeout = 2 * time.Minute
+)
+
+// Roles of the directions of a TCP connection.
+const (
+	roleUnknown = iota
+	roleClient
+	roleServer
+)
+
+// flowKey identifies a connection independent of the direction of a packet.
+type flowKey struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+}
+
+// newFlowKey orders the endpoints so that both directions of a connection map to the same key.
+func newFlowKey(network, transport gopacket.Flow) flowKey {
+	src, dst := network.Endpoints()
+	if dst.LessThan(src) || (src == dst && transport.Dst().LessThan(transport.Src())) {
+		return flowKey{network: network.Reverse(), transport: transport.Reverse()}
+	}
+	return flowKey{network: network, transport: transport}
+}
+
+// segment is a TCP payload that arrived ahead of the next expected sequence number.
+type segment struct {
+	seq  uint32
+	data []byte
+}
+
+// halfStream reassembles one direction of a TCP connection
+// and splits the resulting byte stream into TLS handshake messages.
+// For QUIC and DTLS it reassembles the CRYPTO frames or handshake fragments.
+type halfStream struct {
+	network   gopacket.Flow
+	transport gopacket.Flow
+
+	// next expected sequence number, only valid if seqKnown is set
+	seq      uint32
+	seqKnown bool
+	pending  []segment
+
+	// reassembled bytes that have not been consumed yet
+	buf []byte
+
+	// handshake message fragments collected from consecutive records
+	handshake     []byte
+	recordVersion uint16
+
+	// handshake message being reassembled from DTLS fragments
+	dtls *dtlsMessage
+
+	// handshake traffic keys of a TLS 1.3 server, if its secret is in the key log
+	keys *tls13Keys
+
+	// set while the stream carries plaintext that may be followed by an upgrade to TLS,
+	// along with the number of plaintext bytes inspected so far
+	plain     bool
+	plaintext int
+
+	// direction of the stream, as seen in the TCP handshake
+	role int
+
+	// set once the stream was identified as SSH
+	ssh bool
+
+	// set while an HTTP request is consumed, along with the number of body bytes still to be skipped
+	http     bool
+	httpBody int
+
+	// set while the application data of a TLS 1.3 client is decrypted for its HTTP/2 frames,
+	// along with the plaintext so far and the number of records the keys did not decrypt
+	http2   bool
+	appData []byte
+	skipped int
+
+	// JA4T or JA4TS fingerprint and p0f label of the SYN or SYN-ACK
+	ja4t string
+	p0f  string
+
+	closed bool
+	done   bool
+}
+
+// flow holds the state for both directions of a connection.
+type flow struct {
+	halves   [2]*halfStream
+	lastSeen time.Time
+
+	// number of the last packet of the connection in the source
+	packet int
+
+	// client hello record waiting for the server hello, if pairing is enabled
+	client *Record
+
+	// server hello record waiting for the certificate chain, if JA4X is enabled
+	server *Record
+
+	// client hello record waiting for the HTTP/2 frames of the client, if HTTP/2 is enabled and the client's
+	// application data can be decrypted. It may be the pending client or server record at the same time.
+	http2 *Record
+
+	// transport protocol as encoded in JA4 fingerprints
+	protocol byte
+
+	// random of the client hello, only kept if a key log is available
+	random []byte
+
+	// Initial keys, only set for QUIC connections
+	quic *quicConnection
+
+	// plaintext phase of TCP connections that did not start with TLS
+	upgrade *upgrade
+}
+
+// transport returns the transport protocol of the connection as stored in records.
+// It is empty for TCP to keep the output of existing consumers unchanged.
+func (f *flow) transport() string {
+	switch f.protocol {
+	case JA4ProtocolQUIC:
+		return TransportQUIC
+	case JA4ProtocolDTLS:
+		return TransportDTLS
+	}
+	return ""
+}
+
+// newRecord creates a Record for the direction h of the connection.
+func (f *flow) newRecord(h *halfStream, ts time.Time) *Record {
+	r := newRecord(h.network, h.transport, ts)
+	r.Transport = f.transport()
+	r.packet = f.packet
+	if f.upgrade != nil {
+		r.StartTLS = f.upgrade.upgraded
+	}
+	switch h.role {
+	case roleClient:
+		r.JA4T, r.P0f = h.ja4t, h.p0f
+	case roleServer:
+		r.JA4TS, r.P0fServer = h.ja4t, h.p0f
+	}
+	return r
+}
+
+// half returns the halfStream for the direction of the supplied flows, creating it if necessary.
+func (f *flow) half(network, transport gopacket.Flow) *halfStream {
+	for _, h := range f.halves {
+		if h != nil && h.network == network && h.transport == transport {
+			return h
+		}
+	}
+	h := &halfStream{network: network, transport: transport}
+	if f.halves[0] == nil {
+		f.halves[0] = h
+	} else {
+		f.halves[1] = h
+	}
+	return h
+}
+
+// pending removes the records of the connection that are still waiting for a message and returns them.
+func (f *flow) pending() []*Record {
+	var records []*Record
+	for _, r := range []*Record{f.client, f.server} {
+		if r != nil {
+			records = append(records, r)
+		}
+	}
+	if r := f.http2; r != nil && r != f.client && r != f.server {
+		records = append(records, r)
+	}
+	f.client, f.server, f.http2 = nil, nil, nil
+	return records
+}
+
+// finished reports whether no more data is expected from both directions.
+func (f *flow) finished() bool {
+	for _, h := range f.halves {
+		if h == nil || !(h.done || h.closed) {
+			return false
+		}
+	}
+	return true
+}
+
+// assembler reassembles TCP streams so that handshake messages
+// spanning multiple or out-of-order segments are fingerprinted.
+type assembler struct {
+	doJA3s bool
+	opts   options
+	flows  map[flowKey]*flow
+	emit   func(r *Record) error
+
+	// first error returned by emit, no more records are emitted afterwards
+	err error
+
+	count      int
+	badPackets int
+	lastEvict  time.Time
+
+	// name of the source and number of the packet that is processed, starting at 1
+	name   string
+	packet int
+
+	// set for the assemblers of parallel workers, whose idle flows are evicted when the reader says so
+	sharded bool
+}
+
+// newAssembler returns an assembler that invokes emit for every fingerprint found.
+func newAssembler(doJA3s bool, emit func(r *Record) error, opts ...Option) *assembler {
+	return &assembler{
+		doJA3s: doJA3s,
+		opts:   newOptions(opts),
+		flows:  make(map[flowKey]*flow),
+		emit:   emit,
+	}
+}
+
+// processPacket feeds a decoded packet into the assembler.
+func (a *assembler) processPacket(p gopacket.Packet, ts time.Time) {
+	var tl gopacket.TransportLayer
+	if tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP); ok {
+		tl = tcp
+	} else if udp, ok := p.Layer(layers.LayerTypeUDP).(*layers.UDP); ok {
+		tl = udp
+	}
+	a.processLayers(p.NetworkLayer(), tl, ts)
+}
+
+// processData decodes the packet in data with the decoder and feeds it into the assembler.
+func (a *assembler) processData(d *PacketDecoder, data []byte, ts time.Time) {
+	defer a.recoverBadPacket()
+	nl, tl := d.Decode(data)
+	a.processLayers(nl, tl, ts)
+}
+
+// processLayers feeds the network layer and the TCP or UDP layer of a packet into the assembler.
+// Malformed packets that cause a panic while decoding are skipped.
+func (a *assembler) processLayers(nl gopacket.NetworkLayer, tl gopacket.TransportLayer, ts time.Time) {
+	defer a.recoverBadPacket()
+
+	if nl == nil {
+		return
+	}
+	if !a.sharded && evicts(tl) {
+		a.evict(ts)
+	}
+	switch t := tl.(type) {
+	case *layers.TCP:
+		a.assemble(nl, t, ts)
+	case *layers.UDP:
+		a.assembleUDP(nl.NetworkFlow(), t, ts)
+	}
+}
+
+// recoverBadPacket counts a packet that caused a panic as bad packet, it must be deferred.
+func (a *assembler) recoverBadPacket() {
+	if r := recover(); r != nil {
+		a.badPackets++
+		if Debug {
+			fmt.Println("skipping bad packet:", r)
+		}
+	}
+}
+
+// assembleUDP passes datagrams carrying DTLS records or QUIC packets on to their handling.
+func (a *assembler) assembleUDP(network gopacket.Flow, udp *layers.UDP, ts time.Time) {
+	if isDTLSRecord(udp.LayerPayload()) {
+		a.assembleDTLS(network, udp, ts)
+	} else {
+		a.assembleQUIC(network, udp, ts)
+	}
+}
+
+// evicts reports whether idle flows are evicted before a packet with the transport layer is processed,
+// which is the case for TCP segments, DTLS records and QUIC long header packets.
+func evicts(tl gopacket.TransportLayer) bool {
+	switch t := tl.(type) {
+	case *layers.TCP:
+		return true
+	case *layers.UDP:
+		payload := t.LayerPayload()
+		return isDTLSRecord(payload) || (len(payload) > 0 && payload[0]&0x80 != 0)
+	}
+	return false
+}
+
+// assemble adds a TCP segment to the stream of its connection.
+func (a *assembler) assemble(nl gopacket.NetworkLayer, tcp *layers.TCP, ts time.Time) {
+
+	var (
+		network   = nl.NetworkFlow()
+		transport = tcp.TransportFlow()
+		key       = newFlowKey(network, transport)
+		f         = a.flows[key]
+		payload   = tcp.LayerPayload()
+	)
+
+	if f == nil {
+		if tcp.RST || (tcp.FIN && len(payload) == 0) {
+			// nothing to reassemble
+			return
+		}
+		f = &flow{protocol: JA4ProtocolTCP}
+		a.flows[key] = f
+	}
+	f.lastSeen, f.packet = ts, a.packet
+
+	h := f.half(network, transport)
+	seq := tcp.Seq
+	if tcp.SYN {
+		seq++
+		h.seq = seq
+		h.seqKnown = true
+		h.role = roleClient
+		if tcp.ACK {
+			h.role = roleServer
+		}
+		if a.opts.ja4t && h.ja4t == "" {
+			h.ja4t = JA4T(tcp)
+		}
+		if a.opts.p0f != nil && h.p0f == "" {
+			h.p0f = a.opts.p0f.match(nl, tcp)
+		}
+	}
+
+	if len(payload) > 0 && !h.done {
+		h.reassemble(seq, payload)
+		a.consume(f, h, ts)
+	}
+
+	if tcp.FIN {
+		h.closed = true
+	}
+	if tcp.RST || f.finished() {
+		a.outputPending(f)
+		delete(a.flows, key)
+	}
+}
+
+// evict removes flows that have been idle for longer than flowTimeout
+// and emits client hellos that did not receive a server hello within the pairing timeout.
+// The flows are only checked if half of the shorter timeout has passed since the last check.
+func (a *assembler) evict(now time.Time) {
+	if a.evictDue(now) {
+		a.evictIdle(now)
+	}
+}
+
+// evictDue reports whether the flows must be checked for eviction at the given time,
+// and if so, records the time of the check.
+func (a *assembler) evictDue(now time.Time) bool {
+	interval := flowTimeout / 2
+	if a.opts.pair && a.opts.pairTimeout/2 < interval {
+		interval = a.opts.pairTimeout / 2
+	}
+	if now.Sub(a.lastEvict) < interval {
+		return false
+	}
+	a.lastEvict = now
+	return true
+}
+
+// evictIdle removes the idle flows and emits the expired records, regardless of the time of the last check.
+func (a *assembler) evictIdle(now time.Time) {
+
+	var expired []*Record
+	for k, f := range a.flows {
+		if f.client != nil && f.client != f.http2 && now.Sub(f.client.ts) > a.opts.pairTimeout {
+			expired = append(expired, f.client)
+			f.client = nil
+		}
+		if now.Sub(f.lastSeen) > flowTimeout {
+			expired = append(expired, f.pending()...)
+			delete(a.flows, k)
+		}
+	}
+	a.outputSorted(expired)
+}
+
+// flush emits all client hellos that are still waiting for a server hello or the HTTP/2 frames of the client,
+// and all server hellos that are still waiting for the certificate chain.
+func (a *assembler) flush() {
+	var pending []*Record
+	for _, f := range a.flows {
+		pending = append(pending, f.pending()...)
+	}
+	a.outputSorted(pending)
+}
+
+// outputPending emits the records of a connection that are still waiting for a message of the other side.
+func (a *assembler) outputPending(f *flow) {
+	for _, r := range f.pending() {
+		a.output(r)
+	}
+}
+
+// outputFlow emits a record of the connection, unless it waits for the HTTP/2 frames of the client.
+func (a *assembler) outputFlow(f *flow, r *Record) {
+	if r != f.http2 {
+		a.output(r)
+	}
+}
+
+// output passes a record to the emit callback.
+func (a *assembler) output(r *Record) {
+	if a.err != nil {
+		return
+	}
+	if a.opts.db != nil {
+		a.opts.db.Annotate(r)
+	}
+	if a.opts.source {
+		r.SourceFile, r.Packet = a.name, r.packet
+	}
+	a.count++
+	a.err = a.emit(r)
+}
+
+// outputSorted emits the records in the order of their timestamps.
+func (a *assembler) outputSorted(records []*Record) {
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ts.Before(records[j].ts)
+	})
+	for _, r := range records {
+		a.output(r)
+	}
+}
+
+// reassemble appends in-order data to the buffer and keeps early segments until the gap is filled.
+func (h *halfStream) reassemble(seq uint32, data []byte) {
+
+	if !h.seqKnown {
+		// we did not see the connection setup:
+		// only start the stream at a segment that looks like the start of a message we fingerprint,
+		// keep everything else around in case an earlier segment is still missing.
+		if !isStreamStart(data) {
+			h.addPending(seq, data)
+			return
+		}
+		h.seq = seq
+		h.seqKnown = true
+	}
+
+	diff := int32(seq - h.seq)
+	if diff > 0 {
+		h.addPending(seq, data)
+		return
+	}
+	if int(-diff) >= len(data) {
+		// retransmission
+		return
+	}
+	h.buf = append(h.buf, data[-diff:]...)
+	h.seq += uint32(len(data) + int(diff))
+
+	// drain segments that are now in order
+	for len(h.pending) > 0 {
+		s := h.pending[0]
+		diff = int32(s.seq - h.seq)
+		if diff > 0 {
+			break
+		}
+		h.pending = h.pending[1:]
+		if int(-diff) < len(s.data) {
+			h.buf = append(h.buf, s.data[-diff:]...)
+			h.seq += uint32(len(s.data) + int(diff))
+		}
+	}
+}
+
+// addPending stores a copy of an out-of-order segment, sorted by sequence number.
+func (h *halfStream) addPending(seq uint32, data []byte) {
+	if len(h.pending) >= maxPendingSegments {
+		if Debug {
+			fmt.Println("too many out of order segments, giving up on stream", h.network, h.transport)
+		}
+		h.release()
+		return
+	}
+
+	s := segment{seq: seq, data: append([]byte(nil), data...)}
+	i := len(h.pending)
+	for i > 0 && int32(h.pending[i-1].seq-seq) > 0 {
+		i--
+	}
+	h.pending = append(h.pending, segment{})
+	copy(h.pending[i+1:], h.pending[i:])
+	h.pending[i] = s
+}
+
+// release marks the stream as done and drops all buffered data.
+func (h *halfStream) release() {
+	h.done = true
+	h.buf = nil
+	h.pending = nil
+	h.handshake = nil
+	h.dtls = nil
+	h.keys = nil
+	h.appData = nil
+}
+
+// isRecordStart checks whether data starts with a TLS handshake record header.
+func isRecordStart(data []byte) bool {
+	return len(data) >= 3 && data[0] == recordTypeHandshake && data[1] == 3
+}
+
+// isStreamStart checks whether data starts with a TLS handshake record, an SSLv2 client hello, an SSH identification string,
+// an HTTP request or the complete HTTP/2 connection preface, at which a stream without its connection setup can be picked up.
+func isStreamStart(data []byte) bool {
+	return isRecordStart(data) || isSSLv2ClientHello(data) || isSSHIdentification(data) || isHTTPRequest(data) ||
+		len(data) >= len(http2Preface) && isHTTP2Preface(data)
+}
+
+// nextHandshake returns the next complete handshake message, including its 4 byte header.
+func (h *halfStream) nextHandshake() ([]byte, bool) {
+	for {
+		if len(h.handshake) >= 4 {
+			n := 4 + int(uint32(h.handshake[1])<<16|uint32(h.handshake[2])<<8|uint32(h.handshake[3]))
+			if len(h.handshake) >= n {
+				msg := h.handshake[:n]
+				h.handshake = h.handshake[n:]
+				return msg, true
+			}
+		}
+
+		if h.keys != nil && len(h.buf) > 0 && h.buf[0] != recordTypeHandshake {
+			if !h.decryptRecord() {
+				return nil, false
+			}
+			continue
+		}
+		if len(h.buf) > 0 && (h.buf[0] != recordTypeHandshake || len(h.buf) >= 3 && !isRecordStart(h.buf)) {
+			// not a handshake record, the connection may be upgraded to TLS later on
+			h.plain = true
+			return nil, false
+		}
+		if len(h.buf) < 5 {
+			return nil, false
+		}
+
+		length := int(binary.BigEndian.Uint16(h.buf[3:5]))
+		if length > maxRecordLength {
+			h.release()
+			return nil, false
+		}
+		if len(h.buf) < 5+length {
+			return nil, false
+		}
+
+		h.recordVersion = binary.BigEndian.Uint16(h.buf[1:3])
+		h.handshake = append(h.handshake, h.buf[5:5+length]...)
+		h.buf = h.buf[5+length:]
+	}
+}
+
+// consume processes all complete handshake messages in the stream.
+func (a *assembler) consume(f *flow, h *halfStream, ts time.Time) {
+	for !h.done {
+		if h.http2 {
+			a.consumeApplicationData(f, h)
+			break
+		}
+		if h.http {
+			if !a.consumeHTTP(f, h, ts) {
+				break
+			}
+			continue
+		}
+		msg, ok := h.nextHandshake()
+		if ok {
+			a.handleHandshake(f, h, msg, ts)
+			continue
+		}
+		if h.plain && h.plaintext == 0 && f.isClient(h) && isSSLv2ClientHello(h.buf) {
+			a.consumeSSLv2(f, h, ts)
+			break
+		}
+		if h.plain && f.server != nil {
+			// change cipher spec of a resumed session
+			a.outputFlow(f, f.server)
+			f.server = nil
+			h.release()
+			break
+		}
+		if h.plain && a.opts.hassh && (h.ssh || isSSHIdentification(h.buf)) {
+			a.consumeSSH(f, h, ts)
+			break
+		}
+		if h.plain && a.opts.ja4h && isHTTPRequest(h.buf) {
+			h.http = true
+			continue
+		}
+		if h.plain && a.opts.http2 && isHTTP2Preface(h.buf) {
+			a.consumeHTTP2(f, h, ts)
+			break
+		}
+		if !h.plain || !a.negotiate(f, h) {
+			break
+		}
+	}
+	if len(h.buf)+len(h.handshake) > maxStreamBuffer {
+		h.release()
+	}
+}
+
+// consumeSSLv2 fingerprints the SSLv2 client hello at the start of a stream, once it is complete.
+// The connection is not followed any further.
+func (a *assembler) consumeSSLv2(f *flow, h *halfStream, ts time.Time) {
+
+	length := int(h.buf[0]&0x7f)<<8 | int(h.buf[1])
+	if len(h.buf) < 2+length {
+		return
+	}
+	defer h.release()
+
+	var hello SSLv2ClientHello
+	if err := hello.Unmarshal(h.buf); err != nil {
+		if Debug {
+			fmt.Println(err, h.network, h.transport)
+		}
+		return
+	}
+
+	bare := BareSSLv2(&hello)
+	r := f.newRecord(h, ts)
+	r.JA3 = string(bare)
+	r.JA3Digest = BareToDigestHex(bare)
+	r.SSLv2 = true
+	a.output(r)
+}
+
+// handleHandshake fingerprints client and server hello messages.
+func (a *assembler) handleHandshake(f *flow, h *halfStream, msg []byte, ts time.Time) {
+
+	if f.server != nil {
+		if h.keys != nil {
+			a.handleEncryptedHandshake(f, h, msg)
+		} else {
+			a.handleCertificate(f, h, msg)
+		}
+		return
+	}
+
+	// no more handshake messages are needed from this direction,
+	// unless the certificate chain follows the server hello
+	var wait bool
+	defer func() {
+		if !wait {
+			h.release()
+		}
+	}()
+
+	record := handshakeRecord(h.recordVersion, msg)
+	if record == nil {
+		return
+	}
+
+	switch msg[0] {
+	case handshakeTypeClientHello:
+		var hello tlsx.ClientHelloBasic
+		if err := hello.Unmarshal(record); err != nil {
+			if Debug {
+				fmt.Println(err, h.network, h.transport)
+			}
+			return
+		}
+
+		if a.opts.keyLog != nil && len(msg) >= 38 {
+			// version (2) + random (32) after the header
+			f.random = append([]byte(nil), msg[6:38]...)
+		}
+
+		bare := Bare(&hello)
+		r := f.newRecord(h, ts)
+		r.JA3 = string(bare)
+		r.JA3Digest = BareToDigestHex(bare)
+
+		if a.opts.ja4 || a.opts.pair {
+			var ext ClientHelloExtensions
+			if err := ext.Unmarshal(record); err != nil {
+				if Debug {
+					fmt.Println(err, h.network, h.transport)
+				}
+			} else {
+				r.SNI = ext.ServerName
+				if a.opts.ja4 {
+					r.JA4 = JA4(&hello, &ext, f.protocol)
+					r.JA4R = JA4R(&hello, &ext, f.protocol)
+					r.JA4O = JA4O(&hello, &ext, f.protocol)
+				}
+			}
+		}
+
+		if a.opts.ech {
+			r.ECH = InspectECH(msg, a.opts.echKeys, f.protocol)
+		}
+
+		if a.opts.http2 && f.random != nil && f.protocol == JA4ProtocolTCP && a.opts.keyLog.clientTrafficSecret(f.random) != nil {
+			// keep following the client for the HTTP/2 frames it sends once the handshake is done
+			f.http2 = r
+			h.http2 = true
+			wait = true
+		}
+
+		if a.opts.pair && a.doJA3s {
+			// wait for the server hello
+			f.client = r
+			return
+		}
+
+		a.outputFlow(f, r)
+
+	case handshakeTypeServerHello:
+		if !a.doJA3s {
+			return
+		}
+
+		var hello tlsx.ServerHelloBasic
+		if err := hello.Unmarshal(record); err != nil {
+			if Debug {
+				fmt.Println(err, h.network, h.transport)
+			}
+			return
+		}
+
+		bare := BareJa3s(&hello)
+		r := f.newRecord(h, ts)
+		r.JA3S = string(bare)
+		r.JA3SDigest = BareToDigestHex(bare)
+
+		var ext ServerHelloExtensions
+		if a.opts.ja4 || a.opts.ja4x || a.opts.keyLog != nil {
+			if err := ext.Unmarshal(record); err != nil {
+				if Debug {
+					fmt.Println(err, h.network, h.transport)
+				}
+			} else if a.opts.ja4 {
+				r.JA4S = JA4S(&hello, &ext, f.protocol)
+				r.JA4SR = JA4SR(&hello, &ext, f.protocol)
+			}
+		}
+
+		if f.http2 != nil {
+			a.followHTTP2(f, hello.CipherSuite, ext.SelectedVersion)
+		}
+
+		if c := f.client; c != nil {
+			// combine with the client hello of this connection
+			c.JA3S = r.JA3S
+			c.JA3SDigest = r.JA3SDigest
+			c.JA4S = r.JA4S
+			c.JA4SR = r.JA4SR
+			c.JA4TS = r.JA4TS
+			c.P0fServer = r.P0fServer
+			c.HandshakeRTT = ts.Sub(c.ts).Seconds()
+			f.client = nil
+			r = c
+		}
+
+		if f.random != nil && f.protocol == JA4ProtocolTCP && ext.SelectedVersion == tlsVersion13 {
+			if secret := a.opts.keyLog.serverHandshakeSecret(f.random); secret != nil {
+				// the encrypted extensions and the certificate chain follow encrypted with the handshake traffic keys
+				if h.keys = newTLS13Keys(hello.CipherSuite, secret); h.keys != nil {
+					f.server = r
+					wait = true
+					return
+				}
+			}
+		}
+
+		if a.opts.ja4x && f.protocol == JA4ProtocolTCP && ext.SelectedVersion != tlsVersion13 {
+			// the certificate chain is only sent in the clear up to TLS 1.2
+			f.server = r
+			wait = true
+			return
+		}
+
+		a.outputFlow(f, r)
+	}
+}
+
+// handleCertificate adds the certificate chain following the server hello to its pending record and emits it.
+// Resumed sessions continue without a certificate message.
+func (a *assembler) handleCertificate(f *flow, h *halfStream, msg []byte) {
+
+	defer h.release()
+
+	r := f.server
+	f.server = nil
+
+	if msg[0] == handshakeTypeCertificate {
+		certs, err := ParseCertificateMessage(msg)
+		if err != nil && Debug {
+			fmt.Println(err, h.network, h.transport)
+		}
+		r.Certificates = certs
+	}
+
+	a.outputFlow(f, r)
+}
+
+// newRecord creates a Record for the given direction of a connection.
+func newRecord(network, transport gopacket.Flow, ts time.Time) *Record {
+	return &Record{
+		DestinationIP:   network.Dst().String(),
+		DestinationPort: int(binary.BigEndian.Uint16(transport.Dst().Raw())),
+		SourceIP:        network.Src().String(),
+		SourcePort:      int(binary.BigEndian.Uint16(transport.Src().Raw())),
+		Timestamp:       timeToFloat(ts),
+		ts:              ts,
+	}
+}
+
+// readPackets decodes all packets from the named source and feeds them into the assembler until EOF
+// or until the context is cancelled.
+// If the source ends in the middle of a packet, the pending records are flushed and a TruncatedFileError is returned.
+func (a *assembler) readPackets(ctx context.Context, name string, r PacketSource, link layers.LinkType) error {
+	a.name = name
+	if a.opts.workers > 1 {
+		return a.readPacketsParallel(ctx, name, r, link)
+	}
+
+	var (
+		done    = ctx.Done()
+		decoder = NewPacketDecoder(link)
+	)
+	for packets := 0; ; packets++ {
+		if done != nil {
+			select {
+			case <-done:
+				return ctx.Err()
+			default:
+			}
+		}
+
+		// read packet data
+		data, ci, err := r.ReadPacketData()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			a.flush()
+			if Debug {
+				fmt.Println(a.count, "fingerprints,", a.badPackets, "bad packets.")
+			}
+			if a.err == nil && err == io.ErrUnexpectedEOF {
+				return &TruncatedFileError{File: name, Packets: packets, Err: err}
+			}
+			return a.err
+		} else if err != nil {
+			return err
+		}
+
+		a.packet = packets + 1
+		a.processData(decoder, data, ci.Timestamp)
+		if a.err != nil {
+			return a.err
+		}
+	}
+}
@@ -0,0 +1,320 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// tcpPacket serializes an ethernet frame carrying a TCP segment from 192.168.1.14:49391 to 23.23.97.184:443,
+// or in the opposite direction if reply is set. A SYN in the opposite direction is acknowledging.
+func tcpPacket(t testing.TB, reply bool, seq uint32, syn bool, payload []byte) gopacket.Packet {
+
+	var (
+		eth = &layers.Ethernet{
+			SrcMAC:       net.HardwareAddr{0x00, 0x22, 0x15, 0x63, 0xc9, 0x5a},
+			DstMAC:       net.HardwareAddr{0x68, 0x7f, 0x74, 0xd6, 0x95, 0xc1},
+			EthernetType: layers.EthernetTypeIPv4,
+		}
+		ip = &layers.IPv4{
+			Version:  4,
+			TTL:      64,
+			Protocol: layers.IPProtocolTCP,
+			SrcIP:    net.IP{192, 168, 1, 14},
+			DstIP:    net.IP{23, 23, 97, 184},
+		}
+		tcp = &layers.TCP{
+			SrcPort: 49391,
+			DstPort: 443,
+			Seq:     seq,
+			SYN:     syn,
+			ACK:     !syn || reply,
+			PSH:     len(payload) > 0,
+			Window:  256,
+		}
+		buf = gopacket.NewSerializeBuffer()
+	)
+
+	if reply {
+		eth.SrcMAC, eth.DstMAC = eth.DstMAC, eth.SrcMAC
+		ip.SrcIP, ip.DstIP = ip.DstIP, ip.SrcIP
+		tcp.SrcPort, tcp.DstPort = tcp.DstPort, tcp.SrcPort
+	}
+
+	err := tcp.SetNetworkLayerForChecksum(ip)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = gopacket.SerializeLayers(buf, gopacket.SerializeOptions{FixLengths: true, ComputeChecksums: true}, eth, ip, tcp, gopacket.Payload(payload))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return gopacket.NewPacket(buf.Bytes(), layers.LinkTypeEthernet, gopacket.Default)
+}
+
+// clientHelloPayload returns the TLS record carried in tlsPacket.
+func clientHelloPayload() []byte {
+	return tlsPacket[54:]
+}
+
+// serverHelloPayload returns the TCP payload of tlsServerHelloPacket.
+func serverHelloPayload(t testing.TB) []byte {
+	p := gopacket.NewPacket(tlsServerHelloPacket, layers.LinkTypeEthernet, gopacket.Default)
+	tcp, ok := p.Layer(layers.LayerTypeTCP).(*layers.TCP)
+	if !ok {
+		t.Fatal("no TCP layer")
+	}
+	return tcp.LayerPayload()
+}
+
+func collectRecords(t *testing.T, packets ...gopacket.Packet) []*Record {
+	return collectRecordsWith(t, nil, packets...)
+}
+
+// collectRecordsWith feeds the packets into an assembler with the given options, one millisecond apart.
+func collectRecordsWith(t *testing.T, opts []Option, packets ...gopacket.Packet) []*Record {
+	var (
+		records []*Record
+		a       = newAssembler(true, func(r *Record) error {
+			records = append(records, r)
+			return nil
+		}, opts...)
+		ts = time.Unix(1506363172, 0)
+	)
+	for i, p := range packets {
+		if p.ErrorLayer() != nil {
+			t.Fatal(p.ErrorLayer().Error())
+		}
+		a.processPacket(p, ts.Add(time.Duration(i)*time.Millisecond))
+	}
+	a.flush()
+	return records
+}
+
+/*
+ *	Tests
+ */
+
+func TestReassemblySplitClientHello(t *testing.T) {
+
+	var (
+		hello = clientHelloPayload()
+		isn   = uint32(1000)
+	)
+
+	records := collectRecords(t,
+		tcpPacket(t, false, isn, true, nil),
+		tcpPacket(t, false, isn+1, false, hello[:40]),
+		tcpPacket(t, false, isn+1+40, false, hello[40:100]),
+		tcpPacket(t, false, isn+1+100, false, hello[100:]),
+	)
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if records[0].JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" {
+		t.Fatal(records[0].JA3Digest, "!=", "4d7a28d6f2263ed61de88ca66eb011e3")
+	}
+	if records[0].SourcePort != 49391 || records[0].DestinationPort != 443 {
+		t.Fatal("unexpected ports", records[0].SourcePort, records[0].DestinationPort)
+	}
+}
+
+func TestReassemblyOutOfOrderClientHello(t *testing.T) {
+
+	var (
+		hello = clientHelloPayload()
+		isn   = uint32(0xfffffff0) // force sequence number wrap around
+	)
+
+	records := collectRecords(t,
+		tcpPacket(t, false, isn, true, nil),
+		tcpPacket(t, false, isn+1+100, false, hello[100:]),
+		tcpPacket(t, false, isn+1, false, hello[:60]),
+		// retransmission overlapping both segments
+		tcpPacket(t, false, isn+1+40, false, hello[40:120]),
+	)
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if records[0].JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" {
+		t.Fatal(records[0].JA3Digest, "!=", "4d7a28d6f2263ed61de88ca66eb011e3")
+	}
+}
+
+func TestReassemblyWithoutHandshake(t *testing.T) {
+
+	var (
+		hello = clientHelloPayload()
+		seq   = uint32(5000)
+	)
+
+	// capture started after the connection was established
+	// and the second segment arrives before the first one
+	records := collectRecords(t,
+		tcpPacket(t, false, seq+80, false, hello[80:]),
+		tcpPacket(t, false, seq, false, hello[:80]),
+	)
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if records[0].JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" {
+		t.Fatal(records[0].JA3Digest, "!=", "4d7a28d6f2263ed61de88ca66eb011e3")
+	}
+}
+
+func TestReassemblyWithoutHandshakePlaintext(t *testing.T) {
+
+	for _, test := range []struct {
+		name    string
+		opts    []Option
+		payload []byte
+		check   func(r *Record) bool
+	}{
+		{"sslv2", nil, sslv2ClientHelloPayload(), func(r *Record) bool { return r.SSLv2 && r.JA3 != "" }},
+		{"ssh", []Option{WithHASSH()}, append([]byte("SSH-2.0-OpenSSH_9.0\r\n"), sshPacket(kexInitPayload(clientKexInit))...), func(r *Record) bool { return r.HASSH != "" }},
+		{"http", []Option{WithJA4H()}, []byte("GET / HTTP/1.1\r\nHost: example.com\r\nUser-Agent: curl/8.0\r\nAccept: */*\r\n\r\n"), func(r *Record) bool { return r.JA4H != "" }},
+		{"http2", []Option{WithHTTP2()}, testHTTP2Start(), func(r *Record) bool { return r.HTTP2Digest != "" }},
+	} {
+		// capture started after the connection was established
+		// and the second segment arrives before the first one
+		seq := uint32(5000)
+		records := collectRecordsWith(t, test.opts,
+			tcpPacket(t, false, seq+30, false, test.payload[30:]),
+			tcpPacket(t, false, seq, false, test.payload[:30]),
+		)
+		if len(records) != 1 || !test.check(records[0]) {
+			t.Fatal(test.name, "unexpected records", records)
+		}
+	}
+}
+
+func TestReassemblySplitServerHello(t *testing.T) {
+
+	var (
+		payload = serverHelloPayload(t)
+		seq     = uint32(42)
+	)
+
+	records := collectRecords(t,
+		tcpPacket(t, true, seq, false, payload[:3]),
+		tcpPacket(t, true, seq+3, false, payload[3:]),
+	)
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if records[0].JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" {
+		t.Fatal(records[0].JA3SDigest, "!=", "5b94af9bf6efc9dea416841602004fbb")
+	}
+}
+
+func TestPairing(t *testing.T) {
+
+	records := collectRecordsWith(t, []Option{WithPairing(time.Second)},
+		tcpPacket(t, false, 1000, true, nil),
+		tcpPacket(t, true, 5000, true, nil),
+		tcpPacket(t, false, 1001, false, clientHelloPayload()),
+		tcpPacket(t, true, 5001, false, serverHelloPayload(t)),
+	)
+
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+
+	r := records[0]
+	if r.JA3Digest != "4d7a28d6f2263ed61de88ca66eb011e3" || r.JA3SDigest != "5b94af9bf6efc9dea416841602004fbb" {
+		t.Fatal("unexpected digests", r.JA3Digest, r.JA3SDigest)
+	}
+	if r.SourceIP != "192.168.1.14" || r.DestinationPort != 443 {
+		t.Fatal("record does not originate from the client", r.SourceIP, r.DestinationPort)
+	}
+	if r.SNI != "beacon.krxd.net" {
+		t.Fatal(r.SNI, "!=", "beacon.krxd.net")
+	}
+	if r.HandshakeRTT != 0.001 {
+		t.Fatal("unexpected handshake rtt", r.HandshakeRTT)
+	}
+}
+
+func TestPairingTimeout(t *testing.T) {
+
+	var (
+		records []*Record
+		a       = newAssembler(true, func(r *Record) error {
+			records = append(records, r)
+			return nil
+		}, WithPairing(time.Second))
+		ts = time.Unix(1506363172, 0)
+	)
+
+	a.processPacket(tcpPacket(t, false, 1001, false, clientHelloPayload()), ts)
+	if len(records) != 0 {
+		t.Fatal("client hello emitted before timeout")
+	}
+
+	// unrelated traffic after the timeout expired
+	a.processPacket(tcpPacket(t, true, 9000, true, nil), ts.Add(2*time.Second))
+	if len(records) != 1 {
+		t.Fatal("expected 1 record, got", len(records))
+	}
+	if records[0].JA3Digest == "" || records[0].JA3SDigest != "" || records[0].HandshakeRTT != 0 {
+		t.Fatal("expected an unpaired client record", records[0])
+	}
+}
+
+func TestPairingPcap(t *testing.T) {
+
+	var (
+		b        bytes.Buffer
+		records  []*Record
+		unpaired []*Record
+	)
+
+	ReadFileJSON("test2.pcap", &b, true, WithPairing(0))
+	if err := json.Unmarshal(b.Bytes(), &records); err != nil {
+		t.Fatal(err)
+	}
+
+	b.Reset()
+	ReadFileJSON("test2.pcap", &b, true)
+	if err := json.Unmarshal(b.Bytes(), &unpaired); err != nil {
+		t.Fatal(err)
+	}
+
+	paired := 0
+	for _, r := range records {
+		if r.JA3Digest != "" && r.JA3SDigest != "" {
+			paired++
+			if r.HandshakeRTT <= 0 {
+				t.Fatal("missing handshake rtt", r.SourceIP, r.SourcePort)
+			}
+		}
+	}
+	if paired == 0 || len(records)+paired != len(unpaired) {
+		t.Fatal("unexpected number of records", len(records), paired, len(unpaired))
+	}
+}
@@ -0,0 +1,202 @@
+//go:build !ja3_disable_gopacket
+
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"strconv"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// TLS 1.3 cipher suites whose handshake records can be decrypted.
+const (
+	tlsAES128GCMSHA256        = 0x1301
+	tlsAES256GCMSHA384        = 0x1302
+	tlsChaCha20Poly1305SHA256 = 0x1303
+)
+
+// Record content types that are passed over while decrypting.
+const (
+	recordTypeChangeCipherSpec = 20
+	recordTypeApplicationData  = 23
+)
+
+// tls13Keys decrypt the records a TLS 1.3 server sends with its handshake traffic keys,
+// or a client with its application traffic keys.
+type tls13Keys struct {
+	aead cipher.AEAD
+	iv   []byte
+	seq  uint64
+}
+
+// newTLS13Keys derives the traffic keys from a secret,
+// it returns nil if the cipher suite is not supported or the secret does not match it.
+func newTLS13Keys(suite uint16, secret []byte) *tls13Keys {
+
+	var (
+		newHash   func() hash.Hash
+		keyLength int
+	)
+	switch suite {
+	case tlsAES128GCMSHA256:
+		newHash, keyLength = sha256.New, 16
+	case tlsAES256GCMSHA384:
+		newHash, keyLength = sha512.New384, 32
+	case tlsChaCha20Poly1305SHA256:
+		newHash, keyLength = sha256.New, chacha20poly1305.KeySize
+	default:
+		return nil
+	}
+	if len(secret) != newHash().Size() {
+		return nil
+	}
+
+	var (
+		key  = hkdfExpandLabel(newHash, secret, "key", keyLength)
+		aead cipher.AEAD
+		err  error
+	)
+	if suite == tlsChaCha20Poly1305SHA256 {
+		aead, err = chacha20poly1305.New(key)
+	} else {
+		var block cipher.Block
+		if block, err = aes.NewCipher(key); err == nil {
+			aead, err = cipher.NewGCM(block)
+		}
+	}
+	if err != nil {
+		return nil
+	}
+
+	return &tls13Keys{
+		aead: aead,
+		iv:   hkdfExpandLabel(newHash, secret, "iv", aead.NonceSize()),
+	}
+}
+
+// open decrypts a protected record, including its 5 byte header,
+// and returns the content type and the plaintext without padding.
+// The sequence number only advances if the record is decrypted.
+func (k *tls13Keys) open(record []byte) (byte, []byte, error) {
+
+	nonce := append([]byte(nil), k.iv...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], k.seq)
+	for i := range seq {
+		nonce[len(nonce)-8+i] ^= seq[i]
+	}
+
+	plaintext, err := k.aead.Open(nil, nonce, record[5:], record[:5])
+	if err != nil {
+		return 0, nil, err
+	}
+	k.seq++
+
+	// the content type follows the content, padding consists of zeros
+	for i := len(plaintext) - 1; i >= 0; i-- {
+		if plaintext[i] != 0 {
+			return plaintext[i], plaintext[:i], nil
+		}
+	}
+	return 0, nil, ErrBadLength
+}
+
+// decryptRecord decrypts the next record of a stream with handshake traffic keys and adds the handshake
+// messages it carries. It reports whether a record was consumed.
+func (h *halfStream) decryptRecord() bool {
+
+	if len(h.buf) < 5 {
+		return false
+	}
+	length := int(binary.BigEndian.Uint16(h.buf[3:5]))
+	if length > maxRecordLength {
+		h.release()
+		return false
+	}
+	if len(h.buf) < 5+length {
+		return false
+	}
+	record := h.buf[:5+length]
+	h.buf = h.buf[5+length:]
+
+	switch record[0] {
+	case recordTypeChangeCipherSpec:
+		// sent for middlebox compatibility, it is not protected
+		return true
+	case recordTypeApplicationData:
+		typ, plaintext, err := h.keys.open(record)
+		if err == nil && typ == recordTypeHandshake {
+			h.handshake = append(h.handshake, plaintext...)
+			return true
+		}
+		if err != nil && Debug {
+			fmt.Println("failed to decrypt handshake record:", err, h.network, h.transport)
+		}
+	}
+	h.release()
+	return false
+}
+
+// handleEncryptedHandshake adds the encrypted extensions and the certificate chain a TLS 1.3 server sends
+// after its hello to its pending record, and emits it once the certificate, or the finished message
+// of a resumed session, has been seen.
+func (a *assembler) handleEncryptedHandshake(f *flow, h *halfStream, msg []byte) {
+
+	r := f.server
+
+	switch msg[0] {
+	case handshakeTypeServerHello:
+		// the server hello following a hello retry request
+		return
+	case handshakeTypeEncryptedExtensions:
+		var ext EncryptedExtensions
+		if err := ext.Unmarshal(msg); err != nil {
+			if Debug {
+				fmt.Println(err, h.network, h.transport)
+			}
+		}
+		buffer := make([]byte, 0, 6*len(ext.Extensions))
+		for i, e := range ext.Extensions {
+			if i > 0 {
+				buffer = append(buffer, sepValueByte)
+			}
+			buffer = strconv.AppendUint(buffer, uint64(e), 10)
+		}
+		r.EncryptedExtensions = string(buffer)
+		r.ALPN = ext.ALPN
+		return
+	case handshakeTypeCertificateRequest:
+		return
+	case handshakeTypeCertificate:
+		certs, err := ParseCertificateMessageTLS13(msg)
+		if err != nil && Debug {
+			fmt.Println(err, h.network, h.transport)
+		}
+		r.Certificates = certs
+	}
+
+	h.release()
+	f.server = nil
+	a.outputFlow(f, r)
+}
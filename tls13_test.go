@@ -0,0 +1,340 @@
+/*
+ * JA3 - TLS Client Hello Hash
+ * Copyright (c) 2017, Salesforce.com, Inc.
+ * this code was created by Philipp Mieden <dreadl0ck [at] protonmail [dot] ch>
+ *
+ * THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+ * WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+ * MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ * ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+ * WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ * ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+ * OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+ */
+
+package ja3
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcapgo"
+)
+
+// tls13ServerHello returns a record with a TLS 1.3 server hello selecting the cipher suite.
+func tls13ServerHello(suite uint16) []byte {
+
+	body := []byte{0x03, 0x03}
+	body = append(body, bytes.Repeat([]byte{0x42}, 32)...)
+	body = append(body, 0)                                  // session id
+	body = append(body, byte(suite>>8), byte(suite), 0)     // cipher suite, compression method
+	body = append(body, 0, 6, 0x00, 0x2b, 0, 2, 0x03, 0x04) // supported versions: TLS 1.3
+
+	msg := append([]byte{handshakeTypeServerHello, 0, byte(len(body) >> 8), byte(len(body))}, body...)
+	return handshakeRecord(tlsVersion12, msg)
+}
+
+// handshakeMessage encodes a handshake message with the body.
+func handshakeMessage(typ byte, body []byte) []byte {
+	return append([]byte{typ, byte(len(body) >> 16), byte(len(body) >> 8), byte(len(body))}, body...)
+}
+
+// sealTLS13 encrypts the content into the next record protected by the keys.
+func sealTLS13(k *tls13Keys, typ byte, content []byte) []byte {
+
+	plaintext := append(append([]byte{}, content...), typ, 0, 0)
+	header := []byte{recordTypeApplicationData, 0x03, 0x03, 0, 0}
+	binary.BigEndian.PutUint16(header[3:], uint16(len(plaintext)+k.aead.Overhead()))
+
+	nonce := append([]byte(nil), k.iv...)
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], k.seq)
+	for i := range seq {
+		nonce[len(nonce)-8+i] ^= seq[i]
+	}
+	k.seq++
+
+	return k.aead.Seal(header, nonce, plaintext, header)
+}
+
+// pcapngBlock encodes a little endian PCAPNG block with the body, which must be padded to 32 bits.
+func pcapngBlock(typ uint32, body []byte) []byte {
+	b := make([]byte, 8, 12+len(body))
+	binary.LittleEndian.PutUint32(b, typ)
+	binary.LittleEndian.PutUint32(b[4:], uint32(12+len(body)))
+	b = append(b, body...)
+	return append(b, b[4:8]...)
+}
+
+// decryptionSecrets returns the body of a Decryption Secrets Block with the key log, padded to 32 bits.
+func decryptionSecrets(keyLog string) []byte {
+	secrets := make([]byte, 8, 8+len(keyLog)+3)
+	binary.LittleEndian.PutUint32(secrets, pcapngSecretsTLSKeyLog)
+	binary.LittleEndian.PutUint32(secrets[4:], uint32(len(keyLog)))
+	secrets = append(secrets, keyLog...)
+	for len(secrets)%4 != 0 {
+		secrets = append(secrets, 0)
+	}
+	return secrets
+}
+
+// pcapngCapture writes the packets to a PCAPNG file, preceded by a Decryption Secrets Block with the key log.
+func pcapngCapture(t *testing.T, keyLog string, packets []gopacket.Packet) []byte {
+
+	var (
+		buf    bytes.Buffer
+		ts     = time.Unix(1506363172, 0)
+		w, err = pcapgo.NewNgWriter(&buf, layers.LinkTypeEthernet)
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	buf.Write(pcapngBlock(pcapngDecryptionSecrets, decryptionSecrets(keyLog)))
+
+	for i, p := range packets {
+		err := w.WritePacket(gopacket.CaptureInfo{
+			Timestamp:     ts.Add(time.Duration(i) * time.Millisecond),
+			CaptureLength: len(p.Data()),
+			Length:        len(p.Data()),
+		}, p.Data())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+/*
+ *	Tests
+ */
+
+func TestKeyLog(t *testing.T) {
+
+	var (
+		random = strings.Repeat("ab", 32)
+		secret = strings.Repeat("cd", 32)
+		log    = "# SSL/TLS secrets log file\n" +
+			"CLIENT_HANDSHAKE_TRAFFIC_SECRET " + random + " " + secret + "\n" +
+			"SERVER_HANDSHAKE_TRAFFIC_SECRET " + random + " " + secret + "\n" +
+			"CLIENT_RANDOM " + strings.Repeat("01", 32) + " " + strings.Repeat("02", 48) + "\n"
+	)
+
+	k := NewKeyLog()
+	if err := k.Load(strings.NewReader(log)); err != nil {
+		t.Fatal(err)
+	}
+	if k.Len() != 1 {
+		t.Fatal("expected 1 secret, got", k.Len())
+	}
+	r, _ := hex.DecodeString(random)
+	if s := hex.EncodeToString(k.serverHandshakeSecret(r)); s != secret {
+		t.Fatal("unexpected secret", s)
+	}
+	if err := k.Load(strings.NewReader("SERVER_HANDSHAKE_TRAFFIC_SECRET abc " + secret)); err == nil {
+		t.Fatal("expected an error for the malformed client random")
+	}
+
+	// section header, an unknown block and decryption secrets with padding
+	var (
+		other = strings.Replace(log, random, strings.Repeat("ef", 32), -1)
+		shb   = []byte{0x4d, 0x3c, 0x2b, 0x1a, 1, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+		file  []byte
+	)
+	file = append(file, pcapngBlock(pcapngSectionHeader, shb)...)
+	file = append(file, pcapngBlock(5, make([]byte, 16))...)
+	file = append(file, pcapngBlock(pcapngDecryptionSecrets, decryptionSecrets(other))...)
+	if err := k.LoadPcapng(bytes.NewReader(file)); err != nil {
+		t.Fatal(err)
+	}
+	if k.Len() != 2 {
+		t.Fatal("expected 2 secrets, got", k.Len())
+	}
+	if err := k.LoadPcapng(bytes.NewReader(file[len(pcapngBlock(pcapngSectionHeader, shb)):])); err != ErrNoPcapng {
+		t.Fatal("expected ErrNoPcapng, got", err)
+	}
+	if err := k.LoadPcapng(bytes.NewReader(file[:len(file)-1])); err != io.ErrUnexpectedEOF {
+		t.Fatal("expected io.ErrUnexpectedEOF, got", err)
+	}
+
+	// the secrets are loaded while the data is read in small pieces
+	k = NewKeyLog()
+	if _, err := io.Copy(ioutil.Discard, iotest.OneByteReader(k.PcapngReader(bytes.NewReader(file)))); err != nil || k.Len() != 1 {
+		t.Fatal("unexpected secrets", err, k.Len())
+	}
+}
+
+func TestTLS13Decryption(t *testing.T) {
+
+	var (
+		hello  = clientHelloPayload()
+		random = hello[11:43]
+		cert   = testCertificate(t)
+	)
+
+	encryptedExtensions := handshakeMessage(handshakeTypeEncryptedExtensions, []byte{
+		0, 13,
+		0x00, 0x00, 0, 0, // server name
+		0x00, 0x10, 0, 5, 0, 3, 2, 'h', '2', // ALPN
+	})
+	certificate := handshakeMessage(handshakeTypeCertificate, append([]byte{
+		0, // request context
+		0, byte((len(cert) + 5) >> 8), byte(len(cert) + 5),
+		0, byte(len(cert) >> 8), byte(len(cert)),
+	}, append(cert, 0, 0)...))
+
+	for _, test := range []struct {
+		suite  uint16
+		secret []byte
+	}{
+		{tlsAES128GCMSHA256, bytes.Repeat([]byte{1}, 32)},
+		{tlsAES256GCMSHA384, bytes.Repeat([]byte{2}, 48)},
+		{tlsChaCha20Poly1305SHA256, bytes.Repeat([]byte{3}, 32)},
+	} {
+		keys := newTLS13Keys(test.suite, test.secret)
+		if keys == nil {
+			t.Fatal("no keys for cipher suite", test.suite)
+		}
+
+		// the certificate message spans two records
+		flight := tls13ServerHello(test.suite)
+		flight = append(flight, recordTypeChangeCipherSpec, 0x03, 0x03, 0, 1, 1)
+		flight = append(flight, sealTLS13(keys, recordTypeHandshake, append(encryptedExtensions, certificate[:100]...))...)
+		flight = append(flight, sealTLS13(keys, recordTypeHandshake, certificate[100:])...)
+
+		k := NewKeyLog()
+		err := k.Load(strings.NewReader("SERVER_HANDSHAKE_TRAFFIC_SECRET " + hex.EncodeToString(random) + " " + hex.EncodeToString(test.secret)))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		packets := conversation(t,
+			hello,
+			append([]byte("S:"), flight[:200]...),
+			append([]byte("S:"), flight[200:]...),
+		)
+		records := collectRecordsWith(t, []Option{WithKeyLog(k), WithPairing(DefaultPairTimeout)}, packets...)
+		if len(records) != 1 {
+			t.Fatal("expected 1 record, got", len(records))
+		}
+
+		r := records[0]
+		if r.JA3Digest == "" || r.JA3SDigest == "" || r.EncryptedExtensions != "0-16" || r.ALPN != "h2" {
+			t.Fatal("unexpected record", r.JA3Digest, r.JA3SDigest, r.EncryptedExtensions, r.ALPN)
+		}
+		if len(r.Certificates) != 1 || r.Certificates[0].Subject != "CN=example.com,O=Example" {
+			t.Fatal("unexpected certificates", r.Certificates)
+		}
+
+		// the secret embedded in a compressed PCAPNG file
+		var (
+			capture = pcapngCapture(t, "SERVER_HANDSHAKE_TRAFFIC_SECRET "+hex.EncodeToString(random)+" "+hex.EncodeToString(test.secret)+"\n", packets)
+			file    = tempFile(t, compress(t, "gz", capture))
+			b       bytes.Buffer
+		)
+		defer os.RemoveAll(filepath.Dir(file))
+		err = ReadFileNDJSONErr(file, &b, true, WithKeyLog(NewKeyLog()), WithPairing(DefaultPairTimeout))
+		if err != nil || !bytes.Contains(b.Bytes(), []byte("CN=example.com,O=Example")) {
+			t.Fatal("unexpected output", err, b.String())
+		}
+
+		// and read from a PacketSource
+		k = NewKeyLog()
+		ng, err := pcapgo.NewNgReader(k.PcapngReader(bytes.NewReader(capture)), pcapgo.DefaultNgReaderOptions)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var certificates int
+		err = NewProcessor(true, WithKeyLog(k)).Process(context.Background(), ng, ng.LinkType(), func(r *Record) error {
+			certificates += len(r.Certificates)
+			return nil
+		})
+		if err != nil || certificates != 1 {
+			t.Fatal("unexpected certificates", err, certificates)
+		}
+	}
+
+	// without the secret the server hello is reported right away
+	records := collectRecordsWith(t, []Option{WithKeyLog(NewKeyLog())}, conversation(t,
+		hello,
+		append([]byte("S:"), tls13ServerHello(tlsAES128GCMSHA256)...),
+	)...)
+	if len(records) != 2 || records[1].JA3SDigest == "" || records[1].Certificates != nil {
+		t.Fatal("unexpected records", records)
+	}
+}
+
+func TestTLS13HTTP2(t *testing.T) {
+
+	var (
+		hello         = clientHelloPayload()
+		random        = hex.EncodeToString(hello[11:43])
+		serverSecret  = bytes.Repeat([]byte{1}, 32)
+		clientSecret  = bytes.Repeat([]byte{4}, 32)
+		serverKeys    = newTLS13Keys(tlsAES128GCMSHA256, serverSecret)
+		encExtensions = handshakeMessage(handshakeTypeEncryptedExtensions, []byte{0, 9, 0x00, 0x10, 0, 5, 0, 3, 2, 'h', '2'})
+		finished      = handshakeMessage(20, bytes.Repeat([]byte{5}, 32))
+	)
+
+	k := NewKeyLog()
+	err := k.Load(strings.NewReader("SERVER_HANDSHAKE_TRAFFIC_SECRET " + random + " " + hex.EncodeToString(serverSecret) + "\n" +
+		"CLIENT_TRAFFIC_SECRET_0 " + random + " " + hex.EncodeToString(clientSecret) + "\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flight := tls13ServerHello(tlsAES128GCMSHA256)
+	flight = append(flight, recordTypeChangeCipherSpec, 0x03, 0x03, 0, 1, 1)
+	flight = append(flight, sealTLS13(serverKeys, recordTypeHandshake, append(encExtensions, finished...))...)
+
+	for _, test := range []struct {
+		name    string
+		appData []byte
+		http2   string
+	}{
+		{"http2", testHTTP2Start(), "1:65536;2:0;4:6291456;6:262144|15663105|0|m,a,s,p"},
+		{"http1", []byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"), ""},
+	} {
+		// the finished message of the client is protected with its handshake traffic keys
+		clientKeys := newTLS13Keys(tlsAES128GCMSHA256, clientSecret)
+		client := []byte{recordTypeChangeCipherSpec, 0x03, 0x03, 0, 1, 1}
+		client = append(client, sealTLS13(newTLS13Keys(tlsAES128GCMSHA256, bytes.Repeat([]byte{6}, 32)), recordTypeHandshake, finished)...)
+		client = append(client, sealTLS13(clientKeys, recordTypeApplicationData, test.appData[:30])...)
+		client = append(client, sealTLS13(clientKeys, recordTypeApplicationData, test.appData[30:])...)
+
+		records := collectRecordsWith(t, []Option{WithKeyLog(k), WithPairing(DefaultPairTimeout), WithHTTP2()}, conversation(t,
+			hello,
+			append([]byte("S:"), flight...),
+			client[:50],
+			client[50:],
+		)...)
+		if len(records) != 1 {
+			t.Fatal(test.name, "expected 1 record, got", len(records))
+		}
+
+		r := records[0]
+		if r.JA3Digest == "" || r.JA3SDigest == "" || r.ALPN != "h2" || r.HTTP2 != test.http2 {
+			t.Fatal(test.name, "unexpected record", r.JA3Digest, r.JA3SDigest, r.ALPN, r.HTTP2)
+		}
+		if test.http2 != "" && r.HTTP2Digest != BareToDigestHex([]byte(r.HTTP2)) {
+			t.Fatal(test.name, "unexpected digest", r.HTTP2Digest)
+		}
+	}
+}
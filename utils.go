@@ -3,8 +3,12 @@
 package ja3
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 
 	"github.com/google/gopacket"
 	"github.com/google/gopacket/layers"
@@ -16,49 +20,127 @@ type PacketSource interface {
 	ReadPacketData() ([]byte, gopacket.CaptureInfo, error)
 }
 
-func openPcap(file string) (PacketSource, *os.File, layers.LinkType, error) {
+// pcapngMagic is the type of the section header block at the start of PCAPNG files.
+var pcapngMagic = []byte{0x0a, 0x0d, 0x0d, 0x0a}
+
+// openPcap opens a PCAP or PCAPNG file, which may be compressed, and returns a reader for its packets.
+// The decryption secrets embedded in a PCAPNG file are added to the key log while the packets are read, if it is not nil.
+func openPcap(file string, keyLog *KeyLog) (PacketSource, io.Closer, layers.LinkType, error) {
 
 	// get file handle
-	f, err := os.Open(file)
+	f, err := openCapture(file)
 	if err != nil {
-		panic(err)
+		return nil, nil, 0, err
 	}
 
 	var (
 		reader   PacketSource
 		linkType layers.LinkType
+		r        = bufio.NewReader(f)
+		dlt, ok  = fileLinkType(r)
 	)
 
-	// try to create pcap reader
-	pcapReader, errPcap := pcapgo.NewReader(f)
-	if errPcap != nil {
-
-		// maybe its a PCAPNG
-		// reopen file, otherwise offsets will be wrong
-		err = f.Close()
-		if err != nil {
-			panic(err)
+	if magic, _ := r.Peek(len(pcapngMagic)); bytes.Equal(magic, pcapngMagic) {
+		var data io.Reader = r
+		if keyLog != nil {
+			data = keyLog.PcapngReader(r)
 		}
-		f, err = os.Open(file)
-		if err != nil {
-			panic(err)
-		}
-
-		// try to create pcapng reader
-		ngReader, errPcapNg := pcapgo.NewNgReader(f, pcapgo.DefaultNgReaderOptions)
+		ngReader, errPcapNg := pcapgo.NewNgReader(data, pcapgo.DefaultNgReaderOptions)
 		if errPcapNg != nil {
-			// nope
-			fmt.Println("pcap error:", errPcap)
-			fmt.Println("pcap-ng error:", errPcapNg)
-			panic("cannot open PCAP file")
+			f.Close()
+			return nil, nil, 0, fmt.Errorf("%s: %w (pcapng: %v)", file, ErrUnknownFormat, errPcapNg)
 		}
 
 		linkType = ngReader.LinkType()
 		reader = ngReader
 	} else {
+		pcapReader, errPcap := pcapgo.NewReader(r)
+		if errPcap != nil {
+			f.Close()
+			return nil, nil, 0, fmt.Errorf("%s: %w (pcap: %v)", file, ErrUnknownFormat, errPcap)
+		}
+
 		linkType = pcapReader.LinkType()
 		reader = pcapReader
 	}
 
-	return reader, f, linkType, err
+	if !ok {
+		dlt = int(linkType)
+	}
+	if err = checkLinkType(dlt); err != nil {
+		f.Close()
+		return nil, nil, 0, fmt.Errorf("%s: %w", file, err)
+	}
+
+	return reader, f, linkType, nil
+}
+
+// fileLinkType returns the DLT in the header of a PCAP file, or of the first interface of a PCAPNG file,
+// as the readers of gopacket truncate it to a byte. It returns false if the header cannot be peeked at.
+func fileLinkType(r *bufio.Reader) (int, bool) {
+
+	header, err := r.Peek(24)
+	if err != nil {
+		return 0, false
+	}
+
+	var order binary.ByteOrder = binary.LittleEndian
+	if bytes.Equal(header[:4], pcapngMagic) {
+		if binary.BigEndian.Uint32(header[8:12]) == 0x1a2b3c4d {
+			order = binary.BigEndian
+		}
+		// the interface description block follows the section header block
+		length := int(order.Uint32(header[4:8]))
+		blocks, err := r.Peek(length + 10)
+		if err != nil || order.Uint32(blocks[length:]) != 1 {
+			return 0, false
+		}
+		return int(order.Uint16(blocks[length+8:])), true
+	}
+
+	if magic := binary.BigEndian.Uint32(header[:4]); magic == 0xa1b2c3d4 || magic == 0xa1b23c4d {
+		order = binary.BigEndian
+	}
+	// the upper bits may carry the FCS length
+	return int(order.Uint32(header[20:24]) & 0xffff), true
+}
+
+// dltLinuxSLL2 is the DLT of the Linux "any" device with libpcap 1.10 and later.
+const dltLinuxSLL2 = 276
+
+// sll2HeaderLen is the length of the Linux SLL2 header, which starts with the EtherType of the packet.
+const sll2HeaderLen = 20
+
+// LinkTypeLinuxSLL2 is the link type of packets captured on the Linux "any" device with libpcap 1.10 and later.
+// gopacket stores link types in a byte, its readers and capture handles return the truncated DLT 276 for these packets,
+// which is decoded by the readers and the PacketDecoder.
+const LinkTypeLinuxSLL2 = layers.LinkType(dltLinuxSLL2 & 0xff)
+
+// linkTypeDLT returns the DLT of the link type, which differs for LinkTypeLinuxSLL2.
+func linkTypeDLT(link layers.LinkType) int {
+	if link == LinkTypeLinuxSLL2 {
+		return dltLinuxSLL2
+	}
+	return int(link)
+}
+
+// linkDecoder returns the decoder for packets of the given link type.
+// gopacket has no decoders for the IPv4 and IPv6 link types, packets of these are decoded as raw IP,
+// and none for Linux SLL2, packets of which are decoded by decodeLinuxSLL2.
+func linkDecoder(link layers.LinkType) gopacket.Decoder {
+	switch link {
+	case layers.LinkTypeIPv4, layers.LinkTypeIPv6:
+		return layers.LinkTypeRaw
+	case LinkTypeLinuxSLL2:
+		return gopacket.DecodeFunc(decodeLinuxSLL2)
+	}
+	return link
+}
+
+// decodeLinuxSLL2 skips the Linux SLL2 header and decodes the packet by the EtherType at its start.
+func decodeLinuxSLL2(data []byte, p gopacket.PacketBuilder) error {
+	if len(data) < sll2HeaderLen {
+		return errors.New("Linux SLL2 packet too small")
+	}
+	return layers.EthernetType(binary.BigEndian.Uint16(data)).Decode(data[sll2HeaderLen:], p)
 }